@@ -0,0 +1,42 @@
+package alloc
+
+import (
+	"fmt"
+
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+func BreakdownCLI(c *cli.Context, logger *log.Logger) error {
+	dimensions := getCLIArgs(c)
+	if len(dimensions) == 0 {
+		return fmt.Errorf("Missing argument for list of fields to use as dimensions")
+	}
+
+	nomadClient, err := nomad.NewNomadClientFromCLI(c)
+	if err != nil {
+		return err
+	}
+
+	allocs, err := getData(nomadClient, filterFromCLI(c.Parent()), logger)
+	if err != nil {
+		return err
+	}
+
+	propReader := helpers.NewAllocPropReader(dimensions...).WithNodes(nomadClient)
+
+	rows, err := readRows(allocs, propReader)
+	if err != nil {
+		return err
+	}
+
+	res, err := helpers.BreakdownResponse(c.String("output-format"), propReader.GetKeys(), rows)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(res)
+	return nil
+}
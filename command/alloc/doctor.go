@@ -0,0 +1,252 @@
+package alloc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+// Problems found by alloc doctor
+const (
+	problemStoppedRunning = "stopped-but-running"
+	problemJobStopped     = "job-stopped"
+	problemNodeDown       = "node-down"
+	problemNodeMissing    = "node-missing"
+	problemStuckPending   = "stuck-pending"
+	problemRestarting     = "restarting"
+)
+
+var allProblems = []string{problemStoppedRunning, problemJobStopped, problemNodeDown, problemNodeMissing, problemStuckPending, problemRestarting}
+
+var doctorFields = []string{"id", "job", "group", "node", "status", "desired", "problem", "detail"}
+
+// finding is a problem with an allocation
+type finding struct {
+	alloc   *api.AllocationListStub
+	problem string
+	detail  string
+}
+
+// doctor checks allocations for problems, only the checks in "checks" are run
+type doctor struct {
+	checks      []string
+	stuckAfter  time.Duration
+	maxRestarts uint64
+	now         time.Time
+	jobs        map[string]*api.JobListStub // by namespace/id
+	nodes       func(nodeID string) (*api.Node, error)
+}
+
+// Doctor finds allocations in problem states, and optionally stops them so Nomad replaces
+// the ones whose job still runs, or forces the jobs to reschedule their failed allocations
+func Doctor(c *cli.Context, logger *log.Logger) error {
+	checks := helpers.DeleteEmpty(c.StringSlice("check"))
+	if len(checks) == 0 {
+		checks = allProblems
+	}
+	for _, check := range checks {
+		if !helpers.Contains(check, allProblems) {
+			return fmt.Errorf("Unknown check '%s', must be one of %s", check, strings.Join(allProblems, ", "))
+		}
+	}
+
+	fix := c.String("fix")
+	if fix != "" && fix != "stop" && fix != "reschedule" {
+		return fmt.Errorf("Invalid --fix '%s', must be stop or reschedule", fix)
+	}
+
+	nomadClient, err := nomad.NewNomadClientFromCLI(c)
+	if err != nil {
+		return err
+	}
+
+	allocs, err := getData(nomadClient, filterFromCLI(c.Parent()), logger)
+	if err != nil {
+		return err
+	}
+
+	// Allocations can belong to any namespace the token can read, so list the jobs of all of them
+	jobs, _, err := nomadClient.Jobs().List(&api.QueryOptions{Namespace: "*"})
+	if err != nil {
+		return err
+	}
+
+	d := &doctor{
+		checks:      checks,
+		stuckAfter:  c.Duration("stuck-after"),
+		maxRestarts: uint64(c.Int("max-restarts")),
+		now:         time.Now(),
+		jobs:        make(map[string]*api.JobListStub, len(jobs)),
+		nodes: func(nodeID string) (*api.Node, error) {
+			return helpers.LookupNode(nodeID, nomadClient)
+		},
+	}
+	for _, job := range jobs {
+		d.jobs[job.Namespace+"/"+job.ID] = job
+	}
+
+	findings := make([]*finding, 0)
+	for _, alloc := range allocs {
+		found, err := d.diagnose(alloc)
+		if err != nil {
+			return err
+		}
+
+		findings = append(findings, found...)
+	}
+
+	rows := make([][]string, 0, len(findings))
+	for _, f := range findings {
+		rows = append(rows, []string{f.alloc.ID, f.alloc.JobID, f.alloc.TaskGroup, f.alloc.NodeName, f.alloc.ClientStatus, f.alloc.DesiredStatus, f.problem, f.detail})
+	}
+
+	res, err := helpers.RowsResponse(c.String("output-format"), doctorFields, rows)
+	if err != nil {
+		return err
+	}
+	fmt.Println(res)
+
+	logger.Infof("Found %d problems in %d allocations", len(findings), len(allocs))
+
+	switch fix {
+	case "stop":
+		return stopAllocations(nomadClient, findings, c.Bool("dry"), logger)
+	case "reschedule":
+		return rescheduleJobs(nomadClient, findings, c.Bool("dry"), logger)
+	}
+
+	return nil
+}
+
+// diagnose returns the problems of a pending or running allocation
+func (d *doctor) diagnose(alloc *api.AllocationListStub) ([]*finding, error) {
+	if alloc.ClientStatus != "pending" && alloc.ClientStatus != "running" {
+		return nil, nil
+	}
+
+	findings := make([]*finding, 0)
+	add := func(problem, format string, a ...interface{}) {
+		if helpers.Contains(problem, d.checks) {
+			findings = append(findings, &finding{alloc: alloc, problem: problem, detail: fmt.Sprintf(format, a...)})
+		}
+	}
+
+	// Nomad needs a moment to stop allocations, only flag the ones that are stuck
+	since := d.now.Sub(time.Unix(0, alloc.ModifyTime))
+	if alloc.DesiredStatus != "run" && alloc.ClientStatus == "running" && since > d.stuckAfter {
+		add(problemStoppedRunning, "desired status %s for %s", alloc.DesiredStatus, since.Round(time.Minute))
+	}
+
+	if job, ok := d.jobs[alloc.Namespace+"/"+alloc.JobID]; !ok {
+		add(problemJobStopped, "job no longer exists")
+	} else if job.Stop {
+		add(problemJobStopped, "job is stopped")
+	}
+
+	if helpers.Contains(problemNodeDown, d.checks) || helpers.Contains(problemNodeMissing, d.checks) {
+		node, err := d.nodes(alloc.NodeID)
+		switch {
+		case err != nil && strings.Contains(err.Error(), "404"):
+			add(problemNodeMissing, "node %s was purged", alloc.NodeID)
+		case err != nil:
+			return nil, err
+		case node.Status != "ready":
+			add(problemNodeDown, "node %s is %s since %s", node.Name, node.Status, time.Unix(node.StatusUpdatedAt, 0).UTC().Format(time.RFC3339))
+		}
+	}
+
+	if pending := d.now.Sub(time.Unix(0, alloc.CreateTime)); alloc.ClientStatus == "pending" && pending > d.stuckAfter {
+		add(problemStuckPending, "pending for %s", pending.Round(time.Minute))
+	}
+
+	restarts := uint64(0)
+	tasks := make([]string, 0)
+	for name, state := range alloc.TaskStates {
+		if state != nil && state.Restarts > 0 {
+			restarts += state.Restarts
+			tasks = append(tasks, fmt.Sprintf("%s=%d", name, state.Restarts))
+		}
+	}
+	if d.maxRestarts > 0 && restarts >= d.maxRestarts {
+		sort.Strings(tasks)
+		add(problemRestarting, "restarted %d times (%s)", restarts, strings.Join(tasks, ", "))
+	}
+
+	return findings, nil
+}
+
+func stopAllocations(client *api.Client, findings []*finding, dry bool, logger *log.Logger) error {
+	stopped := make(map[string]bool)
+	failed := 0
+
+	for _, f := range findings {
+		if stopped[f.alloc.ID] {
+			continue
+		}
+		stopped[f.alloc.ID] = true
+
+		if dry {
+			logger.Infof("Would stop allocation %s of %s (%s)", f.alloc.ID, f.alloc.JobID, f.problem)
+			continue
+		}
+
+		_, err := client.Allocations().Stop(&api.Allocation{ID: f.alloc.ID}, &api.QueryOptions{Namespace: f.alloc.Namespace})
+		if err != nil {
+			logger.Errorf("Could not stop allocation %s of %s: %s", f.alloc.ID, f.alloc.JobID, err)
+			failed++
+			continue
+		}
+
+		logger.Infof("Stopped allocation %s of %s (%s)", f.alloc.ID, f.alloc.JobID, f.problem)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("Could not stop %d allocations", failed)
+	}
+
+	return nil
+}
+
+// rescheduleJobs forces one evaluation of every job with problem allocations. Nomad only
+// reschedules the failed allocations of the job for it, even past their reschedule policy.
+// Running and pending allocations are left alone, they are replaced once they fail, are
+// lost with their node, or are stopped
+func rescheduleJobs(client *api.Client, findings []*finding, dry bool, logger *log.Logger) error {
+	evaluated := make(map[string]bool)
+	failed := 0
+
+	for _, f := range findings {
+		key := f.alloc.Namespace + "/" + f.alloc.JobID
+		if evaluated[key] {
+			continue
+		}
+		evaluated[key] = true
+
+		if dry {
+			logger.Infof("Would force rescheduling job %s in namespace %s", f.alloc.JobID, f.alloc.Namespace)
+			continue
+		}
+
+		evalID, _, err := client.Jobs().EvaluateWithOpts(f.alloc.JobID, api.EvalOptions{ForceReschedule: true}, &api.WriteOptions{Namespace: f.alloc.Namespace})
+		if err != nil {
+			logger.Errorf("Could not force rescheduling job %s in namespace %s: %s", f.alloc.JobID, f.alloc.Namespace, err)
+			failed++
+			continue
+		}
+
+		logger.Infof("Forced rescheduling job %s in namespace %s (evaluation %s)", f.alloc.JobID, f.alloc.Namespace, evalID)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("Could not force rescheduling %d jobs", failed)
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package alloc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestDoctorDiagnose(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-time.Hour).UnixNano()
+	recent := now.Add(-time.Minute).UnixNano()
+
+	d := &doctor{
+		checks:      allProblems,
+		stuckAfter:  10 * time.Minute,
+		maxRestarts: 5,
+		now:         now,
+		jobs: map[string]*api.JobListStub{
+			"default/web":  {ID: "web", Namespace: "default"},
+			"default/cron": {ID: "cron", Namespace: "default", Stop: true},
+		},
+		nodes: func(nodeID string) (*api.Node, error) {
+			switch nodeID {
+			case "ready":
+				return &api.Node{Name: "node-1", Status: "ready"}, nil
+			case "down":
+				return &api.Node{Name: "node-2", Status: "down", StatusUpdatedAt: now.Add(-time.Hour).Unix()}, nil
+			}
+			return nil, fmt.Errorf("Unexpected response code: 404 (node not found)")
+		},
+	}
+
+	tests := []struct {
+		name  string
+		alloc *api.AllocationListStub
+		want  []string
+	}{
+		{
+			name:  "healthy",
+			alloc: &api.AllocationListStub{Namespace: "default", JobID: "web", NodeID: "ready", ClientStatus: "running", DesiredStatus: "run", CreateTime: old, ModifyTime: old},
+			want:  []string{},
+		},
+		{
+			name:  "complete allocations are skipped",
+			alloc: &api.AllocationListStub{Namespace: "default", JobID: "gone", NodeID: "gone", ClientStatus: "complete", DesiredStatus: "stop"},
+			want:  nil,
+		},
+		{
+			name:  "recently stopped",
+			alloc: &api.AllocationListStub{Namespace: "default", JobID: "web", NodeID: "ready", ClientStatus: "running", DesiredStatus: "stop", ModifyTime: recent},
+			want:  []string{},
+		},
+		{
+			name:  "stopped but running",
+			alloc: &api.AllocationListStub{Namespace: "default", JobID: "web", NodeID: "ready", ClientStatus: "running", DesiredStatus: "stop", ModifyTime: old},
+			want:  []string{"stopped-but-running: desired status stop for 1h0m0s"},
+		},
+		{
+			name:  "stopped and purged jobs",
+			alloc: &api.AllocationListStub{Namespace: "default", JobID: "cron", NodeID: "ready", ClientStatus: "running", DesiredStatus: "run"},
+			want:  []string{"job-stopped: job is stopped"},
+		},
+		{
+			name:  "down node",
+			alloc: &api.AllocationListStub{Namespace: "default", JobID: "web", NodeID: "down", ClientStatus: "running", DesiredStatus: "run"},
+			want:  []string{"node-down: node node-2 is down since 2022-10-01T11:00:00Z"},
+		},
+		{
+			name:  "purged node and job",
+			alloc: &api.AllocationListStub{Namespace: "default", JobID: "gone", NodeID: "gone", ClientStatus: "running", DesiredStatus: "run"},
+			want:  []string{"job-stopped: job no longer exists", "node-missing: node gone was purged"},
+		},
+		{
+			name:  "stuck pending",
+			alloc: &api.AllocationListStub{Namespace: "default", JobID: "web", NodeID: "ready", ClientStatus: "pending", DesiredStatus: "run", CreateTime: old},
+			want:  []string{"stuck-pending: pending for 1h0m0s"},
+		},
+		{
+			name: "restarting",
+			alloc: &api.AllocationListStub{Namespace: "default", JobID: "web", NodeID: "ready", ClientStatus: "running", DesiredStatus: "run", TaskStates: map[string]*api.TaskState{
+				"web":     {Restarts: 4},
+				"sidecar": {Restarts: 2},
+				"log":     nil,
+			}},
+			want: []string{"restarting: restarted 6 times (sidecar=2, web=4)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := d.diagnose(tt.alloc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			if findings != nil {
+				got = make([]string, 0, len(findings))
+				for _, f := range findings {
+					got = append(got, f.problem+": "+f.detail)
+				}
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diagnose() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRescheduleJobs(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req api.JobEvaluateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("could not decode the request: %s", err)
+		}
+
+		got = append(got, fmt.Sprintf("%s %s?namespace=%s force=%t", r.Method, r.URL.Path, r.URL.Query().Get("namespace"), req.EvalOptions.ForceReschedule))
+		w.Write([]byte(`{"EvalID":"eval"}`))
+	}))
+	defer server.Close()
+
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings := []*finding{
+		{alloc: &api.AllocationListStub{ID: "1", Namespace: "default", JobID: "web"}, problem: problemNodeDown},
+		{alloc: &api.AllocationListStub{ID: "1", Namespace: "default", JobID: "web"}, problem: problemRestarting},
+		{alloc: &api.AllocationListStub{ID: "2", Namespace: "default", JobID: "web"}, problem: problemNodeDown},
+		{alloc: &api.AllocationListStub{ID: "3", Namespace: "batch", JobID: "web"}, problem: problemStuckPending},
+		{alloc: &api.AllocationListStub{ID: "4", Namespace: "default", JobID: "api"}, problem: problemNodeMissing},
+	}
+
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+
+	if err := rescheduleJobs(client, findings, true, logger); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("dry run sent requests %v", got)
+	}
+
+	if err := rescheduleJobs(client, findings, false, logger); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"PUT /v1/job/web/evaluate?namespace=default force=true",
+		"PUT /v1/job/web/evaluate?namespace=batch force=true",
+		"PUT /v1/job/api/evaluate?namespace=default force=true",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got requests %q, want %q", got, want)
+	}
+}
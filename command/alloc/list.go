@@ -0,0 +1,42 @@
+package alloc
+
+import (
+	"fmt"
+
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+func ListCLI(c *cli.Context, logger *log.Logger) error {
+	fields := listDefaultFields
+	if input := getCLIArgs(c); len(input) > 0 {
+		fields = input
+	}
+
+	nomadClient, err := nomad.NewNomadClientFromCLI(c)
+	if err != nil {
+		return err
+	}
+
+	allocs, err := getData(nomadClient, filterFromCLI(c.Parent()), logger)
+	if err != nil {
+		return err
+	}
+
+	propReader := helpers.NewAllocPropReader(fields...).WithNodes(nomadClient)
+
+	rows, err := readRows(allocs, propReader)
+	if err != nil {
+		return err
+	}
+
+	res, err := helpers.RowsResponse(c.String("output-format"), propReader.GetKeys(), rows)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(res)
+	return nil
+}
@@ -0,0 +1,106 @@
+package alloc
+
+import (
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+var listDefaultFields = []string{"id", "job", "group", "node", "status", "desired", "version", "age"}
+
+// filter narrows down the allocations, from the flags of the "alloc" command
+type filter struct {
+	Desired string
+	Group   string
+	Job     string
+	Prefix  string
+	Status  []string
+}
+
+func filterFromCLI(c *cli.Context) filter {
+	return filter{
+		Desired: c.String("filter-desired"),
+		Group:   c.String("filter-group"),
+		Job:     c.String("filter-job"),
+		Prefix:  c.String("filter-prefix"),
+		Status:  helpers.DeleteEmpty(c.StringSlice("filter-status")),
+	}
+}
+
+func (f filter) match(alloc *api.AllocationListStub) bool {
+	if f.Job != "" && alloc.JobID != f.Job {
+		return false
+	}
+
+	if f.Group != "" && alloc.TaskGroup != f.Group {
+		return false
+	}
+
+	if f.Desired != "" && alloc.DesiredStatus != f.Desired {
+		return false
+	}
+
+	if len(f.Status) > 0 && !helpers.Contains(alloc.ClientStatus, f.Status) {
+		return false
+	}
+
+	return true
+}
+
+// getCLIArgs reads the fields from the arguments, either space or comma separated
+func getCLIArgs(c *cli.Context) []string {
+	fields := make([]string, 0)
+	for _, arg := range c.Args() {
+		fields = append(fields, helpers.DeleteEmpty(strings.Split(arg, ","))...)
+	}
+
+	return fields
+}
+
+// getData reads the allocations matching the filters. Only the allocations of the job are
+// read from Nomad when filtering by job
+func getData(client *api.Client, f filter, logger *log.Logger) ([]*api.AllocationListStub, error) {
+	var allocs []*api.AllocationListStub
+	var err error
+
+	logger.Info("Finding allocations")
+	if f.Job != "" {
+		allocs, _, err = client.Jobs().Allocations(f.Job, true, nil)
+	} else {
+		allocs, _, err = client.Allocations().List(&api.QueryOptions{Prefix: f.Prefix})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]*api.AllocationListStub, 0, len(allocs))
+	for _, alloc := range allocs {
+		if f.Prefix != "" && !strings.HasPrefix(alloc.ID, f.Prefix) {
+			continue
+		}
+
+		if f.match(alloc) {
+			matches = append(matches, alloc)
+		}
+	}
+
+	logger.Infof("Found %d matched allocations", len(matches))
+	return matches, nil
+}
+
+func readRows(allocs []*api.AllocationListStub, reader helpers.AllocReader) ([][]string, error) {
+	rows := make([][]string, 0, len(allocs))
+	for _, alloc := range allocs {
+		row, err := reader.Read(alloc)
+		if err != nil {
+			return nil, err
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
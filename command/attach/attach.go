@@ -5,14 +5,14 @@ import (
 	"os"
 	"os/exec"
 
-	"github.com/hashicorp/nomad/api"
 	"github.com/mitchellh/colorstring"
 	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
 	cli "github.com/urfave/cli"
 )
 
 func Run(c *cli.Context) error {
-	nomadClient, err := api.NewClient(api.DefaultConfig())
+	nomadClient, err := nomad.NewNomadClient()
 	if err != nil {
 		return err
 	}
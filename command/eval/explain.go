@@ -0,0 +1,284 @@
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/olekukonko/tablewriter"
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+// explanation is why the task groups of a blocked or failed evaluation could not be placed
+type explanation struct {
+	ID          string              `json:"id"`
+	Status      string              `json:"status"`
+	Description string              `json:"description,omitempty"`
+	TriggeredBy string              `json:"triggered_by"`
+	Created     string              `json:"created"`
+	Groups      []*groupExplanation `json:"groups"`
+}
+
+type groupExplanation struct {
+	Group    string     `json:"group"`
+	Failed   int        `json:"failed"`
+	Reasons  []string   `json:"reasons"`
+	Closest  []*nodeFit `json:"closest_nodes"`
+	metric   *api.AllocationMetric
+	required *requirements
+}
+
+// Explain finds the blocked and failed evaluations of a job, decodes why their task groups
+// could not be placed, and checks the current nodes to show which came closest to fitting
+func Explain(c *cli.Context, logger *log.Logger) error {
+	jobID := c.Args().First()
+	if jobID == "" {
+		return fmt.Errorf("Must provide a job ID")
+	}
+
+	nomadClient, err := nomad.NewNomadClientFromCLI(c)
+	if err != nil {
+		return err
+	}
+
+	// without --namespace the namespace of the client (like NOMAD_NAMESPACE) is used
+	q := &api.QueryOptions{Namespace: c.String("namespace")}
+
+	job, _, err := nomadClient.Jobs().Info(jobID, q)
+	if err != nil {
+		return err
+	}
+
+	evaluations, _, err := nomadClient.Jobs().Evaluations(jobID, q)
+	if err != nil {
+		return err
+	}
+
+	explanations := explainEvaluations(evaluations)
+	if len(explanations) == 0 {
+		logger.Infof("Job %s has no blocked or failed evaluations", jobID)
+		return nil
+	}
+
+	nodes, err := helpers.FilteredClientList(nomadClient, false, helpers.ClientFilter{AllStatuses: true}, logger)
+	if err != nil {
+		return err
+	}
+
+	// the allocations of every namespace use the resources of the nodes
+	allocs, _, err := nomadClient.Allocations().List(&api.QueryOptions{Namespace: "*", Params: map[string]string{"resources": "true"}})
+	if err != nil {
+		return err
+	}
+	used := nodeUsage(allocs)
+
+	groups := make(map[string]*api.TaskGroup, len(job.TaskGroups))
+	for _, group := range job.TaskGroups {
+		groups[*group.Name] = group
+	}
+
+	for _, explanation := range explanations {
+		for _, group := range explanation.Groups {
+			taskGroup, ok := groups[group.Group]
+			if !ok {
+				group.Reasons = append(group.Reasons, "task group is no longer part of the job")
+				continue
+			}
+
+			group.required = groupRequirements(job, taskGroup)
+
+			fits := make([]*nodeFit, 0, len(nodes))
+			for _, node := range nodes {
+				fits = append(fits, checkNode(node, used[node.ID], group.required))
+			}
+			group.Closest = closestNodes(fits, c.Int("nodes"))
+		}
+	}
+
+	res, err := explainResponse(c.String("output-format"), explanations)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(res)
+	return nil
+}
+
+// explainEvaluations finds the blocked and failed evaluations, newest first. A blocked
+// evaluation gets its placement failures from the evaluation that created it when it has
+// none of its own
+func explainEvaluations(evaluations []*api.Evaluation) []*explanation {
+	createdBy := make(map[string]*api.Evaluation)
+	for _, evaluation := range evaluations {
+		if evaluation.BlockedEval != "" {
+			createdBy[evaluation.BlockedEval] = evaluation
+		}
+	}
+
+	sort.Slice(evaluations, func(i, j int) bool {
+		return evaluations[i].CreateIndex > evaluations[j].CreateIndex
+	})
+
+	result := make([]*explanation, 0)
+	for _, evaluation := range evaluations {
+		if evaluation.Status != "blocked" && evaluation.Status != "failed" {
+			continue
+		}
+
+		failed := evaluation.FailedTGAllocs
+		if len(failed) == 0 && createdBy[evaluation.ID] != nil {
+			failed = createdBy[evaluation.ID].FailedTGAllocs
+		}
+
+		explanation := &explanation{
+			ID:          evaluation.ID,
+			Status:      evaluation.Status,
+			Description: evaluation.StatusDescription,
+			TriggeredBy: evaluation.TriggeredBy,
+			Created:     time.Unix(0, evaluation.CreateTime).UTC().Format(time.RFC3339),
+			Groups:      make([]*groupExplanation, 0, len(failed)),
+		}
+
+		for name, metric := range failed {
+			explanation.Groups = append(explanation.Groups, &groupExplanation{
+				Group:   name,
+				Failed:  metric.CoalescedFailures + 1,
+				Reasons: decodeMetric(metric),
+				Closest: make([]*nodeFit, 0),
+				metric:  metric,
+			})
+		}
+		sort.Slice(explanation.Groups, func(i, j int) bool {
+			return explanation.Groups[i].Group < explanation.Groups[j].Group
+		})
+
+		result = append(result, explanation)
+	}
+
+	return result
+}
+
+// decodeMetric describes the placement metrics of a task group the same way "nomad job
+// status" does, most filtered first
+func decodeMetric(metric *api.AllocationMetric) []string {
+	reasons := make([]string, 0)
+
+	if metric.NodesEvaluated == 0 {
+		reasons = append(reasons, "no nodes were eligible for evaluation")
+	}
+
+	for _, dc := range sortedKeys(metric.NodesAvailable) {
+		if metric.NodesAvailable[dc] == 0 {
+			reasons = append(reasons, fmt.Sprintf("no nodes are available in datacenter %s", dc))
+		}
+	}
+
+	for _, class := range sortedKeys(metric.ClassFiltered) {
+		reasons = append(reasons, fmt.Sprintf("class %s filtered %d nodes", class, metric.ClassFiltered[class]))
+	}
+
+	for _, constraint := range sortedKeys(metric.ConstraintFiltered) {
+		reasons = append(reasons, fmt.Sprintf("constraint %s filtered %d nodes", constraint, metric.ConstraintFiltered[constraint]))
+	}
+
+	if metric.NodesExhausted > 0 {
+		reasons = append(reasons, fmt.Sprintf("resources exhausted on %d nodes", metric.NodesExhausted))
+	}
+
+	for _, class := range sortedKeys(metric.ClassExhausted) {
+		reasons = append(reasons, fmt.Sprintf("class %s exhausted on %d nodes", class, metric.ClassExhausted[class]))
+	}
+
+	for _, dimension := range sortedKeys(metric.DimensionExhausted) {
+		reasons = append(reasons, fmt.Sprintf("dimension %s exhausted on %d nodes", dimension, metric.DimensionExhausted[dimension]))
+	}
+
+	for _, quota := range metric.QuotaExhausted {
+		reasons = append(reasons, fmt.Sprintf("quota limit reached: %s", quota))
+	}
+
+	return reasons
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	// most nodes first, so the biggest reason is read first
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
+
+func explainResponse(format string, explanations []*explanation) (string, error) {
+	switch format {
+	case "table":
+		var b bytes.Buffer
+		writer := bufio.NewWriter(&b)
+
+		for _, explanation := range explanations {
+			fmt.Fprintf(writer, "Evaluation %s is %s (triggered by %s at %s)\n", explanation.ID, explanation.Status, explanation.TriggeredBy, explanation.Created)
+			if explanation.Description != "" {
+				fmt.Fprintf(writer, "  %s\n", explanation.Description)
+			}
+
+			for _, group := range explanation.Groups {
+				fmt.Fprintf(writer, "\nTask group %q: %d allocations could not be placed\n", group.Group, group.Failed)
+				if group.metric != nil {
+					fmt.Fprintf(writer, "  %d nodes evaluated, %d filtered, %d exhausted\n", group.metric.NodesEvaluated, group.metric.NodesFiltered, group.metric.NodesExhausted)
+				}
+				for _, reason := range group.Reasons {
+					fmt.Fprintf(writer, "  * %s\n", reason)
+				}
+
+				if len(group.Closest) == 0 {
+					continue
+				}
+
+				fmt.Fprintf(writer, "\nClosest nodes for %q (needs %d MHz cpu, %d MB memory):\n", group.Group, group.required.CPU, group.required.MemoryMB)
+
+				table := tablewriter.NewWriter(writer)
+				table.SetAutoMergeCells(false)
+				table.SetRowLine(true)
+				table.SetColWidth(80)
+				table.SetHeader([]string{"node", "class", "datacenter", "free cpu", "free memory", "rejected because"})
+
+				for _, fit := range group.Closest {
+					reasons := strings.Join(fit.Reasons, ", ")
+					if reasons == "" {
+						reasons = "fits now"
+					}
+
+					table.Append([]string{fit.Node, fit.Class, fit.DC, fmt.Sprintf("%d", fit.FreeCPU), fmt.Sprintf("%d", fit.FreeMemMB), reasons})
+				}
+
+				table.Render()
+			}
+
+			fmt.Fprintln(writer)
+		}
+
+		writer.Flush()
+		return b.String(), nil
+
+	case "json", "json-pretty":
+		return helpers.MarshalJSON(format, explanations)
+
+	default:
+		return "", helpers.InvalidInputf("Invalid output-format: %s", format)
+	}
+}
@@ -0,0 +1,208 @@
+package eval
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestDecodeMetric(t *testing.T) {
+	metric := &api.AllocationMetric{
+		NodesEvaluated:     6,
+		NodesAvailable:     map[string]int{"dc1": 6, "dc2": 0},
+		ClassFiltered:      map[string]int{"batch": 2},
+		ConstraintFiltered: map[string]int{"${meta.pool} = a": 1, "${attr.kernel.name} = linux": 3},
+		NodesExhausted:     3,
+		DimensionExhausted: map[string]int{"memory": 3},
+		QuotaExhausted:     []string{"memory exhausted (2048 needed > 1024 limit)"},
+	}
+
+	want := []string{
+		"no nodes are available in datacenter dc2",
+		"class batch filtered 2 nodes",
+		"constraint ${attr.kernel.name} = linux filtered 3 nodes",
+		"constraint ${meta.pool} = a filtered 1 nodes",
+		"resources exhausted on 3 nodes",
+		"dimension memory exhausted on 3 nodes",
+		"quota limit reached: memory exhausted (2048 needed > 1024 limit)",
+	}
+
+	if got := decodeMetric(metric); !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeMetric() = %q, want %q", got, want)
+	}
+}
+
+func TestExplainEvaluations(t *testing.T) {
+	metric := &api.AllocationMetric{NodesEvaluated: 1, CoalescedFailures: 2}
+	evaluations := []*api.Evaluation{
+		{ID: "complete", Status: "complete", CreateIndex: 1, BlockedEval: "blocked", FailedTGAllocs: map[string]*api.AllocationMetric{"app": metric}},
+		{ID: "blocked", Status: "blocked", CreateIndex: 2},
+		{ID: "failed", Status: "failed", CreateIndex: 3, StatusDescription: "maximum attempts reached (5)"},
+	}
+
+	got := explainEvaluations(evaluations)
+	if len(got) != 2 || got[0].ID != "failed" || got[1].ID != "blocked" {
+		t.Fatalf("unexpected evaluations %+v", got)
+	}
+
+	if len(got[0].Groups) != 0 || got[0].Description != "maximum attempts reached (5)" {
+		t.Errorf("unexpected failed evaluation %+v", got[0])
+	}
+
+	if len(got[1].Groups) != 1 || got[1].Groups[0].Group != "app" || got[1].Groups[0].Failed != 3 {
+		t.Errorf("blocked evaluation should use the failures of the evaluation that created it, got %+v", got[1].Groups)
+	}
+}
+
+func TestCheckNode(t *testing.T) {
+	node := &api.Node{
+		Name:                  "node-1",
+		Datacenter:            "dc1",
+		NodeClass:             "web",
+		Status:                "ready",
+		SchedulingEligibility: "eligible",
+		Attributes:            map[string]string{"kernel.name": "linux"},
+		Meta:                  map[string]string{"pool": "a", "tags": "ssd,gpu"},
+		Drivers:               map[string]*api.DriverInfo{"docker": {Detected: true, Healthy: true}},
+		NodeResources:         &api.NodeResources{Cpu: api.NodeCpuResources{CpuShares: 4000}, Memory: api.NodeMemoryResources{MemoryMB: 8192}, Disk: api.NodeDiskResources{DiskMB: 10000}},
+		ReservedResources:     &api.NodeReservedResources{Cpu: api.NodeReservedCpuResources{CpuShares: 500}, Memory: api.NodeReservedMemoryResources{MemoryMB: 1024}},
+	}
+	used := &usage{CPU: 3000, MemoryMB: 4096}
+
+	tests := []struct {
+		name string
+		req  *requirements
+		want []string
+	}{
+		{
+			name: "fits",
+			req: &requirements{
+				Datacenters: []string{"dc1"},
+				Drivers:     []string{"docker"},
+				CPU:         500,
+				MemoryMB:    1024,
+				Constraints: []*api.Constraint{
+					{LTarget: "${attr.kernel.name}", Operand: "=", RTarget: "linux"},
+					{LTarget: "${meta.tags}", Operand: "set_contains", RTarget: "gpu"},
+					{LTarget: "${node.class}", Operand: "regexp", RTarget: "^we"},
+					{LTarget: "${meta.missing}", Operand: "!=", RTarget: "x"},
+					{Operand: "distinct_hosts", RTarget: "true"},
+				},
+			},
+			want: []string{},
+		},
+		{
+			name: "rejected",
+			req: &requirements{
+				Datacenters: []string{"dc2"},
+				Drivers:     []string{"exec"},
+				CPU:         1000,
+				MemoryMB:    1024,
+				Constraints: []*api.Constraint{
+					{LTarget: "${meta.pool}", Operand: "=", RTarget: "b"},
+					{LTarget: "${meta.missing}", Operand: "is_set"},
+				},
+			},
+			want: []string{
+				"datacenter dc1 is not used by the job",
+				"driver exec is missing or unhealthy",
+				"constraint ${meta.pool} = b filtered",
+				"constraint ${meta.missing} is_set filtered",
+				"cpu exhausted, needs 1000 MHz but 500 free",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkNode(node, used, tt.req).Reasons; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkNode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckConstraintOrder(t *testing.T) {
+	node := &api.Node{
+		Attributes: map[string]string{"cpu.numcores": "16", "cpu.load": "10.5", "os.name": "ubuntu"},
+	}
+
+	tests := []struct {
+		ltarget, operand, rtarget string
+		want                      bool
+	}{
+		{"${attr.cpu.numcores}", ">=", "4", true},
+		{"${attr.cpu.numcores}", ">", "100", false},
+		{"${attr.cpu.numcores}", "<", "9", false},
+		{"${attr.cpu.numcores}", "<=", "16", true},
+		{"${attr.cpu.load}", ">", "9.5", true},
+		{"${attr.cpu.load}", "<", "9.75", false},
+		{"${attr.cpu.numcores}", ">", "8.5", true},
+		{"${attr.os.name}", ">", "debian", true},
+		{"${attr.os.name}", "<", "centos", false},
+		{"${attr.missing}", ">", "1", false},
+	}
+
+	for _, tt := range tests {
+		constraint := &api.Constraint{LTarget: tt.ltarget, Operand: tt.operand, RTarget: tt.rtarget}
+		t.Run(formatConstraint(constraint), func(t *testing.T) {
+			if got := checkConstraint(node, constraint); got != tt.want {
+				t.Errorf("checkConstraint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchDatacenter(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		want     bool
+	}{
+		{patterns: []string{"dc1"}, want: true},
+		{patterns: []string{"dc2", "dc1"}, want: true},
+		{patterns: []string{"dc2"}, want: false},
+		{patterns: []string{"*"}, want: true},
+		{patterns: []string{"dc*"}, want: true},
+		{patterns: []string{"us-*"}, want: false},
+		{patterns: []string{"["}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.patterns, ","), func(t *testing.T) {
+			if got := matchDatacenter("dc1", tt.patterns); got != tt.want {
+				t.Errorf("matchDatacenter(%q) = %v, want %v", tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckConstraintTargets(t *testing.T) {
+	node := &api.Node{Datacenter: "dc1", Meta: map[string]string{"pool": "a"}}
+
+	tests := []struct {
+		ltarget, operand, rtarget string
+		want                      bool
+	}{
+		{"${node.datacenter}", "=", "dc1", true},
+		{"${node.datacenter}", "=", "dc2", false},
+		{"${meta.pool}", "=", "b", false},
+		{"${meta.missing}", "=", "a", false},
+		{"${meta.missing}", "is_set", "", false},
+		{"${node.region}", "=", "eu-west", true},
+		{"${node.pool}", "regexp", "^gpu", true},
+		{"${NOMAD_REGION}", "!=", "eu-west", true},
+		{"${meta.pool}", "=", "${node.region}", true},
+		{"${node.region}", "is_set", "", true},
+	}
+
+	for _, tt := range tests {
+		constraint := &api.Constraint{LTarget: tt.ltarget, Operand: tt.operand, RTarget: tt.rtarget}
+		t.Run(formatConstraint(constraint), func(t *testing.T) {
+			if got := checkConstraint(node, constraint); got != tt.want {
+				t.Errorf("checkConstraint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package eval
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+)
+
+// requirements is what a task group needs from a node to be placed on it
+type requirements struct {
+	Datacenters []string
+	Constraints []*api.Constraint
+	Drivers     []string
+	CPU         int64
+	MemoryMB    int64
+	DiskMB      int64
+}
+
+// usage is the resources used by the allocations on a node
+type usage struct {
+	CPU      int64
+	MemoryMB int64
+	DiskMB   int64
+}
+
+// nodeFit is why a node was rejected for a task group, and how far off it was
+type nodeFit struct {
+	Node      string   `json:"node"`
+	Class     string   `json:"class"`
+	DC        string   `json:"datacenter"`
+	FreeCPU   int64    `json:"free_cpu"`
+	FreeMemMB int64    `json:"free_memory_mb"`
+	Reasons   []string `json:"reasons"`
+	shortfall float64
+}
+
+// groupRequirements collects the datacenters, constraints, drivers and resources of a task group
+func groupRequirements(job *api.Job, group *api.TaskGroup) *requirements {
+	req := &requirements{
+		Datacenters: job.Datacenters,
+		Constraints: make([]*api.Constraint, 0),
+	}
+
+	constraints := append(append([]*api.Constraint{}, job.Constraints...), group.Constraints...)
+
+	if group.EphemeralDisk != nil && group.EphemeralDisk.SizeMB != nil {
+		req.DiskMB = int64(*group.EphemeralDisk.SizeMB)
+	}
+
+	for _, task := range group.Tasks {
+		constraints = append(constraints, task.Constraints...)
+
+		if task.Driver != "" && !helpers.Contains(task.Driver, req.Drivers) {
+			req.Drivers = append(req.Drivers, task.Driver)
+		}
+
+		if task.Resources != nil {
+			if task.Resources.CPU != nil {
+				req.CPU += int64(*task.Resources.CPU)
+			}
+			if task.Resources.MemoryMB != nil {
+				req.MemoryMB += int64(*task.Resources.MemoryMB)
+			}
+		}
+	}
+
+	// the same constraint is often set on the job and the task, only report it once
+	for _, constraint := range constraints {
+		if !hasConstraint(req.Constraints, constraint) {
+			req.Constraints = append(req.Constraints, constraint)
+		}
+	}
+
+	return req
+}
+
+// nodeUsage sums the resources of the allocations that are not stopped, by node ID
+func nodeUsage(allocs []*api.AllocationListStub) map[string]*usage {
+	result := make(map[string]*usage)
+
+	for _, alloc := range allocs {
+		if alloc.DesiredStatus != "run" || (alloc.ClientStatus != "pending" && alloc.ClientStatus != "running") {
+			continue
+		}
+		if alloc.AllocatedResources == nil {
+			continue
+		}
+
+		used, ok := result[alloc.NodeID]
+		if !ok {
+			used = &usage{}
+			result[alloc.NodeID] = used
+		}
+
+		used.DiskMB += alloc.AllocatedResources.Shared.DiskMB
+		for _, task := range alloc.AllocatedResources.Tasks {
+			used.CPU += task.Cpu.CpuShares
+			used.MemoryMB += task.Memory.MemoryMB
+		}
+	}
+
+	return result
+}
+
+// checkNode lists every reason the node can't run the task group, the scheduler stops at
+// the first one so this shows how close the node came to fitting
+func checkNode(node *api.Node, used *usage, req *requirements) *nodeFit {
+	if used == nil {
+		used = &usage{}
+	}
+
+	fit := &nodeFit{Node: node.Name, Class: node.NodeClass, DC: node.Datacenter, Reasons: make([]string, 0)}
+
+	if node.Status != "ready" {
+		fit.Reasons = append(fit.Reasons, fmt.Sprintf("node is %s", node.Status))
+	}
+	if node.SchedulingEligibility != "eligible" {
+		fit.Reasons = append(fit.Reasons, "node is ineligible")
+	}
+	if node.Drain {
+		fit.Reasons = append(fit.Reasons, "node is draining")
+	}
+
+	if len(req.Datacenters) > 0 && !matchDatacenter(node.Datacenter, req.Datacenters) {
+		fit.Reasons = append(fit.Reasons, fmt.Sprintf("datacenter %s is not used by the job", node.Datacenter))
+	}
+
+	for _, driver := range req.Drivers {
+		if info, ok := node.Drivers[driver]; !ok || !info.Detected || !info.Healthy {
+			fit.Reasons = append(fit.Reasons, fmt.Sprintf("driver %s is missing or unhealthy", driver))
+		}
+	}
+
+	for _, constraint := range req.Constraints {
+		if !checkConstraint(node, constraint) {
+			fit.Reasons = append(fit.Reasons, fmt.Sprintf("constraint %s filtered", formatConstraint(constraint)))
+		}
+	}
+
+	var total, reserved usage
+	if node.NodeResources != nil {
+		total = usage{CPU: node.NodeResources.Cpu.CpuShares, MemoryMB: node.NodeResources.Memory.MemoryMB, DiskMB: node.NodeResources.Disk.DiskMB}
+	}
+	if node.ReservedResources != nil {
+		reserved = usage{CPU: int64(node.ReservedResources.Cpu.CpuShares), MemoryMB: int64(node.ReservedResources.Memory.MemoryMB), DiskMB: int64(node.ReservedResources.Disk.DiskMB)}
+	}
+
+	fit.FreeCPU = total.CPU - reserved.CPU - used.CPU
+	fit.FreeMemMB = total.MemoryMB - reserved.MemoryMB - used.MemoryMB
+	freeDiskMB := total.DiskMB - reserved.DiskMB - used.DiskMB
+
+	for _, dimension := range []struct {
+		name       string
+		unit       string
+		free, need int64
+	}{
+		{"cpu", "MHz", fit.FreeCPU, req.CPU},
+		{"memory", "MB", fit.FreeMemMB, req.MemoryMB},
+		{"disk", "MB", freeDiskMB, req.DiskMB},
+	} {
+		if dimension.need > 0 && dimension.free < dimension.need {
+			fit.Reasons = append(fit.Reasons, fmt.Sprintf("%s exhausted, needs %d %s but %d free", dimension.name, dimension.need, dimension.unit, dimension.free))
+			fit.shortfall += float64(dimension.need-dimension.free) / float64(dimension.need)
+		}
+	}
+
+	return fit
+}
+
+// closestNodes orders the nodes by the number of reasons they were rejected, then by how
+// much of the resources they were missing, and returns the first limit nodes
+func closestNodes(fits []*nodeFit, limit int) []*nodeFit {
+	sort.SliceStable(fits, func(i, j int) bool {
+		if len(fits[i].Reasons) != len(fits[j].Reasons) {
+			return len(fits[i].Reasons) < len(fits[j].Reasons)
+		}
+		if fits[i].shortfall != fits[j].shortfall {
+			return fits[i].shortfall < fits[j].shortfall
+		}
+		return fits[i].Node < fits[j].Node
+	})
+
+	if limit > 0 && len(fits) > limit {
+		return fits[:limit]
+	}
+
+	return fits
+}
+
+// checkConstraint is a subset of the Nomad scheduler constraint checks, operands that need
+// more than the node to check (like distinct_hosts or version) are treated as satisfied, and
+// so are targets that can't be resolved from the node (like ${node.region})
+func checkConstraint(node *api.Node, constraint *api.Constraint) bool {
+	left, leftOK, leftKnown := resolveTarget(node, constraint.LTarget)
+	right, rightOK, rightKnown := resolveTarget(node, constraint.RTarget)
+	if !leftKnown || !rightKnown {
+		return true
+	}
+
+	switch constraint.Operand {
+	case "", "=", "==", "is":
+		return leftOK && rightOK && left == right
+	case "!=", "not":
+		return !leftOK || !rightOK || left != right
+	case "<", "<=", ">", ">=":
+		return leftOK && rightOK && checkOrder(constraint.Operand, left, right)
+	case "regexp":
+		if !leftOK || !rightOK {
+			return false
+		}
+		re, err := regexp.Compile(right)
+		return err == nil && re.MatchString(left)
+	case "set_contains", "set_contains_all":
+		if !leftOK || !rightOK {
+			return false
+		}
+		have := splitSet(left)
+		for _, want := range splitSet(right) {
+			if !helpers.Contains(want, have) {
+				return false
+			}
+		}
+		return true
+	case "set_contains_any":
+		if !leftOK || !rightOK {
+			return false
+		}
+		have := splitSet(left)
+		for _, want := range splitSet(right) {
+			if helpers.Contains(want, have) {
+				return true
+			}
+		}
+		return false
+	case "is_set":
+		return leftOK
+	case "is_not_set":
+		return !leftOK
+	}
+
+	return true
+}
+
+// checkOrder compares like the Nomad scheduler, as integers if both values are integers,
+// then as floats, and lexically otherwise
+func checkOrder(operand, left, right string) bool {
+	var cmp int
+	if l, r, ok := parseInts(left, right); ok {
+		cmp = compare(l < r, l > r)
+	} else if l, r, ok := parseFloats(left, right); ok {
+		cmp = compare(l < r, l > r)
+	} else {
+		cmp = strings.Compare(left, right)
+	}
+
+	switch operand {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func parseInts(left, right string) (int64, int64, bool) {
+	l, err := strconv.ParseInt(left, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	r, err := strconv.ParseInt(right, 10, 64)
+	return l, r, err == nil
+}
+
+func parseFloats(left, right string) (float64, float64, bool) {
+	l, err := strconv.ParseFloat(left, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	r, err := strconv.ParseFloat(right, 64)
+	return l, r, err == nil
+}
+
+func compare(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// matchDatacenter matches the datacenter against the job datacenters, which are glob
+// patterns like "*" or "us-*" in the scheduler
+func matchDatacenter(datacenter string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, datacenter); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTarget reads an interpolated node property like "${meta.pool}", other values are
+// used as they are. ok is false when the node doesn't have the property, and known is
+// false for interpolations this doesn't know how to read, like ${node.region}
+func resolveTarget(node *api.Node, target string) (value string, ok bool, known bool) {
+	if !strings.HasPrefix(target, "${") || !strings.HasSuffix(target, "}") {
+		return target, true, true
+	}
+
+	key := target[2 : len(target)-1]
+	switch {
+	case key == "node.unique.id":
+		return node.ID, true, true
+	case key == "node.unique.name":
+		return node.Name, true, true
+	case key == "node.datacenter":
+		return node.Datacenter, true, true
+	case key == "node.class":
+		return node.NodeClass, node.NodeClass != "", true
+	case strings.HasPrefix(key, "attr."):
+		value, ok := node.Attributes[strings.TrimPrefix(key, "attr.")]
+		return value, ok, true
+	case strings.HasPrefix(key, "meta."):
+		value, ok := node.Meta[strings.TrimPrefix(key, "meta.")]
+		return value, ok, true
+	}
+
+	return "", false, false
+}
+
+func hasConstraint(constraints []*api.Constraint, constraint *api.Constraint) bool {
+	for _, existing := range constraints {
+		if existing.LTarget == constraint.LTarget && existing.Operand == constraint.Operand && existing.RTarget == constraint.RTarget {
+			return true
+		}
+	}
+	return false
+}
+
+func formatConstraint(constraint *api.Constraint) string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s %s", constraint.LTarget, constraint.Operand, constraint.RTarget))
+}
+
+func splitSet(value string) []string {
+	split := strings.Split(value, ",")
+	for i := range split {
+		split[i] = strings.TrimSpace(split[i])
+	}
+	return split
+}
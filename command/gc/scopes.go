@@ -0,0 +1,267 @@
+package gc
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+// Jobs purges the stopped and dead jobs matching the filters that did not change for longer
+// than --older-than
+func Jobs(c *cli.Context, logger *log.Logger) error {
+	client, err := nomad.NewNomadClientFromCLI(c)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := helpers.FilteredJobList(client, helpers.JobFilterFromCLI(c))
+	if err != nil {
+		return err
+	}
+
+	targets, err := stoppedJobs(jobs, func(job *api.JobListStub) (time.Time, error) {
+		return jobStoppedAt(client, job)
+	}, time.Now().Add(-c.Duration("older-than")))
+	if err != nil {
+		return err
+	}
+
+	return remove(c, client, targets, func(t *target) error {
+		_, _, err := client.Jobs().Deregister(t.ID, true, &api.WriteOptions{Namespace: t.Namespace})
+		return err
+	}, logger)
+}
+
+// Allocs garbage collects the terminal allocations of the jobs matching the filters on
+// their clients, once they did not change for longer than --older-than
+func Allocs(c *cli.Context, logger *log.Logger) error {
+	client, err := nomad.NewNomadClientFromCLI(c)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := helpers.FilteredJobList(client, helpers.JobFilterFromCLI(c))
+	if err != nil {
+		return err
+	}
+
+	allocs := make([]*api.AllocationListStub, 0)
+	for _, job := range jobs {
+		jobAllocs, _, err := client.Jobs().Allocations(job.ID, true, &api.QueryOptions{Namespace: job.Namespace})
+		if err != nil {
+			return err
+		}
+
+		allocs = append(allocs, jobAllocs...)
+	}
+
+	targets := terminalAllocs(allocs, time.Now().Add(-c.Duration("older-than")))
+
+	return remove(c, client, targets, func(t *target) error {
+		return client.Allocations().GC(&api.Allocation{ID: t.ID}, &api.QueryOptions{Namespace: t.Namespace})
+	}, logger)
+}
+
+// Evals deletes the terminal evaluations of the jobs matching the filters, once they did
+// not change for longer than --older-than. Nomad only allows this while the eval broker
+// is paused
+func Evals(c *cli.Context, logger *log.Logger) error {
+	client, err := nomad.NewNomadClientFromCLI(c)
+	if err != nil {
+		return err
+	}
+
+	if !c.Bool("dry") {
+		config, _, err := client.Operator().SchedulerGetConfiguration(nil)
+		if err != nil {
+			return err
+		}
+
+		if config.SchedulerConfig == nil || !config.SchedulerConfig.PauseEvalBroker {
+			return fmt.Errorf("Deleting evaluations requires a paused eval broker, pause it with 'nomad operator scheduler set-config -pause-eval-broker=true' and unpause it afterwards")
+		}
+	}
+
+	jobs, err := helpers.FilteredJobList(client, helpers.JobFilterFromCLI(c))
+	if err != nil {
+		return err
+	}
+
+	evals := make([]*api.Evaluation, 0)
+	for _, job := range jobs {
+		jobEvals, _, err := client.Jobs().Evaluations(job.ID, &api.QueryOptions{Namespace: job.Namespace})
+		if err != nil {
+			return err
+		}
+
+		evals = append(evals, jobEvals...)
+	}
+
+	targets := terminalEvals(evals, time.Now().Add(-c.Duration("older-than")))
+
+	return remove(c, client, targets, func(t *target) error {
+		_, err := client.Evaluations().Delete([]string{t.ID}, &api.WriteOptions{Namespace: t.Namespace})
+		return err
+	}, logger)
+}
+
+// Nodes purges the nodes that are down for longer than --older-than
+func Nodes(c *cli.Context, logger *log.Logger) error {
+	client, err := nomad.NewNomadClientFromCLI(c)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := helpers.FilteredClientList(client, false, helpers.ClientFilter{Status: []string{"down"}}, logger)
+	if err != nil {
+		return err
+	}
+
+	targets := downNodes(nodes, time.Now().Add(-c.Duration("older-than")))
+
+	return remove(c, client, targets, func(t *target) error {
+		_, _, err := client.Nodes().Purge(t.ID, nil)
+		return err
+	}, logger)
+}
+
+// stoppedJobs are the stopped or dead jobs that stopped before the cutoff, stoppedAt is
+// only asked for those jobs
+func stoppedJobs(jobs []*api.JobListStub, stoppedAt func(*api.JobListStub) (time.Time, error), cutoff time.Time) ([]*target, error) {
+	targets := make([]*target, 0)
+
+	for _, job := range jobs {
+		if !job.Stop && job.Status != "dead" {
+			continue
+		}
+
+		stopped, err := stoppedAt(job)
+		if err != nil {
+			return nil, err
+		}
+		if stopped.After(cutoff) {
+			continue
+		}
+
+		state := job.Status
+		if job.Stop {
+			state = "stopped"
+		}
+
+		targets = append(targets, &target{Kind: "job", Namespace: job.Namespace, ID: job.ID, Detail: fmt.Sprintf("%s since %s", state, stopped.UTC().Format(time.RFC3339))})
+	}
+
+	return sortTargets(targets), nil
+}
+
+// jobStoppedAt reads the allocations and evaluations of the job to tell when it stopped
+func jobStoppedAt(client *api.Client, job *api.JobListStub) (time.Time, error) {
+	q := &api.QueryOptions{Namespace: job.Namespace}
+
+	allocs, _, err := client.Jobs().Allocations(job.ID, true, q)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	evals, _, err := client.Jobs().Evaluations(job.ID, q)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return lastActivity(job, allocs, evals), nil
+}
+
+// lastActivity is the newest change of the job, its allocations and its evaluations. Stopping
+// a job does not change its submit time, but it does change its allocations and evaluations
+func lastActivity(job *api.JobListStub, allocs []*api.AllocationListStub, evals []*api.Evaluation) time.Time {
+	latest := job.SubmitTime
+	for _, alloc := range allocs {
+		if alloc.ModifyTime > latest {
+			latest = alloc.ModifyTime
+		}
+	}
+	for _, eval := range evals {
+		if eval.ModifyTime > latest {
+			latest = eval.ModifyTime
+		}
+	}
+
+	return time.Unix(0, latest)
+}
+
+// terminalAllocs are the complete, failed or lost allocations last modified before the cutoff
+func terminalAllocs(allocs []*api.AllocationListStub, cutoff time.Time) []*target {
+	targets := make([]*target, 0)
+
+	for _, alloc := range allocs {
+		if alloc.ClientStatus != "complete" && alloc.ClientStatus != "failed" && alloc.ClientStatus != "lost" {
+			continue
+		}
+
+		modified := time.Unix(0, alloc.ModifyTime)
+		if modified.After(cutoff) {
+			continue
+		}
+
+		targets = append(targets, &target{Kind: "alloc", Namespace: alloc.Namespace, ID: alloc.ID, Detail: fmt.Sprintf("%s %s on %s since %s", alloc.JobID, alloc.ClientStatus, alloc.NodeName, modified.UTC().Format(time.RFC3339))})
+	}
+
+	return sortTargets(targets)
+}
+
+// terminalEvals are the complete, failed or canceled evaluations last modified before the cutoff
+func terminalEvals(evals []*api.Evaluation, cutoff time.Time) []*target {
+	targets := make([]*target, 0)
+
+	for _, eval := range evals {
+		if eval.Status != "complete" && eval.Status != "failed" && eval.Status != "canceled" {
+			continue
+		}
+
+		modified := time.Unix(0, eval.ModifyTime)
+		if modified.After(cutoff) {
+			continue
+		}
+
+		targets = append(targets, &target{Kind: "eval", Namespace: eval.Namespace, ID: eval.ID, Detail: fmt.Sprintf("%s %s (triggered by %s) since %s", eval.JobID, eval.Status, eval.TriggeredBy, modified.UTC().Format(time.RFC3339))})
+	}
+
+	return sortTargets(targets)
+}
+
+// downNodes are the down nodes whose status last changed before the cutoff
+func downNodes(nodes []*api.Node, cutoff time.Time) []*target {
+	targets := make([]*target, 0)
+
+	for _, node := range nodes {
+		if node.Status != "down" {
+			continue
+		}
+
+		updated := time.Unix(node.StatusUpdatedAt, 0)
+		if updated.After(cutoff) {
+			continue
+		}
+
+		targets = append(targets, &target{Kind: "node", ID: node.ID, Detail: fmt.Sprintf("%s (%s) down since %s", node.Name, node.NodeClass, updated.UTC().Format(time.RFC3339))})
+	}
+
+	return sortTargets(targets)
+}
+
+func sortTargets(targets []*target) []*target {
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Namespace != targets[j].Namespace {
+			return targets[i].Namespace < targets[j].Namespace
+		}
+		return targets[i].ID < targets[j].ID
+	})
+
+	return targets
+}
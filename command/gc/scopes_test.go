@@ -0,0 +1,109 @@
+package gc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+)
+
+func targetIDs(targets []*target) []string {
+	ids := make([]string, 0, len(targets))
+	for _, t := range targets {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+func TestStoppedJobs(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	cutoff := now.Add(-24 * time.Hour)
+	old := now.Add(-48 * time.Hour).UnixNano()
+	recent := now.Add(-time.Hour).UnixNano()
+
+	jobs := []*api.JobListStub{
+		{ID: "running", Status: "running", SubmitTime: old},
+		{ID: "stopped", Status: "running", Stop: true, SubmitTime: old},
+		{ID: "dead", Status: "dead", SubmitTime: old},
+		{ID: "recently-submitted", Status: "dead", Stop: true, SubmitTime: recent},
+		{ID: "recently-stopped", Status: "dead", Stop: true, SubmitTime: old},
+		{ID: "recently-died", Status: "dead", SubmitTime: old},
+	}
+
+	allocs := map[string][]*api.AllocationListStub{
+		"stopped":          {{ModifyTime: old}},
+		"recently-stopped": {{ModifyTime: old}, {ModifyTime: recent}},
+	}
+	evals := map[string][]*api.Evaluation{
+		"dead":          {{ModifyTime: old}},
+		"recently-died": {{ModifyTime: recent}},
+	}
+
+	asked := make([]string, 0)
+	targets, err := stoppedJobs(jobs, func(job *api.JobListStub) (time.Time, error) {
+		asked = append(asked, job.ID)
+		return lastActivity(job, allocs[job.ID], evals[job.ID]), nil
+	}, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := targetIDs(targets), []string{"dead", "stopped"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if helpers.Contains("running", asked) {
+		t.Errorf("asked when the running job stopped")
+	}
+}
+
+func TestScopes(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	cutoff := now.Add(-24 * time.Hour)
+	old := now.Add(-48 * time.Hour)
+	recent := now.Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		got  []*target
+		want []string
+	}{
+		{
+			name: "allocs",
+			got: terminalAllocs([]*api.AllocationListStub{
+				{ID: "running", ClientStatus: "running", ModifyTime: old.UnixNano()},
+				{ID: "complete", ClientStatus: "complete", ModifyTime: old.UnixNano()},
+				{ID: "lost", ClientStatus: "lost", ModifyTime: old.UnixNano()},
+				{ID: "recently-failed", ClientStatus: "failed", ModifyTime: recent.UnixNano()},
+			}, cutoff),
+			want: []string{"complete", "lost"},
+		},
+		{
+			name: "evals",
+			got: terminalEvals([]*api.Evaluation{
+				{ID: "blocked", Status: "blocked", ModifyTime: old.UnixNano()},
+				{ID: "complete", Status: "complete", ModifyTime: old.UnixNano()},
+				{ID: "recently-canceled", Status: "canceled", ModifyTime: recent.UnixNano()},
+			}, cutoff),
+			want: []string{"complete"},
+		},
+		{
+			name: "nodes",
+			got: downNodes([]*api.Node{
+				{ID: "ready", Status: "ready", StatusUpdatedAt: old.Unix()},
+				{ID: "down", Status: "down", StatusUpdatedAt: old.Unix()},
+				{ID: "recently-down", Status: "down", StatusUpdatedAt: recent.Unix()},
+			}, cutoff),
+			want: []string{"down"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := targetIDs(tt.got); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package gc
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+// target is something a targeted gc removes, like a stopped job or a down node
+type target struct {
+	Kind      string
+	Namespace string
+	ID        string
+	Detail    string
+}
+
+// remove the targets one by one, or only report them in dry mode. Afterwards the job
+// summaries can be reconciled, as purging jobs and allocations can leave them out of date
+func remove(c *cli.Context, client *api.Client, targets []*target, removeTarget func(*target) error, logger *log.Logger) error {
+	dry := c.Bool("dry")
+
+	rows := make([][]string, 0, len(targets))
+	failed := 0
+	for _, t := range targets {
+		result := "would be removed"
+
+		if !dry {
+			if err := removeTarget(t); err != nil {
+				logger.Errorf("Could not remove %s %s: %s", t.Kind, t.ID, err)
+				result = fmt.Sprintf("failed: %s", err)
+				failed++
+			} else {
+				result = "removed"
+			}
+		}
+
+		rows = append(rows, []string{t.Kind, t.Namespace, t.ID, t.Detail, result})
+	}
+
+	res, err := helpers.RowsResponse(c.String("output-format"), []string{"kind", "namespace", "id", "detail", "result"}, rows)
+	if err != nil {
+		return err
+	}
+	fmt.Println(res)
+
+	if dry {
+		logger.Infof("Dry run, %d would be removed", len(targets))
+		return nil
+	}
+
+	logger.Infof("Removed %d of %d", len(targets)-failed, len(targets))
+
+	if c.Bool("reconcile") {
+		logger.Info("Reconciling job summaries")
+		if err := client.System().ReconcileSummaries(); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("Could not remove %d of %d", failed, len(targets))
+	}
+
+	return nil
+}
@@ -1,26 +1,127 @@
 package job
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
 )
 
-func Hunt() error {
-	// create Nomad API client
-	nomadClient, err := api.NewClient(api.DefaultConfig())
+func Hunt(c *cli.Context) error {
+	clusters, err := nomad.ClustersFromCLI(c.Parent())
 	if err != nil {
 		return err
 	}
 
+	clusters, err = nomad.RegionsFromCLI(c.Parent(), clusters)
+	if err != nil {
+		return err
+	}
+
+	// No clusters or regions selected, hunt in the cluster from the NOMAD_* environment
+	if len(clusters) == 0 {
+		nomadClient, err := nomad.NewNomadClientFromCLI(c)
+		if err != nil {
+			return err
+		}
+
+		return hunt(nomadClient, os.Stdout, nil)
+	}
+
+	// Hunt in all clusters and regions in parallel, but print the output per cluster and region
+	outputs := make([]bytes.Buffer, len(clusters))
+	errs := make([]error, len(clusters))
+
+	var wg sync.WaitGroup
+	for i, cluster := range clusters {
+		wg.Add(1)
+
+		go func(i int, cluster *nomad.Cluster) {
+			defer wg.Done()
+
+			nomadClient, err := cluster.NewClient()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			errs[i] = hunt(nomadClient, &outputs[i], cluster)
+		}(i, cluster)
+	}
+	wg.Wait()
+
+	for i := range clusters {
+		fmt.Print(outputs[i].String())
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("cluster %s: %s", clusters[i].Label(), err)
+		}
+	}
+
+	return nil
+}
+
+func hunt(nomadClient *api.Client, writer io.Writer, cluster *nomad.Cluster) error {
+	drifts, err := findDrift(nomadClient)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range drifts {
+		shame(writer, cluster, d.jobID, d.allocations)
+	}
+
+	return nil
+}
+
+// HuntWeb lists the allocations of the jobs with version drift, with the fields from the request path
+func HuntWeb(logger *log.Logger, r *http.Request) (string, error) {
+	fields := webFields(r, huntDefaultFields)
+
+	nomadClient, err := nomad.NewNomadClientFromContext(r.Context())
+	if err != nil {
+		return "", err
+	}
+
+	drifts, err := findDrift(nomadClient)
+	if err != nil {
+		return "", err
+	}
+
+	var allocs []*api.AllocationListStub
+	for _, d := range drifts {
+		allocs = append(allocs, d.allocations...)
+	}
+
+	return allocationsResponse(webFormat(r), allocs, helpers.NewAllocPropReader(fields...))
+}
+
+// drift is a service job with running allocations of different job versions
+type drift struct {
+	jobID       string
+	allocations []*api.AllocationListStub
+}
+
+func findDrift(nomadClient *api.Client) ([]*drift, error) {
 	// Get the jobs
 	jobs, _, err := nomadClient.Jobs().List(nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	var drifts []*drift
 	var firstRunningJobVersion uint64 = 0
 	for _, job := range jobs {
 		if job.Type != "service" {
@@ -30,7 +131,7 @@ func Hunt() error {
 		// Get job's running allocations
 		jobAllocations, _, err := nomadClient.Jobs().Allocations(job.ID, true, nil)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		firstRunningJobVersion = 0
@@ -45,21 +146,34 @@ func Hunt() error {
 			}
 
 			if allocation.JobVersion != firstRunningJobVersion {
-				shame(job.ID, jobAllocations)
+				drifts = append(drifts, &drift{jobID: job.ID, allocations: jobAllocations})
 				break
 			}
 		}
 	}
 
-	return nil
+	return drifts, nil
 }
 
-func shame(jobID string, jobAllocations []*api.AllocationListStub) {
-	fmt.Println(jobID)
+func shame(writer io.Writer, cluster *nomad.Cluster, jobID string, jobAllocations []*api.AllocationListStub) {
+	origin := make([]string, 0, 2)
+	if cluster != nil && cluster.Name != "" {
+		origin = append(origin, "cluster: "+cluster.Name)
+	}
+	if cluster != nil && cluster.Region != "" {
+		origin = append(origin, "region: "+cluster.Region)
+	}
+
+	if len(origin) > 0 {
+		fmt.Fprintf(writer, "%s (%s)\n", jobID, strings.Join(origin, ", "))
+	} else {
+		fmt.Fprintln(writer, jobID)
+	}
+
 	for _, allocation := range jobAllocations {
-		fmt.Printf("%s | Version %v | Desired %s | Actual %s - %s | Create Time: %s\n", strings.Split(allocation.ID, "-")[0], allocation.JobVersion, allocation.DesiredStatus, allocation.ClientStatus, allocation.ClientDescription, prettyTimeDiff(time.Unix(0, allocation.CreateTime), time.Now()))
+		fmt.Fprintf(writer, "%s | Version %v | Desired %s | Actual %s - %s | Create Time: %s\n", strings.Split(allocation.ID, "-")[0], allocation.JobVersion, allocation.DesiredStatus, allocation.ClientStatus, allocation.ClientDescription, prettyTimeDiff(time.Unix(0, allocation.CreateTime), time.Now()))
 	}
-	fmt.Println()
+	fmt.Fprintln(writer)
 }
 
 // prettyTimeDiff prints a human readable time difference.
@@ -0,0 +1,69 @@
+package job
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+func ListCLI(c *cli.Context, logger *log.Logger) error {
+	fields := listDefaultFields
+	if input := getCLIArgs(c); len(input) > 0 {
+		fields = input
+	}
+
+	return jobsCLI(c, helpers.NewJobPropReader(fields...), helpers.RowsResponse)
+}
+
+func BreakdownCLI(c *cli.Context, logger *log.Logger) error {
+	dimensions := getCLIArgs(c)
+	if len(dimensions) == 0 {
+		return fmt.Errorf("Missing argument for list of fields to use as dimensions")
+	}
+
+	return jobsCLI(c, helpers.NewJobPropReader(dimensions...), helpers.BreakdownResponse)
+}
+
+// jobsCLI reads the filtered jobs and prints them with render, in the requested output format
+func jobsCLI(c *cli.Context, propReader helpers.JobReader, render func(format string, keys []string, rows [][]string) (string, error)) error {
+	nomadClient, err := nomad.NewNomadClientFromCLI(c)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := helpers.FilteredJobList(nomadClient, helpers.JobFilterFromCLI(c))
+	if err != nil {
+		return err
+	}
+
+	rows, err := readJobRows(jobs, propReader.WithJobs(nomadClient))
+	if err != nil {
+		return err
+	}
+
+	res, err := render(c.String("output-format"), propReader.GetKeys(), rows)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(res)
+	return nil
+}
+
+func readJobRows(jobs []*api.JobListStub, propReader helpers.JobReader) ([][]string, error) {
+	rows := make([][]string, 0, len(jobs))
+	for _, job := range jobs {
+		row, err := propReader.Read(job)
+		if err != nil {
+			return nil, err
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,67 @@
+package job
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListWeb lists the jobs with the fields from the request path. Jobs can be filtered with
+// the filter-prefix, filter-type, filter-status, filter-datacenter and filter-meta query arguments
+func ListWeb(logger *log.Logger, r *http.Request) (string, error) {
+	fields := webFields(r, listDefaultFields)
+
+	nomadClient, err := nomad.NewNomadClientFromContext(r.Context())
+	if err != nil {
+		return "", err
+	}
+
+	jobs, err := helpers.FilteredJobList(nomadClient, helpers.JobFilterFromWeb(r))
+	if err != nil {
+		return "", err
+	}
+
+	propReader := helpers.NewJobPropReader(fields...).WithJobs(nomadClient)
+
+	rows, err := readJobRows(jobs, propReader)
+	if err != nil {
+		return "", err
+	}
+
+	return helpers.RowsResponse(webFormat(r), propReader.GetKeys(), rows)
+}
+
+// AllocationsWeb lists the allocations of the job with the fields from the request path.
+// Only allocations of the current job version are included, unless "all=true" is set
+func AllocationsWeb(logger *log.Logger, r *http.Request, jobID string) (string, error) {
+	fields := webFields(r, allocDefaultFields)
+
+	nomadClient, err := nomad.NewNomadClientFromContext(r.Context())
+	if err != nil {
+		return "", err
+	}
+
+	allocs, _, err := nomadClient.Jobs().Allocations(jobID, r.URL.Query().Get("all") == "true", nil)
+	if err != nil {
+		return "", err
+	}
+
+	return allocationsResponse(webFormat(r), allocs, helpers.NewAllocPropReader(fields...))
+}
+
+func allocationsResponse(format string, allocs []*api.AllocationListStub, propReader helpers.AllocReader) (string, error) {
+	rows := make([][]string, 0, len(allocs))
+	for _, alloc := range allocs {
+		row, err := propReader.Read(alloc)
+		if err != nil {
+			return "", err
+		}
+
+		rows = append(rows, row)
+	}
+
+	return helpers.RowsResponse(format, propReader.GetKeys(), rows)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/hashicorp/nomad/api"
 	"github.com/hashicorp/nomad/scheduler"
 	"github.com/mitchellh/colorstring"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
@@ -32,12 +33,13 @@ func Move(c *cli.Context, logger *log.Logger) error {
 
 	newConstraint := api.NewConstraint(fmt.Sprintf("${%s}", c.String("constraint")), c.String("operand"), c.String("value"))
 
-	// create Nomad API client
-	nomadClient, err := api.NewClient(api.DefaultConfig())
-	if err != nil {
-		return err
-	}
+	return nomad.InRegions(c, logger, func(nomadClient *api.Client, _ string) error {
+		return moveJobs(c, logger, nomadClient, jobName, newConstraint)
+	})
+}
 
+// moveJobs changes the constraint of the job, or the jobs with the prefix, in a single region
+func moveJobs(c *cli.Context, logger *log.Logger, nomadClient *api.Client, jobName string, newConstraint *api.Constraint) error {
 	jobsToMove := []string{jobName}
 
 	// if we stop by prefix, then query for all the jobs
@@ -51,7 +53,7 @@ func Move(c *cli.Context, logger *log.Logger) error {
 
 		for _, job := range jobs {
 			if excludeFilter := c.String("exclude"); excludeFilter != "" && strings.Contains(job.Name, excludeFilter) {
-				log.Infof("Excluding job %s because it's name matched the exclude filter", job.Name)
+				logger.Infof("Excluding job %s because it's name matched the exclude filter", job.Name)
 				continue
 			}
 			jobsToMove = append(jobsToMove, job.ID)
@@ -71,11 +73,11 @@ func Move(c *cli.Context, logger *log.Logger) error {
 			defer wg.Done()
 			job, _, err := nomadClient.Jobs().Info(name, nil)
 			if err != nil {
-				log.Error(err)
+				logger.Error(err)
 				return
 			}
 			if *job.Stop {
-				log.Infof("Skipping job %s because it's stopped", *job.Name)
+				logger.Infof("Skipping job %s because it's stopped", *job.Name)
 				return
 			}
 			existingConstraintAppended := false
@@ -90,7 +92,7 @@ func Move(c *cli.Context, logger *log.Logger) error {
 			}
 			planResponse, _, err := nomadClient.Jobs().Plan(job, true, nil)
 			if err != nil {
-				log.Error(err)
+				logger.Error(err)
 				return
 			}
 
@@ -100,7 +102,7 @@ func Move(c *cli.Context, logger *log.Logger) error {
 				Disable: false,
 				Reset:   true,
 			}
-			log.Infof(colorize.Color(fmt.Sprintf("%s\n",
+			logger.Infof(colorize.Color(fmt.Sprintf("%s\n",
 				strings.TrimSpace(formatJobDiff(planResponse.Diff, false)))))
 
 			if c.Bool("dry") {
@@ -109,10 +111,10 @@ func Move(c *cli.Context, logger *log.Logger) error {
 			}
 			_, _, err = nomadClient.Jobs().Register(job, nil)
 			if err != nil {
-				log.Errorf("failed to update job %s: %s", name, err)
+				logger.Errorf("failed to update job %s: %s", name, err)
 				return
 			}
-			log.Infof("Job %s was successfully moved!", name)
+			logger.Infof("Job %s was successfully moved!", name)
 		}(jobName)
 	}
 
@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
@@ -15,12 +16,13 @@ func Stop(c *cli.Context, logger *log.Logger) error {
 		return fmt.Errorf("Must provide a job name or prefix")
 	}
 
-	// create Nomad API client
-	nomadClient, err := api.NewClient(api.DefaultConfig())
-	if err != nil {
-		return err
-	}
+	return nomad.InRegions(c, logger, func(nomadClient *api.Client, _ string) error {
+		return stopJobs(c, logger, nomadClient, jobName)
+	})
+}
 
+// stopJobs stops the job, or the jobs with the prefix, in a single region
+func stopJobs(c *cli.Context, logger *log.Logger, nomadClient *api.Client, jobName string) error {
 	jobsToStop := []string{jobName}
 
 	// if we stop by prefix, then query for all the jobs
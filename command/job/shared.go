@@ -0,0 +1,44 @@
+package job
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/seatgeek/nomad-helper/helpers"
+	cli "github.com/urfave/cli"
+)
+
+var (
+	listDefaultFields  = []string{"id", "type", "priority", "status", "running"}
+	allocDefaultFields = []string{"id", "group", "version", "node", "desired", "status", "created"}
+	huntDefaultFields  = []string{"job", "id", "version", "desired", "status", "description", "created"}
+)
+
+// webFields reads the fields from the request path, like "node list" does
+func webFields(r *http.Request, defaults []string) []string {
+	fields := helpers.DeleteEmpty(strings.Split(r.URL.Path, "/"))
+	if len(fields) == 0 {
+		return defaults
+	}
+
+	return fields
+}
+
+// getCLIArgs reads the fields from the arguments, either space or comma separated
+func getCLIArgs(c *cli.Context) []string {
+	fields := make([]string, 0)
+	for _, arg := range c.Args() {
+		fields = append(fields, helpers.DeleteEmpty(strings.Split(arg, ","))...)
+	}
+
+	return fields
+}
+
+func webFormat(r *http.Request) string {
+	format := r.URL.Query().Get("output-format")
+	if format == "" {
+		format = "table"
+	}
+
+	return format
+}
@@ -0,0 +1,202 @@
+package job
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/olekukonko/tablewriter"
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+// groupSpread is how the running allocations of a task group are spread over the nodes
+type groupSpread struct {
+	Job      string         `json:"job"`
+	Group    string         `json:"group"`
+	Running  int            `json:"running"`
+	Spread   map[string]int `json:"spread"`
+	Hosts    int            `json:"hosts"`
+	Problems []string       `json:"problems"`
+}
+
+// Spread shows how the running allocations of every service task group are spread over a
+// node field, and flags the groups that run in a single zone or on a single host
+func Spread(c *cli.Context, logger *log.Logger) error {
+	by := c.String("by")
+	if _, err := helpers.NewMetaPropReader(by).Read(&api.Node{}); err != nil {
+		return err
+	}
+
+	filter := helpers.JobFilterFromCLI(c)
+	if filter.Type == "" {
+		filter.Type = "service"
+	}
+
+	nomadClient, err := nomad.NewNomadClientFromCLI(c)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := helpers.FilteredJobList(nomadClient, filter)
+	if err != nil {
+		return err
+	}
+
+	jobIDs := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		jobIDs[job.Namespace+"/"+job.ID] = true
+	}
+
+	logger.Infof("Reading allocations of %d jobs", len(jobs))
+	allocs, _, err := nomadClient.Allocations().List(&api.QueryOptions{Namespace: filter.Namespace})
+	if err != nil {
+		return err
+	}
+
+	running := make([]*api.AllocationListStub, 0)
+	for _, alloc := range allocs {
+		if alloc.ClientStatus == "running" && jobIDs[alloc.Namespace+"/"+alloc.JobID] {
+			running = append(running, alloc)
+		}
+	}
+
+	reader := helpers.NewAllocPropReader("node." + by).WithNodes(nomadClient)
+	spreads, err := computeSpread(running, by, func(alloc *api.AllocationListStub) (string, error) {
+		value, err := reader.Read(alloc)
+		if err != nil {
+			return "", err
+		}
+
+		return value[0], nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("only-problems") {
+		problems := make([]*groupSpread, 0)
+		for _, spread := range spreads {
+			if len(spread.Problems) > 0 {
+				problems = append(problems, spread)
+			}
+		}
+		spreads = problems
+	}
+
+	res, err := spreadResponse(c.String("output-format"), by, spreads)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(res)
+	return nil
+}
+
+// computeSpread groups the allocations by job and task group, and counts them per value
+// of the node field read by nodeValue
+func computeSpread(allocs []*api.AllocationListStub, by string, nodeValue func(alloc *api.AllocationListStub) (string, error)) ([]*groupSpread, error) {
+	groups := make(map[string]*groupSpread)
+	hosts := make(map[string]map[string]bool)
+
+	for _, alloc := range allocs {
+		key := alloc.Namespace + "/" + alloc.JobID + "/" + alloc.TaskGroup
+
+		spread, ok := groups[key]
+		if !ok {
+			spread = &groupSpread{Job: alloc.JobID, Group: alloc.TaskGroup, Spread: make(map[string]int), Problems: make([]string, 0)}
+			groups[key] = spread
+			hosts[key] = make(map[string]bool)
+		}
+
+		value, err := nodeValue(alloc)
+		if err != nil {
+			return nil, err
+		}
+
+		spread.Running++
+		spread.Spread[value]++
+		hosts[key][alloc.NodeID] = true
+	}
+
+	result := make([]*groupSpread, 0, len(groups))
+	for key, spread := range groups {
+		spread.Hosts = len(hosts[key])
+
+		// a single allocation can't be spread
+		if spread.Running > 1 {
+			if len(spread.Spread) == 1 {
+				spread.Problems = append(spread.Problems, fmt.Sprintf("all allocations in one %s", by))
+			}
+
+			if spread.Hosts == 1 {
+				spread.Problems = append(spread.Problems, "all allocations on one host")
+			}
+		}
+
+		result = append(result, spread)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Job != result[j].Job {
+			return result[i].Job < result[j].Job
+		}
+		return result[i].Group < result[j].Group
+	})
+
+	return result, nil
+}
+
+func spreadResponse(format, by string, spreads []*groupSpread) (string, error) {
+	switch format {
+	case "table":
+		var b bytes.Buffer
+		writer := bufio.NewWriter(&b)
+
+		table := tablewriter.NewWriter(writer)
+		table.SetAutoMergeCells(false)
+		table.SetRowLine(true)
+		table.SetHeader([]string{"job", "group", "running", by, "hosts", "problems"})
+
+		for _, spread := range spreads {
+			table.Append([]string{
+				spread.Job,
+				spread.Group,
+				fmt.Sprintf("%d", spread.Running),
+				formatSpread(spread.Spread),
+				fmt.Sprintf("%d", spread.Hosts),
+				strings.Join(spread.Problems, ", "),
+			})
+		}
+
+		table.Render()
+		writer.Flush()
+		return b.String(), nil
+
+	case "json", "json-pretty":
+		return helpers.MarshalJSON(format, spreads)
+
+	default:
+		return "", helpers.InvalidInputf("Invalid output-format: %s", format)
+	}
+}
+
+// formatSpread formats the allocation counts per value, like "us-east-1a=2, us-east-1b=1"
+func formatSpread(spread map[string]int) string {
+	values := make([]string, 0, len(spread))
+	for value := range spread {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	for i, value := range values {
+		values[i] = fmt.Sprintf("%s=%d", value, spread[value])
+	}
+
+	return strings.Join(values, ", ")
+}
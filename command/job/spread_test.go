@@ -0,0 +1,42 @@
+package job
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestComputeSpread(t *testing.T) {
+	zones := map[string]string{"n1": "a", "n2": "a", "n3": "b"}
+	allocs := []*api.AllocationListStub{
+		{JobID: "web", TaskGroup: "app", NodeID: "n1"},
+		{JobID: "web", TaskGroup: "app", NodeID: "n3"},
+		{JobID: "api", TaskGroup: "api", NodeID: "n1"},
+		{JobID: "api", TaskGroup: "api", NodeID: "n2"},
+		{JobID: "cache", TaskGroup: "redis", NodeID: "n2"},
+		{JobID: "cache", TaskGroup: "redis", NodeID: "n2"},
+		{JobID: "cron", TaskGroup: "run", NodeID: "n1"},
+	}
+
+	got, err := computeSpread(allocs, "zone", func(alloc *api.AllocationListStub) (string, error) {
+		return zones[alloc.NodeID], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*groupSpread{
+		{Job: "api", Group: "api", Running: 2, Spread: map[string]int{"a": 2}, Hosts: 2, Problems: []string{"all allocations in one zone"}},
+		{Job: "cache", Group: "redis", Running: 2, Spread: map[string]int{"a": 2}, Hosts: 1, Problems: []string{"all allocations in one zone", "all allocations on one host"}},
+		{Job: "cron", Group: "run", Running: 1, Spread: map[string]int{"a": 1}, Hosts: 1, Problems: []string{}},
+		{Job: "web", Group: "app", Running: 2, Spread: map[string]int{"a": 1, "b": 1}, Hosts: 2, Problems: []string{}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		for _, g := range got {
+			t.Logf("%+v", g)
+		}
+		t.Errorf("unexpected spread")
+	}
+}
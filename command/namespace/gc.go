@@ -1,15 +1,47 @@
 package namespace
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli"
 )
 
+// namespaceState is what namespace gc found in a namespace, across all regions
+type namespaceState struct {
+	namespace   *api.Namespace
+	ignoredJobs map[string][]*api.JobListStub // by region, deleted with the namespace
+	jobs        int                           // jobs that are not ignored
+	variables   int
+	// the variables could not be listed, so the namespace may not be empty
+	variablesUnknown bool
+	lastActivity     time.Time
+}
+
+// gcPolicy decides which namespaces may be deleted
+type gcPolicy struct {
+	minAge         time.Duration
+	protect        []*regexp.Regexp
+	protectMetaKey string
+	now            time.Time
+}
+
 func GC(c *cli.Context, logger *log.Logger) error {
-	nomadClient, err := api.NewClient(api.DefaultConfig())
+	policy, err := gcPolicyFromCLI(c)
+	if err != nil {
+		return err
+	}
+
+	nomadClient, err := nomad.NewNomadClientFromCLI(c)
 	if err != nil {
 		return err
 	}
@@ -19,95 +51,246 @@ func GC(c *cli.Context, logger *log.Logger) error {
 		return err
 	}
 
-	var deletableNamespaces []*api.Namespace
 	namespaces, _, err := nomadClient.Namespaces().List(nil)
-	for _, namespace := range namespaces {
-		var jobs []*api.JobListStub
-		for _, region := range regions {
-			regionJobs, _, err := nomadClient.Jobs().List(&api.QueryOptions{
-				Region:    region,
-				Namespace: namespace.Name,
-			})
-			if err != nil {
-				return err
-			}
+	if err != nil {
+		return err
+	}
 
-			for _, job := range regionJobs {
-				if inStringSlice(job.ID, c.StringSlice("ignore-job")) {
-					log.Infof("Ignoring job '%s' in region/namespace '%s/%s'", job.ID, region, namespace.Name)
-					continue
-				}
-				jobs = append(jobs, job)
-			}
+	var deletable []*namespaceState
+	rows := make([][]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		state, err := readNamespaceState(nomadClient, namespace, regions, c.StringSlice("ignore-job"), logger)
+		if err != nil {
+			return err
 		}
 
-		if len(jobs) == 0 {
-			deletableNamespaces = append(deletableNamespaces, namespace)
+		decision := "delete"
+		if reason := policy.keepReason(state); reason != "" {
+			decision = "keep: " + reason
+			logger.Infof("Cannot delete namespace %s, %s", namespace.Name, reason)
 		} else {
-			log.Infof("Cannot delete namespace %s, %d jobs in namespace", namespace.Name, len(jobs))
+			deletable = append(deletable, state)
+		}
+
+		lastActivity := "-"
+		if !state.lastActivity.IsZero() {
+			lastActivity = state.lastActivity.UTC().Format(time.RFC3339)
 		}
+
+		quota := namespace.Quota
+		if quota == "" {
+			quota = "-"
+		}
+
+		variables := fmt.Sprintf("%d", state.variables)
+		if state.variablesUnknown {
+			variables = "-"
+		}
+
+		rows = append(rows, []string{namespace.Name, fmt.Sprintf("%d", state.jobs), fmt.Sprintf("%d", countJobs(state.ignoredJobs)), variables, quota, lastActivity, decision})
 	}
 
-	for _, namespace := range deletableNamespaces {
-		for _, region := range regions {
-			jobs, _, err := nomadClient.Jobs().List(&api.QueryOptions{
-				Region:    region,
-				Namespace: namespace.Name,
-			})
-			if err != nil {
-				return err
-			}
+	res, err := helpers.RowsResponse(c.String("output-format"), []string{"namespace", "jobs", "ignored_jobs", "variables", "quota", "last_activity", "decision"}, rows)
+	if err != nil {
+		return err
+	}
+	fmt.Println(res)
 
-			if len(jobs) == 0 {
-				continue
-			}
+	if len(deletable) == 0 {
+		logger.Info("Found no namespaces to delete")
+		return nil
+	}
 
-			if c.Bool("dry") {
-				logger.Infof("Skipping deletion of %d jobs in region/namespace %s/%s because dry flag was provided", len(jobs), region, namespace.Name)
-				continue
-			}
+	if c.Bool("dry") {
+		for _, state := range deletable {
+			logger.Infof("Skipping deletion of namespace %s and its %d ignored jobs because dry flag was provided", state.namespace.Name, countJobs(state.ignoredJobs))
+		}
+		return nil
+	}
+
+	if limit := c.Int("confirm-over"); len(deletable) > limit && !c.Bool("yes") {
+		ok, err := confirm(os.Stdin, os.Stderr, fmt.Sprintf("About to delete %d namespaces, more than --confirm-over %d. Continue?", len(deletable), limit))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("Aborted, no namespaces were deleted")
+		}
+	}
 
+	for _, state := range deletable {
+		for region, jobs := range state.ignoredJobs {
 			for _, job := range jobs {
 				// Ideally we also track the evalID state but we'd need to duplicate
 				// all the monitor logic from the nomad codebase as it's not exposed
 				_, _, err := nomadClient.Jobs().Deregister(job.ID, true, &api.WriteOptions{
 					Region:    region,
-					Namespace: namespace.Name,
+					Namespace: state.namespace.Name,
 				})
 				if err != nil {
-					return fmt.Errorf("error deleting job '%s' in region/namespace '%s/%s': %w", job.ID, region, namespace.Name, err)
+					return fmt.Errorf("error deleting job '%s' in region/namespace '%s/%s': %w", job.ID, region, state.namespace.Name, err)
 				}
-				logger.Infof("Job '%s' in region/namespace '%s/%s' successfully deleted", job.ID, region, namespace.Name)
+				logger.Infof("Job '%s' in region/namespace '%s/%s' successfully deleted", job.ID, region, state.namespace.Name)
 			}
 		}
 	}
 
-	if !c.Bool("dry") {
-		logger.Infof("executing garbage collection")
-		if err := nomadClient.System().GarbageCollect(); err != nil {
-			return fmt.Errorf("error running garbage collection: %w", err)
+	logger.Infof("executing garbage collection")
+	if err := nomadClient.System().GarbageCollect(); err != nil {
+		return fmt.Errorf("error running garbage collection: %w", err)
+	}
+
+	logger.Infof("executing summary reconciliation")
+	if err := nomadClient.System().ReconcileSummaries(); err != nil {
+		return fmt.Errorf("error reconciling summaries: %w", err)
+	}
+
+	for _, state := range deletable {
+		if _, err = nomadClient.Namespaces().Delete(state.namespace.Name, nil); err != nil {
+			return fmt.Errorf("error deleting namespace: %w", err)
 		}
 
-		logger.Infof("executing summary reconciliation")
-		if err := nomadClient.System().ReconcileSummaries(); err != nil {
-			return fmt.Errorf("error reconciling summaries: %w", err)
+		log.Infof("Namespace %s was successfully deleted!", state.namespace.Name)
+	}
+
+	return nil
+}
+
+func gcPolicyFromCLI(c *cli.Context) (*gcPolicy, error) {
+	policy := &gcPolicy{
+		minAge:         c.Duration("min-age"),
+		protectMetaKey: c.String("protect-meta-key"),
+		now:            time.Now(),
+	}
+
+	for _, expr := range helpers.DeleteEmpty(c.StringSlice("protect")) {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid --protect expression '%s': %w", expr, err)
 		}
+
+		policy.protect = append(policy.protect, re)
 	}
 
-	for _, namespace := range deletableNamespaces {
-		if c.Bool("dry") {
-			logger.Infof("Skipping deletion of namespace %s because dry flag was provided", namespace.Name)
+	return policy, nil
+}
+
+// readNamespaceState lists the jobs and variables of the namespace in every region
+func readNamespaceState(client *api.Client, namespace *api.Namespace, regions, ignoreJobs []string, logger *log.Logger) (*namespaceState, error) {
+	state := &namespaceState{namespace: namespace, ignoredJobs: make(map[string][]*api.JobListStub)}
+
+	for _, region := range regions {
+		regionJobs, _, err := client.Jobs().List(&api.QueryOptions{
+			Region:    region,
+			Namespace: namespace.Name,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, job := range regionJobs {
+			if submitted := time.Unix(0, job.SubmitTime); submitted.After(state.lastActivity) {
+				state.lastActivity = submitted
+			}
+
+			if inStringSlice(job.ID, ignoreJobs) {
+				logger.Infof("Ignoring job '%s' in region/namespace '%s/%s'", job.ID, region, namespace.Name)
+				state.ignoredJobs[region] = append(state.ignoredJobs[region], job)
+				continue
+			}
+
+			state.jobs++
+		}
+
+		// variables were added in Nomad 1.4, older servers answer with a 404 and don't have any
+		variables, _, err := client.Variables().List(&api.QueryOptions{
+			Region:    region,
+			Namespace: namespace.Name,
+		})
+		if err != nil && strings.Contains(err.Error(), "404") {
+			continue
+		}
+		if err != nil {
+			logger.Warnf("Could not list variables in region/namespace '%s/%s': %s", region, namespace.Name, err)
+			state.variablesUnknown = true
 			continue
 		}
 
-		if _, err = nomadClient.Namespaces().Delete(namespace.Name, nil); err != nil {
-			return fmt.Errorf("error deleting namespace: %w", err)
+		for _, variable := range variables {
+			if modified := time.Unix(0, variable.ModifyTime); modified.After(state.lastActivity) {
+				state.lastActivity = modified
+			}
 		}
+		state.variables += len(variables)
+	}
+
+	return state, nil
+}
+
+// keepReason tells why the namespace must not be deleted, or is empty when it can be
+func (p *gcPolicy) keepReason(state *namespaceState) string {
+	name := state.namespace.Name
 
-		log.Infof("Namespace %s was successfully deleted!", namespace.Name)
+	// Nomad refuses to delete the default namespace
+	if name == api.DefaultNamespace {
+		return "the default namespace is always protected"
 	}
 
-	return nil
+	for _, re := range p.protect {
+		if re.MatchString(name) {
+			return fmt.Sprintf("protected by --protect %s", re)
+		}
+	}
+
+	if p.protectMetaKey != "" && strings.EqualFold(state.namespace.Meta[p.protectMetaKey], "true") {
+		return fmt.Sprintf("protected by namespace meta %s", p.protectMetaKey)
+	}
+
+	if state.jobs > 0 {
+		return fmt.Sprintf("%d jobs in namespace", state.jobs)
+	}
+
+	if state.variables > 0 {
+		return fmt.Sprintf("%d variables in namespace", state.variables)
+	}
+
+	if state.variablesUnknown {
+		return "could not list variables"
+	}
+
+	if p.minAge > 0 {
+		// namespaces have no creation time, the newest job or variable is the best guess
+		if state.lastActivity.IsZero() {
+			return "no jobs or variables to tell the age by, required by --min-age"
+		}
+
+		if idle := p.now.Sub(state.lastActivity); idle < p.minAge {
+			return fmt.Sprintf("last activity %s ago, less than --min-age %s", idle.Round(time.Minute), p.minAge)
+		}
+	}
+
+	return ""
+}
+
+// confirm asks a yes/no question, anything but "y" or "yes" is a no
+func confirm(in io.Reader, out io.Writer, question string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func countJobs(jobs map[string][]*api.JobListStub) int {
+	count := 0
+	for _, regionJobs := range jobs {
+		count += len(regionJobs)
+	}
+	return count
 }
 
 func inStringSlice(s string, ss []string) bool {
@@ -0,0 +1,107 @@
+package namespace
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestKeepReason(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	policy := &gcPolicy{
+		minAge:         7 * 24 * time.Hour,
+		protect:        []*regexp.Regexp{regexp.MustCompile("^infra-")},
+		protectMetaKey: "protected",
+		now:            now,
+	}
+
+	tests := []struct {
+		name  string
+		state *namespaceState
+		want  string
+	}{
+		{"default", &namespaceState{namespace: &api.Namespace{Name: "default"}, lastActivity: now.Add(-30 * 24 * time.Hour)}, "the default namespace is always protected"},
+		{"protect expression", &namespaceState{namespace: &api.Namespace{Name: "infra-logs"}, lastActivity: now.Add(-30 * 24 * time.Hour)}, "protected by --protect ^infra-"},
+		{"protect meta", &namespaceState{namespace: &api.Namespace{Name: "team-a", Meta: map[string]string{"protected": "True"}}, lastActivity: now.Add(-30 * 24 * time.Hour)}, "protected by namespace meta protected"},
+		{"jobs", &namespaceState{namespace: &api.Namespace{Name: "team-a"}, jobs: 2}, "2 jobs in namespace"},
+		{"variables", &namespaceState{namespace: &api.Namespace{Name: "team-a"}, variables: 1}, "1 variables in namespace"},
+		{"unknown variables", &namespaceState{namespace: &api.Namespace{Name: "team-a"}, variablesUnknown: true, lastActivity: now.Add(-30 * 24 * time.Hour)}, "could not list variables"},
+		{"unknown age", &namespaceState{namespace: &api.Namespace{Name: "team-a"}}, "no jobs or variables to tell the age by, required by --min-age"},
+		{"too young", &namespaceState{namespace: &api.Namespace{Name: "team-a"}, lastActivity: now.Add(-time.Hour)}, "last activity 1h0m0s ago, less than --min-age 168h0m0s"},
+		{"deletable", &namespaceState{namespace: &api.Namespace{Name: "team-a"}, lastActivity: now.Add(-30 * 24 * time.Hour)}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.keepReason(tt.state); got != tt.want {
+				t.Errorf("keepReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadNamespaceStateVariables(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		wantUnknown bool
+	}{
+		{name: "listed", status: http.StatusOK},
+		{name: "server without variables", status: http.StatusNotFound},
+		{name: "permission denied", status: http.StatusForbidden, wantUnknown: true},
+		{name: "server error", status: http.StatusInternalServerError, wantUnknown: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/v1/vars" && tt.status != http.StatusOK {
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.Write([]byte("[]"))
+			}))
+			defer server.Close()
+
+			client, err := api.NewClient(&api.Config{Address: server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logger := log.New()
+			logger.SetOutput(io.Discard)
+
+			state, err := readNamespaceState(client, &api.Namespace{Name: "team-a"}, []string{"global"}, nil, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.variablesUnknown != tt.wantUnknown {
+				t.Errorf("got variables unknown %t, want %t", state.variablesUnknown, tt.wantUnknown)
+			}
+		})
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	for input, want := range map[string]bool{"y\n": true, "YES\n": true, "n\n": false, "\n": false, "": false} {
+		var out bytes.Buffer
+		got, err := confirm(strings.NewReader(input), &out, "Delete?")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("confirm(%q) = %t, want %t", input, got, want)
+		}
+		if out.String() != "Delete? [y/N] " {
+			t.Errorf("unexpected prompt %q", out.String())
+		}
+	}
+}
@@ -3,7 +3,9 @@ package node
 import (
 	"fmt"
 
+	"github.com/hashicorp/nomad/api"
 	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli"
 )
@@ -19,8 +21,12 @@ func BreakdownCLI(c *cli.Context, logger *log.Logger) error {
 
 	filters := helpers.ClientFilterFromCLI(c.Parent())
 
-	// Collect Node data from the Nomad cluster
-	nodes, err := getData(filters, logger, !c.BoolT("no-progress"))
+	clusters, err := nomad.ClustersFromCLI(c.Parent())
+	if err != nil {
+		return err
+	}
+
+	clusters, err = nomad.RegionsFromCLI(c.Parent(), clusters)
 	if err != nil {
 		return err
 	}
@@ -28,6 +34,23 @@ func BreakdownCLI(c *cli.Context, logger *log.Logger) error {
 	// Create a prop reader for results
 	propReader := helpers.NewMetaPropReader(dimensions...)
 
+	var nodes []*api.Node
+	if len(clusters) > 0 {
+		// Collect Node data from all the selected clusters, with the cluster as the first dimension
+		data, err := getClustersData(clusters, filters, logger, nil)
+		if err != nil {
+			return err
+		}
+
+		nodes, propReader = flattenClusterNodes(data, propReader, logger)
+	} else {
+		// Collect Node data from the Nomad cluster
+		nodes, err = getData(filters, logger, !c.BoolT("no-progress"))
+		if err != nil {
+			return err
+		}
+	}
+
 	// Output result
 	output, err := breakdownResponse(c.String("output-format"), nodes, propReader)
 	if err != nil {
@@ -0,0 +1,320 @@
+package node
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/seatgeek/nomad-helper/helpers"
+	log "github.com/sirupsen/logrus"
+)
+
+// BreakdownHistory records node breakdowns for a set of dimensions on a schedule
+// and stores them as JSON lines in a local file, so they survive restarts
+type BreakdownHistory struct {
+	file       string
+	dimensions [][]string
+	retention  time.Duration
+	logger     *log.Logger
+
+	l         sync.RWMutex
+	snapshots []*breakdownSnapshot
+}
+
+type breakdownSnapshot struct {
+	Time       time.Time               `json:"time"`
+	Dimensions []string                `json:"dimensions"`
+	Results    []*helpers.BreakdownRow `json:"results"`
+}
+
+type historySeries struct {
+	Key    string         `json:"key"`
+	Path   []string       `json:"path"`
+	Points []historyPoint `json:"points"`
+}
+
+type historyPoint struct {
+	Time  time.Time `json:"time"`
+	Value int       `json:"value"`
+}
+
+// NewBreakdownHistory loads the existing snapshots from file. Each dimension is a
+// comma separated list of fields, the same as the arguments to "node breakdown"
+func NewBreakdownHistory(file string, dimensions []string, retention time.Duration, logger *log.Logger) (*BreakdownHistory, error) {
+	h := &BreakdownHistory{
+		file:      file,
+		retention: retention,
+		logger:    logger,
+		snapshots: make([]*breakdownSnapshot, 0),
+	}
+
+	for _, dimension := range dimensions {
+		fields := helpers.DeleteEmpty(strings.Split(dimension, ","))
+		if len(fields) == 0 {
+			continue
+		}
+
+		h.dimensions = append(h.dimensions, fields)
+	}
+
+	if len(h.dimensions) == 0 {
+		return nil, fmt.Errorf("at least one history dimension must be provided")
+	}
+
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Run records a snapshot of every dimension right away, and then every interval
+func (h *BreakdownHistory) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := h.record(); err != nil {
+			h.logger.Errorf("Could not record node breakdown history: %s", err)
+		}
+
+		<-ticker.C
+	}
+}
+
+func (h *BreakdownHistory) record() error {
+	filters := helpers.ClientFilter{Percent: 100}
+
+	nodes, err := getData(filters, h.logger, false)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	snapshots := make([]*breakdownSnapshot, 0, len(h.dimensions))
+
+	for _, dimensions := range h.dimensions {
+		results, err := computeStruct(nodes, helpers.NewMetaPropReader(dimensions...))
+		if err != nil {
+			return err
+		}
+
+		snapshots = append(snapshots, &breakdownSnapshot{
+			Time:       now,
+			Dimensions: dimensions,
+			Results:    results,
+		})
+	}
+
+	h.l.Lock()
+	defer h.l.Unlock()
+
+	h.snapshots = append(h.snapshots, snapshots...)
+
+	// Rewrite the whole file when old snapshots expired, otherwise just append to it
+	if h.prune() {
+		return h.write(h.snapshots, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+	}
+
+	return h.write(snapshots, os.O_CREATE|os.O_WRONLY|os.O_APPEND)
+}
+
+// prune drops snapshots older than the retention, and reports if any were dropped
+func (h *BreakdownHistory) prune() bool {
+	if h.retention <= 0 {
+		return false
+	}
+
+	cutoff := time.Now().Add(-h.retention)
+	for i, snapshot := range h.snapshots {
+		if snapshot.Time.After(cutoff) {
+			h.snapshots = h.snapshots[i:]
+			return i > 0
+		}
+	}
+
+	pruned := len(h.snapshots) > 0
+	h.snapshots = h.snapshots[:0]
+	return pruned
+}
+
+func (h *BreakdownHistory) load() error {
+	f, err := os.Open(h.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		snapshot := &breakdownSnapshot{}
+		if err := json.Unmarshal(scanner.Bytes(), snapshot); err != nil {
+			h.logger.Warnf("Skipping invalid line in %s: %s", h.file, err)
+			continue
+		}
+
+		h.snapshots = append(h.snapshots, snapshot)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	h.logger.Infof("Loaded %d node breakdown snapshots from %s", len(h.snapshots), h.file)
+	h.prune()
+	return nil
+}
+
+func (h *BreakdownHistory) write(snapshots []*breakdownSnapshot, flag int) error {
+	f, err := os.OpenFile(h.file, flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	for _, snapshot := range snapshots {
+		if err := encoder.Encode(snapshot); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// series returns one time series per breakdown key for the given dimensions
+func (h *BreakdownHistory) series(dimensions []string, since time.Time) ([]*historySeries, error) {
+	wanted := strings.Join(dimensions, ",")
+
+	known := false
+	for _, d := range h.dimensions {
+		if strings.Join(d, ",") == wanted {
+			known = true
+			break
+		}
+	}
+
+	if !known {
+		configured := make([]string, 0, len(h.dimensions))
+		for _, d := range h.dimensions {
+			configured = append(configured, strings.Join(d, "/"))
+		}
+
+		return nil, helpers.InvalidInputf("History is not recorded for '%s', recorded dimensions are: %s", strings.Join(dimensions, "/"), strings.Join(configured, ", "))
+	}
+
+	h.l.RLock()
+	defer h.l.RUnlock()
+
+	m := make([]*historySeries, 0)
+	index := make(map[string]*historySeries)
+
+	for _, snapshot := range h.snapshots {
+		if snapshot.Time.Before(since) || strings.Join(snapshot.Dimensions, ",") != wanted {
+			continue
+		}
+
+		for _, r := range snapshot.Results {
+			s, ok := index[r.Key]
+			if !ok {
+				s = &historySeries{Key: r.Key, Path: r.Path, Points: make([]historyPoint, 0)}
+				index[r.Key] = s
+				m = append(m, s)
+			}
+
+			s.Points = append(s.Points, historyPoint{Time: snapshot.Time, Value: r.Value})
+		}
+	}
+
+	return m, nil
+}
+
+// Web serves the recorded time series for the dimensions in the request path
+func (h *BreakdownHistory) Web(logger *log.Logger, r *http.Request) (string, error) {
+	dimensions := helpers.DeleteEmpty(strings.Split(r.URL.Path, "/"))
+	if len(dimensions) == 0 {
+		return "", helpers.InvalidInputf("Missing path (see help docs)")
+	}
+
+	since := time.Time{}
+	if value := r.URL.Query().Get("since"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return "", helpers.InvalidInputf("Invalid since: %s", err)
+		}
+
+		since = time.Now().Add(-d)
+	}
+
+	series, err := h.series(dimensions, since)
+	if err != nil {
+		return "", err
+	}
+
+	// Decide on output format
+	format := r.URL.Query().Get("output-format")
+	if format == "" {
+		format = "table"
+	}
+
+	switch format {
+	case "table":
+		var b bytes.Buffer
+		writer := bufio.NewWriter(&b)
+		printHistoryTable(series, dimensions, writer)
+		writer.Flush()
+
+		return b.String(), nil
+
+	case "json":
+		jsonText, err := json.Marshal(series)
+		if err != nil {
+			return "", err
+		}
+
+		return string(jsonText), nil
+
+	case "json-pretty":
+		jsonText, err := json.MarshalIndent(series, "", "  ")
+		if err != nil {
+			return "", err
+		}
+
+		return string(jsonText), nil
+
+	default:
+		return "", helpers.InvalidInputf("Invalid output-format: %s", format)
+	}
+}
+
+func printHistoryTable(m []*historySeries, dimensions []string, writer io.Writer) {
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoMergeCells(false)
+	table.SetRowLine(true)
+
+	header := append([]string{}, dimensions...)
+	header = append(header, "time", "count")
+	table.SetHeader(header)
+
+	for _, s := range m {
+		for _, point := range s.Points {
+			row := append([]string{}, s.Path...)
+			row = append(row, point.Time.Format(time.RFC3339), fmt.Sprintf("%d", point.Value))
+			table.Append(row)
+		}
+	}
+
+	table.Render()
+}
@@ -0,0 +1,197 @@
+package node
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/seatgeek/nomad-helper/helpers"
+	log "github.com/sirupsen/logrus"
+)
+
+func newHistoryLogger() *log.Logger {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func historySnapshot(at time.Time, dimensions []string, rows ...*helpers.BreakdownRow) *breakdownSnapshot {
+	return &breakdownSnapshot{Time: at, Dimensions: dimensions, Results: rows}
+}
+
+func snapshotTimes(snapshots []*breakdownSnapshot) []time.Time {
+	times := make([]time.Time, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		times = append(times, snapshot.Time)
+	}
+	return times
+}
+
+func TestBreakdownHistoryPrune(t *testing.T) {
+	now := time.Now()
+	dimensions := []string{"Datacenter"}
+
+	tests := []struct {
+		name      string
+		retention time.Duration
+		ages      []time.Duration
+		want      []time.Duration
+		pruned    bool
+	}{
+		{name: "no retention", ages: []time.Duration{48 * time.Hour, time.Hour}, want: []time.Duration{48 * time.Hour, time.Hour}},
+		{name: "nothing expired", retention: 24 * time.Hour, ages: []time.Duration{2 * time.Hour, time.Hour}, want: []time.Duration{2 * time.Hour, time.Hour}},
+		{name: "some expired", retention: 24 * time.Hour, ages: []time.Duration{72 * time.Hour, 48 * time.Hour, time.Hour}, want: []time.Duration{time.Hour}, pruned: true},
+		{name: "all expired", retention: 24 * time.Hour, ages: []time.Duration{72 * time.Hour, 48 * time.Hour}, want: []time.Duration{}, pruned: true},
+		{name: "empty", retention: 24 * time.Hour, want: []time.Duration{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &BreakdownHistory{retention: tt.retention, snapshots: make([]*breakdownSnapshot, 0)}
+			for _, age := range tt.ages {
+				h.snapshots = append(h.snapshots, historySnapshot(now.Add(-age), dimensions))
+			}
+
+			if pruned := h.prune(); pruned != tt.pruned {
+				t.Errorf("got pruned %v, want %v", pruned, tt.pruned)
+			}
+
+			want := make([]time.Time, 0, len(tt.want))
+			for _, age := range tt.want {
+				want = append(want, now.Add(-age))
+			}
+
+			if got := snapshotTimes(h.snapshots); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestBreakdownHistorySeries(t *testing.T) {
+	first := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	h := &BreakdownHistory{
+		dimensions: [][]string{{"Datacenter"}, {"Datacenter", "Attributes.os.name"}},
+		snapshots: []*breakdownSnapshot{
+			historySnapshot(first, []string{"Datacenter"},
+				&helpers.BreakdownRow{Key: "dc1", Path: []string{"dc1"}, Value: 3},
+			),
+			historySnapshot(first, []string{"Datacenter", "Attributes.os.name"},
+				&helpers.BreakdownRow{Key: "dc1.ubuntu", Path: []string{"dc1", "ubuntu"}, Value: 3},
+			),
+			historySnapshot(second, []string{"Datacenter"},
+				&helpers.BreakdownRow{Key: "dc1", Path: []string{"dc1"}, Value: 2},
+				&helpers.BreakdownRow{Key: "dc2", Path: []string{"dc2"}, Value: 1},
+			),
+		},
+	}
+
+	tests := []struct {
+		name       string
+		dimensions []string
+		since      time.Time
+		want       []*historySeries
+		wantErr    bool
+	}{
+		{
+			name:       "all points",
+			dimensions: []string{"Datacenter"},
+			want: []*historySeries{
+				{Key: "dc1", Path: []string{"dc1"}, Points: []historyPoint{{Time: first, Value: 3}, {Time: second, Value: 2}}},
+				{Key: "dc2", Path: []string{"dc2"}, Points: []historyPoint{{Time: second, Value: 1}}},
+			},
+		},
+		{
+			name:       "since",
+			dimensions: []string{"Datacenter"},
+			since:      second,
+			want: []*historySeries{
+				{Key: "dc1", Path: []string{"dc1"}, Points: []historyPoint{{Time: second, Value: 2}}},
+				{Key: "dc2", Path: []string{"dc2"}, Points: []historyPoint{{Time: second, Value: 1}}},
+			},
+		},
+		{
+			name:       "several dimensions",
+			dimensions: []string{"Datacenter", "Attributes.os.name"},
+			want: []*historySeries{
+				{Key: "dc1.ubuntu", Path: []string{"dc1", "ubuntu"}, Points: []historyPoint{{Time: first, Value: 3}}},
+			},
+		},
+		{
+			name:       "no points",
+			dimensions: []string{"Datacenter"},
+			since:      second.Add(time.Minute),
+			want:       []*historySeries{},
+		},
+		{
+			name:       "not recorded",
+			dimensions: []string{"Attributes.os.name"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.series(tt.dimensions, tt.since)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakdownHistoryFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history.jsonl")
+	now := time.Now().UTC().Truncate(time.Second)
+	dimensions := []string{"Datacenter"}
+	row := &helpers.BreakdownRow{Key: "dc1", Path: []string{"dc1"}, Value: 1}
+
+	// a missing file is an empty history
+	h, err := NewBreakdownHistory(file, []string{"Datacenter"}, 24*time.Hour, newHistoryLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.snapshots) != 0 {
+		t.Fatalf("got %d snapshots from a missing file, want 0", len(h.snapshots))
+	}
+
+	expired := historySnapshot(now.Add(-48*time.Hour), dimensions, row)
+	recent := historySnapshot(now.Add(-time.Hour), dimensions, row)
+	if err := h.write([]*breakdownSnapshot{expired, recent}, os.O_CREATE|os.O_WRONLY|os.O_TRUNC); err != nil {
+		t.Fatal(err)
+	}
+
+	latest := historySnapshot(now, dimensions, row)
+	if err := h.write([]*breakdownSnapshot{latest}, os.O_CREATE|os.O_WRONLY|os.O_APPEND); err != nil {
+		t.Fatal(err)
+	}
+
+	// a write cut short by a crash leaves a truncated last line
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"` + now.Format(time.RFC3339) + `","dimensions":["Data`)
+	f.Close()
+
+	loaded, err := NewBreakdownHistory(file, []string{"Datacenter"}, 24*time.Hour, newHistoryLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []time.Time{recent.Time, latest.Time}
+	if got := snapshotTimes(loaded.snapshots); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(loaded.snapshots[1], latest) {
+		t.Errorf("got %+v, want %+v", loaded.snapshots[1], latest)
+	}
+}
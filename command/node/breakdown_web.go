@@ -1,7 +1,6 @@
 package node
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
 
@@ -13,14 +12,14 @@ func BreakdownWeb(logger *log.Logger, r *http.Request) (string, error) {
 	// Get list of CLI arguments we should use as dimensions
 	dimensions := helpers.DeleteEmpty(strings.Split(r.URL.Path, "/"))
 	if len(dimensions) == 0 {
-		return "", fmt.Errorf("Missing path (see help docs)")
+		return "", helpers.InvalidInputf("Missing path (see help docs)")
 	}
 
 	// Create filters
 	filters := helpers.ClientFilterFromWeb(r)
 
 	// Collect Node data from the Nomad cluster
-	nodes, err := getData(filters, logger, false)
+	nodes, err := getWebData(r, filters, logger)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,135 @@
+package node
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+)
+
+// clusterNodes is the nodes read from a single named cluster, or a single region of it
+type clusterNodes struct {
+	cluster string
+	region  string
+	nodes   []*api.Node
+}
+
+// label names the cluster and region the nodes were read from, like "production/eu-west"
+func (d *clusterNodes) label() string {
+	return (&nomad.Cluster{Name: d.cluster, Region: d.region}).Label()
+}
+
+// nodeProcessor can narrow down the nodes read from a cluster, using the client for that cluster
+type nodeProcessor func(nomadClient *api.Client, nodes []*api.Node) ([]*api.Node, error)
+
+// getClustersData reads the nodes from all clusters in parallel, the result is in the same order as the clusters
+func getClustersData(clusters []*nomad.Cluster, filters helpers.ClientFilter, logger *log.Logger, process nodeProcessor) ([]*clusterNodes, error) {
+	result := make([]*clusterNodes, len(clusters))
+	errs := make([]error, len(clusters))
+
+	var wg sync.WaitGroup
+	for i, cluster := range clusters {
+		wg.Add(1)
+
+		go func(i int, cluster *nomad.Cluster) {
+			defer wg.Done()
+
+			nomadClient, err := cluster.NewClient()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			nodes, err := getDataFromClient(nomadClient, filters, logger, false)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			if process != nil {
+				if nodes, err = process(nomadClient, nodes); err != nil {
+					errs[i] = err
+					return
+				}
+			}
+
+			result[i] = &clusterNodes{cluster: cluster.Name, region: cluster.Region, nodes: nodes}
+		}(i, cluster)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %s", clusters[i].Label(), err)
+		}
+	}
+
+	return result, nil
+}
+
+// flattenClusterNodes returns the nodes from all clusters, and a reader with "cluster" and
+// "region" as the first fields. Either is left out when none of the nodes have one. A node ID
+// read from more than one cluster (the same cluster configured twice) is only kept the first time
+func flattenClusterNodes(data []*clusterNodes, reader helpers.PropReader, logger *log.Logger) ([]*api.Node, helpers.PropReader) {
+	nodes := make([]*api.Node, 0)
+	origins := make(map[string]*clusterNodes)
+	withCluster, withRegion := false, false
+
+	for _, d := range data {
+		withCluster = withCluster || d.cluster != ""
+		withRegion = withRegion || d.region != ""
+
+		for _, node := range d.nodes {
+			if origin, ok := origins[node.ID]; ok {
+				logger.Warnf("Node %s was read from both %s and %s, only keeping it for %s", node.ID, origin.label(), d.label(), origin.label())
+				continue
+			}
+
+			nodes = append(nodes, node)
+			origins[node.ID] = d
+		}
+	}
+
+	return nodes, &clusterPropReader{reader: reader, origins: origins, withCluster: withCluster, withRegion: withRegion}
+}
+
+// clusterPropReader prefixes the fields of another reader with the cluster and region the
+// node was read from
+type clusterPropReader struct {
+	reader      helpers.PropReader
+	origins     map[string]*clusterNodes
+	withCluster bool
+	withRegion  bool
+}
+
+func (r *clusterPropReader) Read(node *api.Node) ([]string, error) {
+	values, err := r.reader.Read(node)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]string, 0, 2)
+	if r.withCluster {
+		prefix = append(prefix, r.origins[node.ID].cluster)
+	}
+	if r.withRegion {
+		prefix = append(prefix, r.origins[node.ID].region)
+	}
+
+	return append(prefix, values...), nil
+}
+
+func (r *clusterPropReader) GetKeys() []string {
+	keys := make([]string, 0, 2)
+	if r.withCluster {
+		keys = append(keys, "cluster")
+	}
+	if r.withRegion {
+		keys = append(keys, "region")
+	}
+
+	return append(keys, r.reader.GetKeys()...)
+}
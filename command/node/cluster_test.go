@@ -0,0 +1,99 @@
+package node
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestFlattenClusterNodes(t *testing.T) {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name     string
+		data     []*clusterNodes
+		wantKeys []string
+		wantRow  []string
+	}{
+		{
+			name:     "clusters",
+			data:     []*clusterNodes{{cluster: "staging"}, {cluster: "production"}},
+			wantKeys: []string{"cluster", "name"},
+			wantRow:  []string{"production", "node-1"},
+		},
+		{
+			name:     "regions",
+			data:     []*clusterNodes{{region: "eu-west"}, {region: "us-east"}},
+			wantKeys: []string{"region", "name"},
+			wantRow:  []string{"us-east", "node-1"},
+		},
+		{
+			name:     "clusters and regions",
+			data:     []*clusterNodes{{cluster: "production", region: "eu-west"}, {cluster: "production", region: "us-east"}},
+			wantKeys: []string{"cluster", "region", "name"},
+			wantRow:  []string{"production", "us-east", "node-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.data[1].nodes = []*api.Node{{ID: "1", Name: "node-1"}}
+
+			nodes, reader := flattenClusterNodes(tt.data, helpers.NewMetaPropReader("name"), logger)
+			if len(nodes) != 1 {
+				t.Fatalf("got %d nodes, want 1", len(nodes))
+			}
+
+			if got := reader.GetKeys(); !reflect.DeepEqual(got, tt.wantKeys) {
+				t.Errorf("got keys %q, want %q", got, tt.wantKeys)
+			}
+
+			row, err := reader.Read(nodes[0])
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(row, tt.wantRow) {
+				t.Errorf("got row %q, want %q", row, tt.wantRow)
+			}
+		})
+	}
+}
+
+func TestFlattenClusterNodesDuplicates(t *testing.T) {
+	var output bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&output)
+
+	data := []*clusterNodes{
+		{cluster: "production", nodes: []*api.Node{{ID: "1", Name: "node-1"}, {ID: "2", Name: "node-2"}}},
+		{cluster: "production-copy", nodes: []*api.Node{{ID: "1", Name: "node-1"}}},
+		{cluster: "staging", nodes: []*api.Node{{ID: "3", Name: "node-3"}}},
+	}
+
+	nodes, reader := flattenClusterNodes(data, helpers.NewMetaPropReader("name"), logger)
+
+	got := make([][]string, 0, len(nodes))
+	for _, node := range nodes {
+		row, err := reader.Read(node)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		got = append(got, row)
+	}
+
+	want := [][]string{{"production", "node-1"}, {"production", "node-2"}, {"staging", "node-3"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got rows %q, want %q", got, want)
+	}
+
+	if !strings.Contains(output.String(), "Node 1 was read from both production and production-copy") {
+		t.Errorf("missing duplicate warning in %q", output.String())
+	}
+}
@@ -0,0 +1,280 @@
+package node
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/olekukonko/tablewriter"
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+// diffRow is a type/key/value present in only one side, or with a different
+// node count on each side. A count of 0 means the value is missing, and -1
+// means it's present but the count is unknown (snapshot without counts)
+type diffRow struct {
+	Type  string `json:"type"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Left  int    `json:"left"`
+	Right int    `json:"right"`
+}
+
+type diffResponse struct {
+	Left  string     `json:"left"`
+	Right string     `json:"right"`
+	Diff  []*diffRow `json:"diff"`
+}
+
+func DiffCLI(c *cli.Context, logger *log.Logger) error {
+	args := getCLIArgs(c)
+
+	var left, right string
+	switch len(args) {
+	case 1:
+		right = args[0]
+	case 2:
+		left, right = args[0], args[1]
+	default:
+		return fmt.Errorf("Expected one or two arguments (Nomad address or snapshot file)")
+	}
+
+	filters := helpers.ClientFilterFromCLI(c.Parent())
+
+	return nomad.InRegions(c, logger, func(_ *api.Client, region string) error {
+		return diffRegion(c, left, right, region, filters, logger)
+	})
+}
+
+// diffRegion compares the nodes of the two sources in a single region, the region is
+// ignored for snapshot files
+func diffRegion(c *cli.Context, left, right, region string, filters helpers.ClientFilter, logger *log.Logger) error {
+	leftData, err := diffSourceData(left, region, filters, logger)
+	if err != nil {
+		return fmt.Errorf("Could not read %s: %s", diffSourceName(left, region), err)
+	}
+
+	rightData, err := diffSourceData(right, region, filters, logger)
+	if err != nil {
+		return fmt.Errorf("Could not read %s: %s", diffSourceName(right, region), err)
+	}
+
+	result := &diffResponse{
+		Left:  diffSourceName(left, region),
+		Right: diffSourceName(right, region),
+		Diff:  computeDiff(leftData, rightData),
+	}
+
+	switch format := c.String("output-format"); format {
+	case "table":
+		var b bytes.Buffer
+		writer := bufio.NewWriter(&b)
+		printDiffTable(result, writer)
+		writer.Flush()
+		fmt.Println(b.String())
+
+	case "json":
+		jsonText, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jsonText))
+
+	case "json-pretty":
+		jsonText, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jsonText))
+
+	default:
+		return fmt.Errorf("Invalid output-format: %s", format)
+	}
+
+	return nil
+}
+
+func diffSourceName(source, region string) string {
+	if region != "" && isDiffAddress(source) {
+		return fmt.Sprintf("%s (region %s)", diffSourceName(source, ""), region)
+	}
+
+	if source != "" {
+		return source
+	}
+
+	if profile := nomad.ActiveProfile(); profile != nil && profile.Address != "" {
+		return profile.Address
+	}
+
+	if addr := os.Getenv("NOMAD_ADDR"); addr != "" {
+		return addr
+	}
+
+	return api.DefaultConfig().Address
+}
+
+// isDiffAddress is true for a Nomad address (empty meaning the selected profile or NOMAD_*
+// environment), and false for a snapshot file
+func isDiffAddress(source string) bool {
+	return source == "" || strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// diffSourceData reads the discover data from a Nomad address (empty meaning the
+// selected profile or NOMAD_* environment), or from a file saved with "node discover --output-format json"
+func diffSourceData(source, region string, filters helpers.ClientFilter, logger *log.Logger) (*DiscoverResponse, error) {
+	if !isDiffAddress(source) {
+		data, err := ioutil.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := &DiscoverResponse{}
+		if err := json.Unmarshal(data, resp); err != nil {
+			return nil, err
+		}
+
+		return resp, nil
+	}
+
+	var nomadClient *api.Client
+	var err error
+	if source != "" {
+		config := api.DefaultConfig()
+		config.Address = source
+		nomadClient, err = api.NewClient(config)
+	} else {
+		nomadClient, err = nomad.NewNomadClient()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if region != "" {
+		nomadClient.SetRegion(region)
+	}
+
+	nodes, err := getDataFromClient(nomadClient, filters, logger, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return computeDiscoverData(nodes), nil
+}
+
+// diffValues flattens the discover data into type -> key -> value -> count
+func diffValues(input *DiscoverResponse) map[string]map[string]map[string]int {
+	m := make(map[string]map[string]map[string]int)
+
+	add := func(kind, prefix string, options map[string][]string) {
+		m[kind] = make(map[string]map[string]int)
+		for key, values := range options {
+			m[kind][key] = make(map[string]int)
+			for _, value := range values {
+				count := -1
+				if input.Count != nil {
+					count = input.Count[fmt.Sprintf("%s%s=%s", prefix, key, value)]
+				}
+
+				m[kind][key][value] = count
+			}
+		}
+	}
+
+	add("--filter-meta", "meta.", input.Meta)
+	add("--filter-attribute", "attribute.", input.Attribute)
+	add("node", "", input.Node)
+
+	return m
+}
+
+func computeDiff(left, right *DiscoverResponse) []*diffRow {
+	leftValues := diffValues(left)
+	rightValues := diffValues(right)
+
+	rows := make([]*diffRow, 0)
+	seen := make(map[string]bool)
+
+	compare := func(kind, key, value string) {
+		id := kind + "\000" + key + "\000" + value
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+
+		l := leftValues[kind][key][value]
+		r := rightValues[kind][key][value]
+
+		// Counts can only be compared when both sides know them
+		if l == r || (l != 0 && r != 0 && (l == -1 || r == -1)) {
+			return
+		}
+
+		rows = append(rows, &diffRow{Type: kind, Key: key, Value: value, Left: l, Right: r})
+	}
+
+	for _, values := range []map[string]map[string]map[string]int{leftValues, rightValues} {
+		for kind, keys := range values {
+			for key, options := range keys {
+				for value := range options {
+					compare(kind, key, value)
+				}
+			}
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		a := []string{rows[i].Type, rows[i].Key, rows[i].Value}
+		b := []string{rows[j].Type, rows[j].Key, rows[j].Value}
+		for x := range a {
+			if a[x] == b[x] {
+				continue
+			}
+			return a[x] < b[x]
+		}
+		return false
+	})
+
+	return rows
+}
+
+func printDiffTable(result *diffResponse, writer io.Writer) {
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoMergeCells(true)
+	table.SetRowLine(true)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeader([]string{"Type", "Key", "Value", result.Left, result.Right})
+
+	count := func(i int) string {
+		switch i {
+		case 0:
+			return "-"
+		case -1:
+			return "present"
+		default:
+			return fmt.Sprintf("%d", i)
+		}
+	}
+
+	for i, row := range result.Diff {
+		// hack: make sure the counts are never merged across rows
+		char := "\001"
+		if i%2 == 0 {
+			char = "\002"
+		}
+
+		table.Append([]string{row.Type, row.Key, row.Value, count(row.Left) + char, count(row.Right) + char})
+	}
+
+	table.Render()
+}
@@ -0,0 +1,67 @@
+package node
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeDiff(t *testing.T) {
+	tests := []struct {
+		name  string
+		left  *DiscoverResponse
+		right *DiscoverResponse
+		want  []*diffRow
+	}{
+		{
+			name: "identical",
+			left: &DiscoverResponse{
+				Meta:  map[string][]string{"az": {"a"}},
+				Node:  map[string][]string{"class": {"web"}},
+				Count: map[string]int{"meta.az=a": 2, "class=web": 2},
+			},
+			right: &DiscoverResponse{
+				Meta:  map[string][]string{"az": {"a"}},
+				Node:  map[string][]string{"class": {"web"}},
+				Count: map[string]int{"meta.az=a": 2, "class=web": 2},
+			},
+			want: []*diffRow{},
+		},
+		{
+			name: "missing and different counts",
+			left: &DiscoverResponse{
+				Meta:      map[string][]string{"az": {"a", "b"}},
+				Attribute: map[string][]string{"driver.docker": {"1"}},
+				Count:     map[string]int{"meta.az=a": 2, "meta.az=b": 1, "attribute.driver.docker=1": 3},
+			},
+			right: &DiscoverResponse{
+				Meta:  map[string][]string{"az": {"a"}},
+				Count: map[string]int{"meta.az=a": 3},
+			},
+			want: []*diffRow{
+				{Type: "--filter-attribute", Key: "driver.docker", Value: "1", Left: 3, Right: 0},
+				{Type: "--filter-meta", Key: "az", Value: "a", Left: 2, Right: 3},
+				{Type: "--filter-meta", Key: "az", Value: "b", Left: 1, Right: 0},
+			},
+		},
+		{
+			name: "snapshot without counts",
+			left: &DiscoverResponse{
+				Meta:  map[string][]string{"az": {"a"}},
+				Count: map[string]int{"meta.az=a": 2},
+			},
+			right: &DiscoverResponse{
+				Meta: map[string][]string{"az": {"a", "b"}},
+			},
+			want: []*diffRow{
+				{Type: "--filter-meta", Key: "az", Value: "b", Left: 0, Right: -1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := computeDiff(tt.left, tt.right); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("computeDiff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
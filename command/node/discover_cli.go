@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli"
 )
@@ -19,6 +20,36 @@ var ignoredNodeAttributes = map[string]interface{}{
 func DiscoverCLI(c *cli.Context, logger *log.Logger) error {
 	filters := helpers.ClientFilterFromCLI(c.Parent())
 
+	clusters, err := nomad.ClustersFromCLI(c.Parent())
+	if err != nil {
+		return err
+	}
+
+	clusters, err = nomad.RegionsFromCLI(c.Parent(), clusters)
+	if err != nil {
+		return err
+	}
+
+	if len(clusters) > 0 {
+		data, err := getClustersData(clusters, filters, logger, nil)
+		if err != nil {
+			return err
+		}
+
+		result := make(map[string]*DiscoverResponse)
+		for _, d := range data {
+			result[d.label()] = computeDiscoverData(d.nodes)
+		}
+
+		output, err := clustersDiscoverResponse(c.String("output-format"), result)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(output)
+		return nil
+	}
+
 	data, err := discoverData(filters, logger, !c.BoolT("no-progress"))
 	if err != nil {
 		return err
@@ -9,6 +9,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/hashicorp/nomad/api"
 	"github.com/olekukonko/tablewriter"
 	"github.com/seatgeek/nomad-helper/helpers"
 	log "github.com/sirupsen/logrus"
@@ -18,6 +19,10 @@ type DiscoverResponse struct {
 	Meta      map[string][]string
 	Attribute map[string][]string
 	Node      map[string][]string
+
+	// Count is the number of nodes for each "field=value" pair, where field is
+	// in the same format as the fields for "node list", e.g. "meta.key=value"
+	Count map[string]int `json:",omitempty"`
 }
 
 func discoverData(filters helpers.ClientFilter, logger *log.Logger, progress bool) (*DiscoverResponse, error) {
@@ -27,6 +32,10 @@ func discoverData(filters helpers.ClientFilter, logger *log.Logger, progress boo
 		return nil, err
 	}
 
+	return computeDiscoverData(nodes), nil
+}
+
+func computeDiscoverData(nodes []*api.Node) *DiscoverResponse {
 	nodeProperties := make(map[string][]string, 0)
 	nodeProperties["class"] = make([]string, 0)
 	nodeProperties["datacenter"] = make([]string, 0)
@@ -35,6 +44,7 @@ func discoverData(filters helpers.ClientFilter, logger *log.Logger, progress boo
 
 	metaOptions := make(map[string][]string, 0)
 	attributeOptions := make(map[string][]string, 0)
+	counts := make(map[string]int, 0)
 
 	for _, node := range nodes {
 		for k, v := range node.Meta {
@@ -43,6 +53,7 @@ func discoverData(filters helpers.ClientFilter, logger *log.Logger, progress boo
 			}
 
 			metaOptions[k] = AppendIfMissing(metaOptions[k], v)
+			counts[fmt.Sprintf("meta.%s=%s", k, v)]++
 		}
 
 		for k, v := range node.Attributes {
@@ -59,21 +70,28 @@ func discoverData(filters helpers.ClientFilter, logger *log.Logger, progress boo
 			}
 
 			attributeOptions[k] = AppendIfMissing(attributeOptions[k], v)
+			counts[fmt.Sprintf("attribute.%s=%s", k, v)]++
 		}
 
 		nodeProperties["class"] = AppendIfMissing(nodeProperties["class"], node.NodeClass)
 		nodeProperties["datacenter"] = AppendIfMissing(nodeProperties["datacenter"], node.Datacenter)
 		nodeProperties["eligibility"] = AppendIfMissing(nodeProperties["eligibility"], node.SchedulingEligibility)
 		nodeProperties["status"] = AppendIfMissing(nodeProperties["status"], node.Status)
+
+		counts["class="+node.NodeClass]++
+		counts["datacenter="+node.Datacenter]++
+		counts["eligibility="+node.SchedulingEligibility]++
+		counts["status="+node.Status]++
 	}
 
 	resp := &DiscoverResponse{
 		Attribute: attributeOptions,
 		Meta:      metaOptions,
 		Node:      nodeProperties,
+		Count:     counts,
 	}
 
-	return resp, nil
+	return resp
 }
 
 func discoverResponse(format string, input DiscoverResponse) (string, error) {
@@ -111,7 +129,56 @@ func discoverResponse(format string, input DiscoverResponse) (string, error) {
 		return string(jsonText), nil
 
 	default:
-		return "", fmt.Errorf("Invalid output-format: %s", format)
+		return "", helpers.InvalidInputf("Invalid output-format: %s", format)
+	}
+}
+
+// clustersDiscoverResponse is like discoverResponse, for the discover data of multiple clusters keyed by cluster name
+func clustersDiscoverResponse(format string, input map[string]*DiscoverResponse) (string, error) {
+	switch format {
+	case "table":
+		m := make([][]string, 0)
+		for cluster, data := range input {
+			rows, err := computeDiscoverStruct(*data)
+			if err != nil {
+				return "", err
+			}
+
+			for _, row := range rows {
+				m = append(m, append([]string{cluster}, row...))
+			}
+		}
+
+		sort.SliceStable(m, func(i, j int) bool {
+			return m[i][0] < m[j][0]
+		})
+
+		propReader := helpers.NewMetaPropReader("Cluster", "Type", "Key", "Value")
+
+		var b bytes.Buffer
+		writer := bufio.NewWriter(&b)
+		printDiscoverTable(m, propReader, writer)
+		writer.Flush()
+		return b.String(), nil
+
+	case "json":
+		jsonText, err := json.Marshal(input)
+		if err != nil {
+			return "", err
+		}
+
+		return string(jsonText), nil
+
+	case "json-pretty":
+		jsonText, err := json.MarshalIndent(input, "", "  ")
+		if err != nil {
+			return "", err
+		}
+
+		return string(jsonText), nil
+
+	default:
+		return "", helpers.InvalidInputf("Invalid output-format: %s", format)
 	}
 }
 
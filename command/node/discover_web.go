@@ -12,10 +12,11 @@ func DiscoverWeb(logger *log.Logger, r *http.Request) (string, error) {
 	filters := helpers.ClientFilterFromWeb(r)
 
 	// Collect Node data from the Nomad cluster
-	result, err := discoverData(filters, logger, false)
+	nodes, err := getWebData(r, filters, logger)
 	if err != nil {
 		return "", err
 	}
+	result := computeDiscoverData(nodes)
 
 	// Decide on output format
 	format := r.URL.Query().Get("output-format")
@@ -9,15 +9,11 @@ import (
 	"github.com/hashicorp/nomad/api"
 	nomadStructs "github.com/hashicorp/nomad/nomad/structs"
 	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
-var (
-	newConstraint api.Constraint
-	evalID        string
-)
-
 func Drain(c *cli.Context, logger *log.Logger) error {
 	// Check that enable or disable is not set with monitor
 	if c.Bool("monitor") && (c.Bool("enable") || c.Bool("disable")) {
@@ -37,6 +33,8 @@ func Drain(c *cli.Context, logger *log.Logger) error {
 		return fmt.Errorf("-force and -no-deadline are mutually exclusive")
 	}
 
+	// The drain can run concurrently from the server, so no state is shared between calls
+	var newConstraint api.Constraint
 	if c.String("constraint") != "" {
 		if c.String("operand") == "" {
 			return fmt.Errorf("with-benefits constraint provided, must provide new constrain operand")
@@ -56,12 +54,13 @@ func Drain(c *cli.Context, logger *log.Logger) error {
 		deadline = 0
 	}
 
-	// create Nomad API client
-	nomadClient, err := api.NewClient(api.DefaultConfig())
-	if err != nil {
-		return err
-	}
+	return nomad.InRegions(c, logger, func(nomadClient *api.Client, _ string) error {
+		return drainNodes(c, logger, nomadClient, deadline, newConstraint)
+	})
+}
 
+// drainNodes changes the drain mode of the nodes matching the filters, in a single region
+func drainNodes(c *cli.Context, logger *log.Logger, nomadClient *api.Client, deadline time.Duration, newConstraint api.Constraint) error {
 	filters := helpers.ClientFilterFromCLI(c.Parent())
 
 	// find nodes to target
@@ -78,47 +77,54 @@ func Drain(c *cli.Context, logger *log.Logger) error {
 	ctx := context.Background()
 
 	for _, node := range matches {
-		log.Infof("Node %s (class: %s / version: %s)", node.Name, node.NodeClass, node.Attributes["nomad.version"])
+		logger.Infof("Node %s (class: %s / version: %s)", node.Name, node.NodeClass, node.Attributes["nomad.version"])
 		if c.Bool("with-benefits") {
-			log.Infof("Drain mode with benefits selected, marking node as ineligible and starting to move the jobs to the specified constraint")
+			logger.Infof("Drain mode with benefits selected, marking node as ineligible and starting to move the jobs to the specified constraint")
 			_, err := nomadClient.Nodes().ToggleEligibility(node.ID, false, nil)
 			if err != nil {
-				log.Errorf("Error updating scheduling eligibility for %s: %s", node.Name, err)
+				logger.Errorf("Error updating scheduling eligibility for %s: %s", node.Name, err)
 				continue
 			}
 			// Bring the allocations running on the node
 			nodeAllocations, _, err := nomadClient.Nodes().Allocations(node.ID, nil)
 			if err != nil {
-				log.Errorf("Error updating scheduling eligibility for %s: %s", node.Name, err)
+				logger.Errorf("Error updating scheduling eligibility for %s: %s", node.Name, err)
 				continue
 			}
 
+			allocationsToMove := make([]*api.Allocation, 0)
 			for _, nodeAllocation := range nodeAllocations {
 				if *nodeAllocation.Job.Type != nomadStructs.JobTypeService {
-					log.Infof("Skipping %s because it's not a service job", nodeAllocation.JobID)
+					logger.Infof("Skipping %s because it's not a service job", nodeAllocation.JobID)
 					continue
 				}
 
 				if nodeAllocation.ClientStatus == nomadStructs.AllocClientStatusComplete || nodeAllocation.DesiredStatus == nomadStructs.AllocDesiredStatusStop {
-					log.Infof("Skipping %s because it's already complete", nodeAllocation.JobID)
+					logger.Infof("Skipping %s because it's already complete", nodeAllocation.JobID)
 					continue
 				}
 
-				log.Infof("Found Allocation %s, for job %s, moving it", nodeAllocation.ID, nodeAllocation.JobID)
-				if c.String("constraint") == "" {
-					evalID, err = stopAllocation(nomadClient, nodeAllocation)
-					if err != nil {
-						return err
-					}
-
-				} else {
-					evalID, err = moveJobTaskGroup(nodeAllocation, &newConstraint, nomadClient)
-					if err != nil {
-						return err
-					}
+				allocationsToMove = append(allocationsToMove, nodeAllocation)
+			}
+
+			// Without a constraint the allocations are migrated the same way a drain would,
+			// respecting the migrate stanza of each task group
+			if c.String("constraint") == "" {
+				if err := migrateAllocations(nomadClient, allocationsToMove, logger.WithField("node", node.Name)); err != nil {
+					logger.Errorf("Could not migrate all allocations off %s: %s", node.Name, err)
 				}
+				continue
+			}
+
+			for _, nodeAllocation := range allocationsToMove {
+				logger.Infof("Found Allocation %s, for job %s, moving it", nodeAllocation.ID, nodeAllocation.JobID)
+				evalID, err := moveJobTaskGroup(nodeAllocation, &newConstraint, nomadClient)
+				if err != nil {
+					return err
+				}
+
 				if c.Bool("wait-for-pending") {
-					waitForPending(logger, nomadClient, nodeAllocation.JobID, evalID)
+					waitForPending(logger, nomadClient, nodeAllocation, evalID)
 				}
 			}
 			continue
@@ -126,7 +132,7 @@ func Drain(c *cli.Context, logger *log.Logger) error {
 
 		// in monitor mode we don't do any change to node state
 		if c.Bool("monitor") {
-			go monitor(ctx, nomadClient, node, &wg)
+			go monitor(ctx, logger, nomadClient, node, &wg)
 			continue
 		}
 
@@ -140,20 +146,20 @@ func Drain(c *cli.Context, logger *log.Logger) error {
 
 		_, err := nomadClient.Nodes().UpdateDrain(node.ID, spec, !c.Bool("keep-ineligible"), nil)
 		if err != nil {
-			log.Errorf("Could not update drain config for %s: %s", node.Name, err)
+			logger.Errorf("Could not update drain config for %s: %s", node.Name, err)
 			continue
 		}
 
 		if !c.Bool("enable") || c.Bool("detach") {
 			if c.Bool("enable") {
-				log.Infof("Node %q drain strategy set", node.ID)
+				logger.Infof("Node %q drain strategy set", node.ID)
 			} else {
-				log.Infof("Node %q drain strategy unset", node.ID)
+				logger.Infof("Node %q drain strategy unset", node.ID)
 			}
 		}
 
 		if c.Bool("enable") && !c.Bool("detach") {
-			go monitor(ctx, nomadClient, node, &wg)
+			go monitor(ctx, logger, nomadClient, node, &wg)
 		}
 	}
 
@@ -162,77 +168,92 @@ func Drain(c *cli.Context, logger *log.Logger) error {
 	return nil
 }
 
-func waitForPending(logger *log.Logger, nomadClient *api.Client, JobID, EvalID string) {
-	log.Infof("Waiting for successfully placing the moved job")
-	// wait for the evaluation to be available
+func waitForPending(logger *log.Logger, nomadClient *api.Client, allocation *api.Allocation, evalID string) {
+	logger.Infof("Waiting for successfully placing the moved job")
+	queryOptions := &api.QueryOptions{Namespace: allocation.Namespace}
+
+	// wait for the evaluation to complete
+	var index uint64
 	for {
-		time.Sleep(1 * time.Second)
-		evaluation, _, err := nomadClient.Evaluations().Info(EvalID, nil)
+		queryOptions.WaitIndex = index
+		evaluation, meta, err := nomadClient.Evaluations().Info(evalID, queryOptions)
 		if err != nil {
+			logger.Errorf("Could not read evaluation %s: %s", evalID, err)
+			time.Sleep(1 * time.Second)
 			continue
 		}
+		index = meta.LastIndex
 
 		if evaluation.Status == nomadStructs.EvalStatusCancelled || evaluation.Status == nomadStructs.EvalStatusFailed {
 			logger.Errorf("Could not evaluate the job: %s", evaluation.StatusDescription)
-			continue
+			return
 		}
 
 		if evaluation.Status == nomadStructs.EvalStatusComplete {
-			log.Infof("Evaluation %s for job %s completed", evaluation.ID, JobID)
+			logger.Infof("Evaluation %s for job %s completed", evaluation.ID, allocation.JobID)
 			break
 		}
 	}
 
-	// wait for the allocations to be available
-	for {
-		time.Sleep(1 * time.Second)
-		evaluations, _, err := nomadClient.Evaluations().List(nil)
-		if err != nil {
-			continue
-		}
-		for _, evaluation := range evaluations {
-			if evaluation.JobID == JobID && evaluation.Status == nomadStructs.EvalStatusBlocked {
-				log.Infof("Job %s got blocked evaluations", JobID)
-				continue
-			}
+	// report blocked evaluations, the job will not be fully placed until the cluster has capacity for it
+	queryOptions.WaitIndex = 0
+	evaluations, _, err := nomadClient.Jobs().Evaluations(allocation.JobID, queryOptions)
+	if err != nil {
+		logger.Errorf("Could not read evaluations for job %s: %s", allocation.JobID, err)
+	}
+	for _, evaluation := range evaluations {
+		if evaluation.Status == nomadStructs.EvalStatusBlocked {
+			logger.Infof("Job %s got blocked evaluations, see why with: nomad-helper eval explain %s", allocation.JobID, allocation.JobID)
+			break
 		}
-
-		break
 	}
 
 	// waiting for allocation to be placed
+	index = 0
 	for {
-		time.Sleep(1 * time.Second)
-		pendingAllocations := 0
-		allocations, _, err := nomadClient.Allocations().List(nil)
+		queryOptions.WaitIndex = index
+		allocations, meta, err := nomadClient.Jobs().Allocations(allocation.JobID, false, queryOptions)
 		if err != nil {
+			logger.Errorf("Could not read allocations for job %s: %s", allocation.JobID, err)
+			time.Sleep(1 * time.Second)
 			continue
 		}
+		index = meta.LastIndex
+
+		pendingAllocations := 0
 		for _, allocation := range allocations {
-			if allocation.JobID == JobID {
-				if allocation.ClientStatus == nomadStructs.AllocClientStatusPending {
-					pendingAllocations++
-					log.Infof("Allocation %s for job %s is pending,  waiting for this to be resolved", allocation.ID, JobID)
-					break
-				}
-				for _, ts := range allocation.TaskStates {
-					if ts.State == nomadStructs.TaskStatePending {
-						pendingAllocations++
-						log.Infof("Allocation %s for job %s is pending,  waiting for this to be resolved", allocation.ID, JobID)
-						break
-					}
-				}
+			if isAllocationPending(allocation) {
+				pendingAllocations++
+				logger.Infof("Allocation %s for job %s is pending, waiting for this to be resolved", allocation.ID, allocation.JobID)
 			}
 		}
-		if pendingAllocations > 0 {
-			continue
+
+		if pendingAllocations == 0 {
+			break
 		}
-		break
 	}
 
-	log.Infof("All allocations for job %s are not pending anymore", JobID)
+	logger.Infof("All allocations for job %s are not pending anymore", allocation.JobID)
+
+	logger.Infof("Job %s was successfully moved!", allocation.JobID)
+}
+
+func isAllocationPending(allocation *api.AllocationListStub) bool {
+	if allocation.DesiredStatus != nomadStructs.AllocDesiredStatusRun {
+		return false
+	}
+
+	if allocation.ClientStatus == nomadStructs.AllocClientStatusPending {
+		return true
+	}
+
+	for _, ts := range allocation.TaskStates {
+		if ts.State == nomadStructs.TaskStatePending {
+			return true
+		}
+	}
 
-	log.Infof("Job %s was successfully moved!", JobID)
+	return false
 }
 
 func moveJobTaskGroup(nodeAllocation *api.Allocation, newConstraint *api.Constraint, nomadClient *api.Client) (string, error) {
@@ -266,11 +287,11 @@ func stopAllocation(nomadClient *api.Client, nodeAllocation *api.Allocation) (st
 	return stopResponse.EvalID, err
 }
 
-func monitor(ctx context.Context, client *api.Client, node *api.Node, wg *sync.WaitGroup) {
+func monitor(ctx context.Context, logger *log.Logger, client *api.Client, node *api.Node, wg *sync.WaitGroup) {
 	wg.Add(1)
 	defer wg.Done()
 
-	logger := log.WithField("node", node.Name)
+	entry := logger.WithField("node", node.Name)
 	ch := client.Nodes().MonitorDrain(ctx, node.ID, 0, false)
 	for {
 		select {
@@ -281,16 +302,16 @@ func monitor(ctx context.Context, client *api.Client, node *api.Node, wg *sync.W
 
 			switch m.Level {
 			case api.MonitorMsgLevelNormal:
-				logger.Info(m.String())
+				entry.Info(m.String())
 
 			case api.MonitorMsgLevelInfo:
-				logger.Info(m.String())
+				entry.Info(m.String())
 
 			case api.MonitorMsgLevelWarn:
-				logger.Warn(m.String())
+				entry.Warn(m.String())
 
 			case api.MonitorMsgLevelError:
-				logger.Error(m.String())
+				entry.Error(m.String())
 			}
 
 		}
@@ -0,0 +1,256 @@
+package node
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	nomadStructs "github.com/hashicorp/nomad/nomad/structs"
+	log "github.com/sirupsen/logrus"
+)
+
+// migrateWaitTime is the longest a single blocking query will wait for a change
+// before we re-check the allocation ourselves (e.g. for min_healthy_time to pass)
+const migrateWaitTime = 10 * time.Second
+
+// migrateGroup is all the allocations of a single job task group running on a
+// node, together with the migrate strategy configured for that group
+type migrateGroup struct {
+	namespace   string
+	jobID       string
+	taskGroup   string
+	strategy    *api.MigrateStrategy
+	allocations []*api.Allocation
+}
+
+func (g *migrateGroup) String() string {
+	return fmt.Sprintf("%s/%s", g.jobID, g.taskGroup)
+}
+
+// newMigrateGroups groups allocations by job task group, reading the migrate
+// strategy from the job embedded in the allocation
+func newMigrateGroups(allocations []*api.Allocation) []*migrateGroup {
+	groups := make(map[string]*migrateGroup)
+
+	for _, allocation := range allocations {
+		key := fmt.Sprintf("%s/%s/%s", allocation.Namespace, allocation.JobID, allocation.TaskGroup)
+
+		group, ok := groups[key]
+		if !ok {
+			strategy := api.DefaultMigrateStrategy()
+			if taskGroup := allocation.Job.LookupTaskGroup(allocation.TaskGroup); taskGroup != nil && taskGroup.Migrate != nil {
+				strategy = taskGroup.Migrate
+				strategy.Canonicalize()
+			}
+
+			group = &migrateGroup{
+				namespace: allocation.Namespace,
+				jobID:     allocation.JobID,
+				taskGroup: allocation.TaskGroup,
+				strategy:  strategy,
+			}
+			groups[key] = group
+		}
+
+		group.allocations = append(group.allocations, allocation)
+	}
+
+	result := make([]*migrateGroup, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, group)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].String() < result[j].String()
+	})
+
+	return result
+}
+
+// migrateAllocations moves the allocations off a node one task group at a time,
+// never stopping more than the group's migrate max_parallel allocations before
+// their replacements are healthy. Task groups are migrated concurrently, just
+// like a regular Nomad drain would do.
+func migrateAllocations(nomadClient *api.Client, allocations []*api.Allocation, logger *log.Entry) error {
+	groups := newMigrateGroups(allocations)
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(groups))
+
+	for i, group := range groups {
+		wg.Add(1)
+
+		go func(i int, group *migrateGroup) {
+			defer wg.Done()
+			errs[i] = group.migrate(nomadClient, logger.WithField("group", group.String()))
+		}(i, group)
+	}
+
+	wg.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			logger.Errorf("Could not migrate %s: %s", groups[i], err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d task groups could not be migrated", failed, len(groups))
+	}
+
+	return nil
+}
+
+// migrate stops the group allocations in batches of max_parallel, waiting for
+// every replacement in a batch to become healthy before starting the next one
+func (g *migrateGroup) migrate(nomadClient *api.Client, logger *log.Entry) error {
+	batches := g.batches()
+
+	logger.Infof("Migrating %d allocations in %d batches", len(g.allocations), len(batches))
+
+	for _, batch := range batches {
+		var wg sync.WaitGroup
+		errs := make([]error, len(batch))
+
+		for i, allocation := range batch {
+			wg.Add(1)
+
+			go func(i int, allocation *api.Allocation) {
+				defer wg.Done()
+				errs[i] = g.migrateAllocation(nomadClient, allocation, logger.WithField("alloc", allocation.ID[0:8]))
+			}(i, allocation)
+		}
+
+		wg.Wait()
+
+		// Don't touch the remaining allocations if a replacement did not become healthy
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	logger.Info("All allocations migrated")
+	return nil
+}
+
+// batches splits the group allocations in batches of max_parallel, at least one at a time
+func (g *migrateGroup) batches() [][]*api.Allocation {
+	maxParallel := 1
+	if g.strategy != nil && g.strategy.MaxParallel != nil && *g.strategy.MaxParallel > 1 {
+		maxParallel = *g.strategy.MaxParallel
+	}
+
+	batches := make([][]*api.Allocation, 0, (len(g.allocations)+maxParallel-1)/maxParallel)
+	for start := 0; start < len(g.allocations); start += maxParallel {
+		end := start + maxParallel
+		if end > len(g.allocations) {
+			end = len(g.allocations)
+		}
+
+		batches = append(batches, g.allocations[start:end])
+	}
+
+	return batches
+}
+
+func (g *migrateGroup) migrateAllocation(nomadClient *api.Client, allocation *api.Allocation, logger *log.Entry) error {
+	deadline := time.Now().Add(*g.strategy.HealthyDeadline)
+
+	logger.Info("Stopping allocation")
+	if _, err := stopAllocation(nomadClient, allocation); err != nil {
+		return err
+	}
+
+	// The stopped allocation points to its replacement once the scheduler placed it
+	stopped, err := watchAllocation(nomadClient, allocation.ID, g.namespace, deadline, func(a *api.Allocation) (bool, error) {
+		return a.NextAllocation != "", nil
+	})
+	if err != nil {
+		return fmt.Errorf("no replacement placed for allocation %s: %s", allocation.ID, err)
+	}
+
+	logger.Infof("Replacement allocation %s placed, waiting for it to become healthy", stopped.NextAllocation)
+
+	_, err = watchAllocation(nomadClient, stopped.NextAllocation, g.namespace, deadline, func(a *api.Allocation) (bool, error) {
+		return isAllocationHealthy(a, *g.strategy.MinHealthyTime)
+	})
+	if err != nil {
+		return fmt.Errorf("replacement allocation %s did not become healthy: %s", stopped.NextAllocation, err)
+	}
+
+	logger.Infof("Replacement allocation %s is healthy", stopped.NextAllocation)
+	return nil
+}
+
+// watchAllocation uses blocking queries on a single allocation until done
+// returns true, done returns an error or the deadline is reached
+func watchAllocation(nomadClient *api.Client, allocID, namespace string, deadline time.Time, done func(*api.Allocation) (bool, error)) (*api.Allocation, error) {
+	var index uint64
+
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("deadline exceeded")
+		}
+
+		wait := migrateWaitTime
+		if remaining < wait {
+			wait = remaining
+		}
+
+		allocation, meta, err := nomadClient.Allocations().Info(allocID, &api.QueryOptions{
+			Namespace: namespace,
+			WaitIndex: index,
+			WaitTime:  wait,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := done(allocation)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return allocation, nil
+		}
+
+		index = meta.LastIndex
+	}
+}
+
+// isAllocationHealthy prefers the health reported by the Nomad client (set for
+// both deployments and migrations), and falls back to all tasks having been
+// running for at least minHealthyTime
+func isAllocationHealthy(allocation *api.Allocation, minHealthyTime time.Duration) (bool, error) {
+	if allocation.ClientTerminalStatus() {
+		return false, fmt.Errorf("allocation is %s", allocation.ClientStatus)
+	}
+
+	if status := allocation.DeploymentStatus; status != nil && status.Healthy != nil {
+		if !*status.Healthy {
+			return false, fmt.Errorf("allocation is unhealthy")
+		}
+
+		return true, nil
+	}
+
+	if allocation.ClientStatus != nomadStructs.AllocClientStatusRunning {
+		return false, nil
+	}
+
+	for _, state := range allocation.TaskStates {
+		if state.State != nomadStructs.TaskStateRunning || time.Since(state.StartedAt) < minHealthyTime {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,139 @@
+package node
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestNewMigrateGroups(t *testing.T) {
+	maxParallel := 3
+	job := &api.Job{
+		TaskGroups: []*api.TaskGroup{
+			{Name: stringPtr("web"), Migrate: &api.MigrateStrategy{MaxParallel: &maxParallel}},
+			{Name: stringPtr("api")},
+		},
+	}
+
+	allocations := []*api.Allocation{
+		{ID: "1", Namespace: "default", JobID: "app", TaskGroup: "web", Job: job},
+		{ID: "2", Namespace: "default", JobID: "app", TaskGroup: "api", Job: job},
+		{ID: "3", Namespace: "default", JobID: "app", TaskGroup: "web", Job: job},
+		{ID: "4", Namespace: "other", JobID: "app", TaskGroup: "web", Job: job},
+	}
+
+	groups := newMigrateGroups(allocations)
+
+	got := make(map[string][]string)
+	parallel := make(map[string]int)
+	for _, group := range groups {
+		key := group.namespace + "/" + group.String()
+		for _, allocation := range group.allocations {
+			got[key] = append(got[key], allocation.ID)
+		}
+		parallel[key] = *group.strategy.MaxParallel
+	}
+
+	want := map[string][]string{"default/app/api": {"2"}, "default/app/web": {"1", "3"}, "other/app/web": {"4"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got groups %v, want %v", got, want)
+	}
+
+	wantParallel := map[string]int{"default/app/api": 1, "default/app/web": 3, "other/app/web": 3}
+	if !reflect.DeepEqual(parallel, wantParallel) {
+		t.Errorf("got max_parallel %v, want %v", parallel, wantParallel)
+	}
+}
+
+func TestMigrateGroupBatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		allocations int
+		maxParallel *int
+		want        []int
+	}{
+		{name: "one at a time", allocations: 3, maxParallel: intPtr(1), want: []int{1, 1, 1}},
+		{name: "uneven last batch", allocations: 5, maxParallel: intPtr(2), want: []int{2, 2, 1}},
+		{name: "more parallel than allocations", allocations: 2, maxParallel: intPtr(10), want: []int{2}},
+		{name: "zero is one at a time", allocations: 2, maxParallel: intPtr(0), want: []int{1, 1}},
+		{name: "unset is one at a time", allocations: 2, maxParallel: nil, want: []int{1, 1}},
+		{name: "no allocations", allocations: 0, maxParallel: intPtr(2), want: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := &migrateGroup{strategy: &api.MigrateStrategy{MaxParallel: tt.maxParallel}}
+			for i := 0; i < tt.allocations; i++ {
+				group.allocations = append(group.allocations, &api.Allocation{})
+			}
+
+			got := make([]int, 0)
+			for _, batch := range group.batches() {
+				got = append(got, len(batch))
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got batch sizes %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsAllocationHealthy(t *testing.T) {
+	healthy, unhealthy := true, false
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		allocation *api.Allocation
+		want       bool
+		wantErr    bool
+	}{
+		{
+			name:       "failed",
+			allocation: &api.Allocation{ClientStatus: "failed"},
+			wantErr:    true,
+		},
+		{
+			name:       "healthy according to the client",
+			allocation: &api.Allocation{ClientStatus: "running", DeploymentStatus: &api.AllocDeploymentStatus{Healthy: &healthy}},
+			want:       true,
+		},
+		{
+			name:       "unhealthy according to the client",
+			allocation: &api.Allocation{ClientStatus: "running", DeploymentStatus: &api.AllocDeploymentStatus{Healthy: &unhealthy}},
+			wantErr:    true,
+		},
+		{
+			name:       "pending",
+			allocation: &api.Allocation{ClientStatus: "pending"},
+		},
+		{
+			name:       "running for less than min_healthy_time",
+			allocation: &api.Allocation{ClientStatus: "running", TaskStates: map[string]*api.TaskState{"app": {State: "running", StartedAt: now.Add(-5 * time.Second)}}},
+		},
+		{
+			name:       "running for longer than min_healthy_time",
+			allocation: &api.Allocation{ClientStatus: "running", TaskStates: map[string]*api.TaskState{"app": {State: "running", StartedAt: now.Add(-time.Minute)}}},
+			want:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := isAllocationHealthy(tt.allocation, 10*time.Second)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func stringPtr(s string) *string { return &s }
+
+func intPtr(i int) *int { return &i }
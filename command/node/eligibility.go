@@ -5,6 +5,7 @@ import (
 
 	"github.com/hashicorp/nomad/api"
 	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli"
 )
@@ -15,11 +16,13 @@ func Eligibility(c *cli.Context, logger *log.Logger) error {
 		return fmt.Errorf("Ethier the '-enable' or '-disable' flag must be set")
 	}
 
-	nomadClient, err := api.NewClient(api.DefaultConfig())
-	if err != nil {
-		return err
-	}
+	return nomad.InRegions(c, logger, func(nomadClient *api.Client, _ string) error {
+		return toggleEligibility(c, nomadClient, logger)
+	})
+}
 
+// toggleEligibility changes the scheduling eligibility of the nodes matching the filters, in a single region
+func toggleEligibility(c *cli.Context, nomadClient *api.Client, logger *log.Logger) error {
 	filters := helpers.ClientFilterFromCLI(c.Parent())
 
 	matches, err := helpers.FilteredClientList(nomadClient, false, filters, logger)
@@ -28,18 +31,18 @@ func Eligibility(c *cli.Context, logger *log.Logger) error {
 	}
 
 	for _, node := range matches {
-		log.Infof("Node %s (class: %s / version: %s)", node.Name, node.NodeClass, node.Attributes["nomad.version"])
+		logger.Infof("Node %s (class: %s / version: %s)", node.Name, node.NodeClass, node.Attributes["nomad.version"])
 
 		_, err := nomadClient.Nodes().ToggleEligibility(node.ID, c.Bool("enable"), nil)
 		if err != nil {
-			log.Errorf("Error updating scheduling eligibility for %s: %s", node.Name, err)
+			logger.Errorf("Error updating scheduling eligibility for %s: %s", node.Name, err)
 			continue
 		}
 
 		if c.Bool("enable") {
-			log.Infof("Node %q scheduling eligibility set: eligible for scheduling", node.ID)
+			logger.Infof("Node %q scheduling eligibility set: eligible for scheduling", node.ID)
 		} else {
-			log.Infof("Node %q scheduling eligibility set: ineligible for scheduling", node.ID)
+			logger.Infof("Node %q scheduling eligibility set: ineligible for scheduling", node.ID)
 		}
 	}
 
@@ -3,7 +3,9 @@ package node
 import (
 	"fmt"
 
+	"github.com/hashicorp/nomad/api"
 	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli"
 )
@@ -19,24 +21,50 @@ func EmptyCLI(c *cli.Context, logger *log.Logger) error {
 
 	filters := helpers.ClientFilterFromCLI(c.Parent())
 
-	// Collect Node data from the Nomad cluster
-	nodes, err := getData(filters, logger, !c.BoolT("no-progress"))
+	clusters, err := nomad.ClustersFromCLI(c.Parent())
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	emptyNodes, err := filterForEmpty(nodes)
+	clusters, err = nomad.RegionsFromCLI(c.Parent(), clusters)
 	if err != nil {
 		return err
 	}
 
+	// Create a prop reader for results
+	propReader := helpers.NewMetaPropReader(fields...)
+
+	var emptyNodes []*api.Node
+	if len(clusters) > 0 {
+		// Collect the empty nodes from all the selected clusters
+		data, err := getClustersData(clusters, filters, logger, filterForEmpty)
+		if err != nil {
+			return err
+		}
+
+		emptyNodes, propReader = flattenClusterNodes(data, propReader, logger)
+	} else {
+		nomadClient, err := nomad.NewNomadClientFromCLI(c)
+		if err != nil {
+			return err
+		}
+
+		// Collect Node data from the Nomad cluster
+		nodes, err := getData(filters, logger, !c.BoolT("no-progress"))
+		if err != nil {
+			return err
+		}
+
+		emptyNodes, err = filterForEmpty(nomadClient, nodes)
+		if err != nil {
+			return err
+		}
+	}
+
 	if len(emptyNodes) == 0 {
 		return fmt.Errorf("Found no empty nodes")
 	}
 
-	// Create a prop reader for results
-	propReader := helpers.NewMetaPropReader(fields...)
-
 	res, err := listResponse(c.String("output-format"), emptyNodes, propReader)
 	if err != nil {
 		return err
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -20,12 +21,17 @@ func EmptytWeb(logger *log.Logger, r *http.Request) (string, error) {
 	filters := helpers.ClientFilterFromWeb(r)
 
 	// Collect Node data from the Nomad cluster
-	nodes, err := getData(filters, logger, false)
+	nodes, err := getWebData(r, filters, logger)
 	if err != nil {
 		return "", err
 	}
 
-	emptyNodes, err := filterForEmpty(nodes)
+	nomadClient, err := nomad.NewNomadClientFromContext(r.Context())
+	if err != nil {
+		return "", err
+	}
+
+	emptyNodes, err := filterForEmpty(nomadClient, nodes)
 	if err != nil {
 		return "", err
 	}
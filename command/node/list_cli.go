@@ -2,11 +2,10 @@ package node
 
 import (
 	"fmt"
-	"io"
 
 	"github.com/hashicorp/nomad/api"
-	"github.com/olekukonko/tablewriter"
 	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli"
 )
@@ -22,47 +21,41 @@ func ListCLI(c *cli.Context, logger *log.Logger) error {
 
 	filters := helpers.ClientFilterFromCLI(c.Parent())
 
-	// Collect Node data from the Nomad cluster
-	nodes, err := getData(filters, logger, !c.BoolT("no-progress"))
+	clusters, err := nomad.ClustersFromCLI(c.Parent())
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	// Create a prop reader for results
-	propReader := helpers.NewMetaPropReader(fields...)
-
-	res, err := listResponse(c.String("output-format"), nodes, propReader)
+	clusters, err = nomad.RegionsFromCLI(c.Parent(), clusters)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(res)
-	return nil
-}
-
-func computeListTableStruct(nodes []*api.Node, reader helpers.PropReader) ([][]string, error) {
-	m := make([][]string, 0)
+	// Create a prop reader for results
+	propReader := helpers.NewMetaPropReader(fields...)
 
-	for _, node := range nodes {
-		names, err := reader.Read(node)
+	var nodes []*api.Node
+	if len(clusters) > 0 {
+		// Collect Node data from all the selected clusters
+		data, err := getClustersData(clusters, filters, logger, nil)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		m = append(m, names)
+		nodes, propReader = flattenClusterNodes(data, propReader, logger)
+	} else {
+		// Collect Node data from the Nomad cluster
+		nodes, err = getData(filters, logger, !c.BoolT("no-progress"))
+		if err != nil {
+			return err
+		}
 	}
 
-	return m, nil
-}
-
-func printListTable(m [][]string, reader helpers.PropReader, writer io.Writer) {
-	table := tablewriter.NewWriter(writer)
-	table.SetAutoMergeCells(false)
-	table.SetRowLine(true)
-
-	header := reader.GetKeys()
-	table.SetHeader(header)
-	table.AppendBulk(m)
+	res, err := listResponse(c.String("output-format"), nodes, propReader)
+	if err != nil {
+		return err
+	}
 
-	table.Render()
+	fmt.Println(res)
+	return nil
 }
@@ -20,7 +20,7 @@ func ListWeb(logger *log.Logger, r *http.Request) (string, error) {
 	filters := helpers.ClientFilterFromWeb(r)
 
 	// Collect Node data from the Nomad cluster
-	nodes, err := getData(filters, logger, false)
+	nodes, err := getWebData(r, filters, logger)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,160 @@
+package node
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+// nodeMetaRequest is the body of the Nomad dynamic node metadata endpoint, a nil value
+// removes the key from the node
+type nodeMetaRequest struct {
+	NodeID string
+	Meta   map[string]*string
+}
+
+// MetaSet sets dynamic meta keys on all nodes matching the filters
+func MetaSet(c *cli.Context, logger *log.Logger) error {
+	meta, err := parseMetaSet(c.Args())
+	if err != nil {
+		return err
+	}
+
+	return nomad.InRegions(c, logger, func(nomadClient *api.Client, _ string) error {
+		return applyMeta(c, nomadClient, meta, logger)
+	})
+}
+
+// MetaUnset removes dynamic meta keys from all nodes matching the filters
+func MetaUnset(c *cli.Context, logger *log.Logger) error {
+	meta, err := parseMetaUnset(c.Args())
+	if err != nil {
+		return err
+	}
+
+	return nomad.InRegions(c, logger, func(nomadClient *api.Client, _ string) error {
+		return applyMeta(c, nomadClient, meta, logger)
+	})
+}
+
+func parseMetaSet(args []string) (map[string]*string, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Missing meta to set, like 'maintenance-group=a'")
+	}
+
+	meta := make(map[string]*string, len(args))
+	for _, arg := range args {
+		split := strings.SplitN(arg, "=", 2)
+		if len(split) != 2 || split[0] == "" {
+			return nil, fmt.Errorf("Could not parse meta '%s' as 'key=value' pair", arg)
+		}
+
+		value := split[1]
+		meta[split[0]] = &value
+	}
+
+	return meta, nil
+}
+
+func parseMetaUnset(args []string) (map[string]*string, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Missing meta keys to unset")
+	}
+
+	meta := make(map[string]*string, len(args))
+	for _, arg := range args {
+		if arg == "" || strings.Contains(arg, "=") {
+			return nil, fmt.Errorf("Invalid meta key '%s', only pass the key to unset", arg)
+		}
+
+		meta[arg] = nil
+	}
+
+	return meta, nil
+}
+
+func applyMeta(c *cli.Context, nomadClient *api.Client, meta map[string]*string, logger *log.Logger) error {
+	// "node meta set" is nested one level deeper than the other node commands
+	nodeContext := c.Parent().Parent()
+
+	// noop is handled here, to report the changes for every node rather than only the matches
+	filters := helpers.ClientFilterFromCLI(nodeContext)
+	noop := filters.NOOP
+	filters.NOOP = false
+
+	matches, err := helpers.FilteredClientList(nomadClient, !nodeContext.Bool("no-progress"), filters, logger)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, node := range matches {
+		changes := metaChanges(node, meta)
+		if len(changes) == 0 {
+			logger.Infof("Node %s: meta is already up to date", node.Name)
+			continue
+		}
+
+		if noop {
+			logger.Infof("Node %s: would change %s", node.Name, strings.Join(changes, ", "))
+			continue
+		}
+
+		if err := writeNodeMeta(nomadClient, node.ID, meta); err != nil {
+			if strings.Contains(err.Error(), "404") {
+				err = fmt.Errorf("%s (dynamic node meta requires Nomad 1.5 or newer on the client)", err)
+			}
+
+			logger.Errorf("Node %s: could not update meta: %s", node.Name, err)
+			failed++
+			continue
+		}
+
+		logger.Infof("Node %s: changed %s", node.Name, strings.Join(changes, ", "))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("Could not update meta on %d of %d nodes", failed, len(matches))
+	}
+
+	return nil
+}
+
+// writeNodeMeta applies the meta changes to the node, like the Nomad NodeMeta.Apply client
+// does with a POST to the dynamic node metadata endpoint
+func writeNodeMeta(nomadClient *api.Client, nodeID string, meta map[string]*string) error {
+	_, err := nomad.Post(nomadClient, "/v1/client/metadata", nodeMetaRequest{NodeID: nodeID, Meta: meta}, nil, nil)
+	return err
+}
+
+// metaChanges describes the changes meta makes to the node, like "key: old -> new"
+func metaChanges(node *api.Node, meta map[string]*string) []string {
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changes := make([]string, 0)
+	for _, key := range keys {
+		current, exists := node.Meta[key]
+
+		switch value := meta[key]; {
+		case value == nil && exists:
+			changes = append(changes, fmt.Sprintf("%s: %q -> unset", key, current))
+		case value == nil:
+		case !exists:
+			changes = append(changes, fmt.Sprintf("%s: unset -> %q", key, *value))
+		case current != *value:
+			changes = append(changes, fmt.Sprintf("%s: %q -> %q", key, current, *value))
+		}
+	}
+
+	return changes
+}
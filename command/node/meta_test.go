@@ -0,0 +1,97 @@
+package node
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/nomad"
+)
+
+func TestMetaChanges(t *testing.T) {
+	node := &api.Node{Meta: map[string]string{"pool": "a", "zone": "x"}}
+	value := func(s string) *string { return &s }
+
+	tests := []struct {
+		name string
+		meta map[string]*string
+		want []string
+	}{
+		{
+			name: "already set",
+			meta: map[string]*string{"pool": value("a")},
+			want: []string{},
+		},
+		{
+			name: "changed and new keys",
+			meta: map[string]*string{"pool": value("b"), "canary": value("true")},
+			want: []string{`canary: unset -> "true"`, `pool: "a" -> "b"`},
+		},
+		{
+			name: "unset existing and missing keys",
+			meta: map[string]*string{"zone": nil, "missing": nil},
+			want: []string{`zone: "x" -> unset`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := metaChanges(node, tt.meta); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMeta(t *testing.T) {
+	if _, err := parseMetaSet([]string{"pool=a", "url=http://x?a=b"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	for _, args := range [][]string{nil, {"pool"}, {"=a"}} {
+		if _, err := parseMetaSet(args); err == nil {
+			t.Errorf("expected an error setting %q", args)
+		}
+	}
+
+	for _, args := range [][]string{nil, {"pool=a"}} {
+		if _, err := parseMetaUnset(args); err == nil {
+			t.Errorf("expected an error unsetting %q", args)
+		}
+	}
+}
+
+func TestWriteNodeMeta(t *testing.T) {
+	var method, path, body, override string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body, override = r.Method, r.URL.Path, strings.TrimSpace(string(data)), r.Header.Get("X-Nomad-Helper-Method")
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("NOMAD_ADDR", server.URL)
+	client, err := nomad.NewNomadClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := "a"
+	if err := writeNodeMeta(client, "node-1", map[string]*string{"pool": &value, "zone": nil}); err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodPost || path != "/v1/client/metadata" {
+		t.Errorf("got %s %s, want POST /v1/client/metadata", method, path)
+	}
+	if want := `{"NodeID":"node-1","Meta":{"pool":"a","zone":null}}`; body != want {
+		t.Errorf("got body %s, want %s", body, want)
+	}
+	if override != "" {
+		t.Errorf("the method header was sent to Nomad")
+	}
+}
@@ -0,0 +1,293 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	nomadStructs "github.com/hashicorp/nomad/nomad/structs"
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+// nodeIneligibleEventPrefix matches the node event Nomad emits when a node is marked ineligible
+const nodeIneligibleEventPrefix = "Node marked as ineligible"
+
+// reapAction is what happens to a node once it has been idle for long enough
+type reapAction interface {
+	Reap(node *api.Node) error
+	String() string
+}
+
+// reapCandidate is a drained or ineligible node without any non-system allocations
+type reapCandidate struct {
+	node      *api.Node
+	idleSince time.Time
+}
+
+func Reap(c *cli.Context, logger *log.Logger) error {
+	minIdle := c.Duration("min-idle")
+	maxNodes := c.Int("max-nodes")
+	if maxNodes < 1 {
+		return fmt.Errorf("--max-nodes must be at least 1")
+	}
+
+	return nomad.InRegions(c, logger, func(nomadClient *api.Client, _ string) error {
+		return reapNodes(c, logger, nomadClient, minIdle, maxNodes)
+	})
+}
+
+// reapNodes reaps the idle nodes matching the filters, in a single region
+func reapNodes(c *cli.Context, logger *log.Logger, nomadClient *api.Client, minIdle time.Duration, maxNodes int) error {
+	action, err := newReapAction(c, nomadClient)
+	if err != nil {
+		return err
+	}
+
+	filters := helpers.ClientFilterFromCLI(c.Parent())
+
+	matches, err := helpers.FilteredClientList(nomadClient, !c.BoolT("no-progress"), filters, logger)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	candidates := make([]*reapCandidate, 0)
+	for _, node := range matches {
+		if !node.Drain && node.SchedulingEligibility != nomadStructs.NodeSchedulingIneligible {
+			logger.Debugf("Node %s is neither drained nor ineligible", node.Name)
+			continue
+		}
+
+		allocations, _, err := nomadClient.Nodes().Allocations(node.ID, nil)
+		if err != nil {
+			logger.Errorf("Could not read allocations for %s: %s", node.Name, err)
+			continue
+		}
+
+		candidate, reason := newReapCandidate(node, allocations, minIdle, now)
+		if candidate == nil {
+			logger.Infof("Node %s %s, skipping", node.Name, reason)
+			continue
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	if len(candidates) == 0 {
+		logger.Info("Found no nodes to reap")
+		return nil
+	}
+
+	if len(candidates) > maxNodes {
+		logger.Infof("Found %d nodes to reap, only %d will be reaped in this run", len(candidates), maxNodes)
+	}
+	candidates = longestIdle(candidates, maxNodes)
+
+	failed := 0
+	for _, candidate := range candidates {
+		node := candidate.node
+		logger.Infof("Node %s (class: %s / idle since: %s) will be reaped with action %s", node.Name, node.NodeClass, candidate.idleSince.Format(time.RFC3339), action)
+
+		if c.Bool("dry") {
+			logger.Infof("Skipping reaping node %s because dry flag was provided", node.Name)
+			continue
+		}
+
+		if err := action.Reap(node); err != nil {
+			logger.Errorf("Could not reap node %s: %s", node.Name, err)
+			failed++
+			continue
+		}
+
+		logger.Infof("Node %s was successfully reaped!", node.Name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to reap %d of %d nodes", failed, len(candidates))
+	}
+
+	return nil
+}
+
+// newReapCandidate finds the point in time the node became idle, and returns nil with the
+// reason when the node can't be reaped yet: it still has non-system allocations that are
+// not terminal, it has not been idle for minIdle, or it's unknown since when it is idle
+func newReapCandidate(node *api.Node, allocations []*api.Allocation, minIdle time.Duration, now time.Time) (*reapCandidate, string) {
+	idleSince := nodeUnschedulableSince(node)
+
+	// Nomad only keeps the last few node events, without them the node may have become
+	// ineligible seconds ago
+	if idleSince.IsZero() {
+		return nil, "has no drain or ineligible event to tell since when it is idle"
+	}
+
+	for _, allocation := range allocations {
+		if allocation.Job != nil && *allocation.Job.Type == nomadStructs.JobTypeSystem {
+			continue
+		}
+
+		if !allocation.ClientTerminalStatus() {
+			return nil, "still has running allocations"
+		}
+
+		if modified := time.Unix(0, allocation.ModifyTime); modified.After(idleSince) {
+			idleSince = modified
+		}
+	}
+
+	if idle := now.Sub(idleSince); idle < minIdle {
+		return nil, fmt.Sprintf("has only been idle for %s", idle.Round(time.Second))
+	}
+
+	return &reapCandidate{node: node, idleSince: idleSince}, ""
+}
+
+// longestIdle returns at most max candidates, the nodes that have been idle the longest first
+func longestIdle(candidates []*reapCandidate, max int) []*reapCandidate {
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].idleSince.Before(candidates[j].idleSince)
+	})
+
+	if len(candidates) > max {
+		return candidates[0:max]
+	}
+
+	return candidates
+}
+
+// nodeUnschedulableSince finds the last time the node was drained or marked ineligible,
+// or the zero time when the node has no drain or ineligible event left
+func nodeUnschedulableSince(node *api.Node) time.Time {
+	var since time.Time
+
+	if node.LastDrain != nil {
+		since = node.LastDrain.UpdatedAt
+	}
+
+	for _, event := range node.Events {
+		if strings.HasPrefix(event.Message, nodeIneligibleEventPrefix) && event.Timestamp.After(since) {
+			since = event.Timestamp
+		}
+	}
+
+	return since
+}
+
+func newReapAction(c *cli.Context, nomadClient *api.Client) (reapAction, error) {
+	switch c.String("action") {
+	case "none":
+		return noopReapAction{}, nil
+
+	case "purge":
+		return purgeReapAction{client: nomadClient}, nil
+
+	case "shell":
+		if c.String("shell-command") == "" {
+			return nil, fmt.Errorf("--action shell requires --shell-command")
+		}
+		return shellReapAction{command: c.String("shell-command")}, nil
+
+	case "webhook":
+		if c.String("webhook-url") == "" {
+			return nil, fmt.Errorf("--action webhook requires --webhook-url")
+		}
+		return webhookReapAction{url: c.String("webhook-url"), client: &http.Client{Timeout: 30 * time.Second}}, nil
+
+	default:
+		return nil, fmt.Errorf("Invalid action: %s", c.String("action"))
+	}
+}
+
+type noopReapAction struct{}
+
+func (a noopReapAction) String() string {
+	return "none"
+}
+
+func (a noopReapAction) Reap(node *api.Node) error {
+	return nil
+}
+
+// purgeReapAction removes the node from the Nomad cluster state
+type purgeReapAction struct {
+	client *api.Client
+}
+
+func (a purgeReapAction) String() string {
+	return "purge"
+}
+
+func (a purgeReapAction) Reap(node *api.Node) error {
+	_, _, err := a.client.Nodes().Purge(node.ID, nil)
+	return err
+}
+
+// shellReapAction runs a command with the node details exposed as environment variables
+type shellReapAction struct {
+	command string
+}
+
+func (a shellReapAction) String() string {
+	return fmt.Sprintf("shell (%s)", a.command)
+}
+
+func (a shellReapAction) Reap(node *api.Node) error {
+	cmd := exec.Command("sh", "-c", a.command)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"NOMAD_NODE_ID="+node.ID,
+		"NOMAD_NODE_NAME="+node.Name,
+		"NOMAD_NODE_CLASS="+node.NodeClass,
+		"NOMAD_NODE_DATACENTER="+node.Datacenter,
+		"NOMAD_NODE_IP="+node.Attributes["unique.network.ip-address"],
+	)
+
+	return cmd.Run()
+}
+
+// webhookReapAction POSTs the node details as JSON to an URL
+type webhookReapAction struct {
+	url    string
+	client *http.Client
+}
+
+func (a webhookReapAction) String() string {
+	return fmt.Sprintf("webhook (%s)", a.url)
+}
+
+func (a webhookReapAction) Reap(node *api.Node) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":         node.ID,
+		"name":       node.Name,
+		"class":      node.NodeClass,
+		"datacenter": node.Datacenter,
+		"address":    node.Attributes["unique.network.ip-address"],
+		"meta":       node.Meta,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := a.client.Post(a.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", strings.ToLower(resp.Status))
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestNodeUnschedulableSince(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		node *api.Node
+		want time.Time
+	}{
+		{
+			name: "no drain or events",
+			node: &api.Node{},
+			want: time.Time{},
+		},
+		{
+			name: "unrelated events only",
+			node: &api.Node{Events: []*api.NodeEvent{{Message: "Node registered", Timestamp: now}}},
+			want: time.Time{},
+		},
+		{
+			name: "last drain",
+			node: &api.Node{LastDrain: &api.DrainMetadata{UpdatedAt: now.Add(-time.Hour)}},
+			want: now.Add(-time.Hour),
+		},
+		{
+			name: "ineligible after the last drain",
+			node: &api.Node{
+				LastDrain: &api.DrainMetadata{UpdatedAt: now.Add(-time.Hour)},
+				Events: []*api.NodeEvent{
+					{Message: "Node marked as ineligible", Timestamp: now.Add(-2 * time.Hour)},
+					{Message: "Node marked as ineligible", Timestamp: now.Add(-time.Minute)},
+				},
+			},
+			want: now.Add(-time.Minute),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nodeUnschedulableSince(tt.node); !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewReapCandidate(t *testing.T) {
+	now := time.Now()
+	system, service := "system", "service"
+
+	drainedAt := func(d time.Duration) *api.Node {
+		return &api.Node{Name: "node", LastDrain: &api.DrainMetadata{UpdatedAt: now.Add(-d)}}
+	}
+	allocation := func(jobType, status string, modified time.Duration) *api.Allocation {
+		return &api.Allocation{Job: &api.Job{Type: &jobType}, ClientStatus: status, ModifyTime: now.Add(-modified).UnixNano()}
+	}
+
+	tests := []struct {
+		name        string
+		node        *api.Node
+		allocations []*api.Allocation
+		want        bool
+		wantIdle    time.Duration
+	}{
+		{
+			name: "unknown since when idle",
+			node: &api.Node{Name: "node"},
+		},
+		{
+			name:        "unknown since when idle with old allocations",
+			node:        &api.Node{Name: "node"},
+			allocations: []*api.Allocation{allocation(service, "complete", 48*time.Hour)},
+		},
+		{
+			name:     "idle for long enough",
+			node:     drainedAt(2 * time.Hour),
+			want:     true,
+			wantIdle: 2 * time.Hour,
+		},
+		{
+			name: "not idle for long enough",
+			node: drainedAt(time.Minute),
+		},
+		{
+			name:        "running allocations",
+			node:        drainedAt(2 * time.Hour),
+			allocations: []*api.Allocation{allocation(service, "running", 2*time.Hour)},
+		},
+		{
+			name:        "running system allocations are ignored",
+			node:        drainedAt(2 * time.Hour),
+			allocations: []*api.Allocation{allocation(system, "running", 2*time.Hour)},
+			want:        true,
+			wantIdle:    2 * time.Hour,
+		},
+		{
+			name:        "allocation stopped after the drain",
+			node:        drainedAt(3 * time.Hour),
+			allocations: []*api.Allocation{allocation(service, "complete", 90*time.Minute)},
+			want:        true,
+			wantIdle:    90 * time.Minute,
+		},
+		{
+			name:        "allocation stopped too recently",
+			node:        drainedAt(3 * time.Hour),
+			allocations: []*api.Allocation{allocation(service, "complete", time.Minute)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidate, reason := newReapCandidate(tt.node, tt.allocations, time.Hour, now)
+			if (candidate != nil) != tt.want {
+				t.Fatalf("got candidate %v (%s), want %v", candidate != nil, reason, tt.want)
+			}
+			if candidate == nil && reason == "" {
+				t.Errorf("expected a reason for skipping the node")
+			}
+			if candidate != nil && now.Sub(candidate.idleSince).Round(time.Second) != tt.wantIdle {
+				t.Errorf("got idle for %s, want %s", now.Sub(candidate.idleSince), tt.wantIdle)
+			}
+		})
+	}
+}
+
+func TestLongestIdle(t *testing.T) {
+	now := time.Now()
+	candidates := []*reapCandidate{
+		{node: &api.Node{Name: "b"}, idleSince: now.Add(-2 * time.Hour)},
+		{node: &api.Node{Name: "c"}, idleSince: now.Add(-time.Hour)},
+		{node: &api.Node{Name: "a"}, idleSince: now.Add(-3 * time.Hour)},
+	}
+
+	got := make([]string, 0)
+	for _, candidate := range longestIdle(candidates, 2) {
+		got = append(got, candidate.node.Name)
+	}
+
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("got %v, want [a b]", got)
+	}
+}
@@ -1,23 +1,16 @@
 package node
 
 import (
+	"net/http"
 	"strings"
 
 	"github.com/hashicorp/nomad/api"
 	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli"
 )
 
-func get(m []*result, name string) (*result, bool) {
-	for _, x := range m {
-		if (*x).Key == name {
-			return x, true
-		}
-	}
-	return nil, false
-}
-
 func getCLIArgs(c *cli.Context) []string {
 	input := helpers.DeleteEmpty(append([]string{c.Args().First()}, c.Args().Tail()...))
 
@@ -30,11 +23,25 @@ func getCLIArgs(c *cli.Context) []string {
 }
 
 func getData(filters helpers.ClientFilter, logger *log.Logger, progress bool) ([]*api.Node, error) {
-	nomadClient, err := api.NewClient(api.DefaultConfig())
+	nomadClient, err := nomad.NewNomadClient()
 	if err != nil {
 		return nil, err
 	}
 
+	return getDataFromClient(nomadClient, filters, logger, progress)
+}
+
+// getWebData is like getData, but queries Nomad with the token of the HTTP caller (if any)
+func getWebData(r *http.Request, filters helpers.ClientFilter, logger *log.Logger) ([]*api.Node, error) {
+	nomadClient, err := nomad.NewNomadClientFromContext(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	return getDataFromClient(nomadClient, filters, logger, false)
+}
+
+func getDataFromClient(nomadClient *api.Client, filters helpers.ClientFilter, logger *log.Logger, progress bool) ([]*api.Node, error) {
 	nodes, err := helpers.FilteredClientList(nomadClient, progress, filters, logger)
 	if err != nil {
 		return nil, err
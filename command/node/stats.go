@@ -37,10 +37,28 @@ func Stats(c *cli.Context) error {
 		flags = flags + fmt.Sprintf("--filter-eligibility=%+v ", value)
 	}
 
+	if value := c.StringSlice("filter-status"); len(value) > 0 {
+		for _, item := range value {
+			flags = flags + fmt.Sprintf("--filter-status=%+v ", item)
+		}
+	}
+
+	if c.Bool("all-statuses") {
+		flags = flags + "--all-statuses "
+	}
+
 	if value := c.Int("percent"); value != 100 {
 		flags = flags + fmt.Sprintf("--percent=%+v ", value)
 	}
 
+	if value := c.Int("count"); value > 0 {
+		flags = flags + fmt.Sprintf("--count=%+v ", value)
+	}
+
+	if value := c.String("spread-by"); len(value) > 0 {
+		flags = flags + fmt.Sprintf("--spread-by=%+v ", value)
+	}
+
 	if value := c.StringSlice("filter-meta"); len(value) > 0 {
 		for _, item := range value {
 			flags = flags + fmt.Sprintf("--filter-meta=%+v ", item)
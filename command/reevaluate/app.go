@@ -1,40 +1,234 @@
 package reevaluate
 
 import (
+	"context"
+	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
 	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
 )
 
-func App() error {
-	client, err := nomad.NewNomadClient()
+// Results of a forced evaluation
+const (
+	resultCompleted = "completed"
+	resultBlocked   = "blocked"
+	resultFailed    = "failed"
+	resultPending   = "pending"
+)
+
+// evaluation is a forced evaluation of a job, and what came of it
+type evaluation struct {
+	region      string
+	job         *api.JobListStub
+	id          string
+	result      string
+	description string
+}
+
+// App forces all jobs matching the filters to re-evaluate and reschedule their failed
+// allocations, then tracks every evaluation until it completes. With --region or
+// --all-regions this is done one region at a time
+func App(c *cli.Context, logger *log.Logger) error {
+	filter := helpers.JobFilterFromCLI(c)
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+
+	rate := c.Float64("rate")
+	if rate < 0 {
+		return fmt.Errorf("--rate must be 0 or more")
+	}
+
+	evaluations := make([]*evaluation, 0)
+	// the evaluations of the regions that did work are still reported when others failed
+	regionErr := nomad.InRegions(c, logger, func(client *api.Client, region string) error {
+		regionEvaluations, err := evaluateJobs(c, client, filter, rate, region, logger)
+		evaluations = append(evaluations, regionEvaluations...)
+		return err
+	})
+
+	if c.Bool("dry") {
+		return regionErr
+	}
+
+	withRegion := false
+	for _, eval := range evaluations {
+		withRegion = withRegion || eval.region != ""
+	}
+
+	keys := []string{"namespace", "job", "eval", "result", "description"}
+	if withRegion {
+		keys = append([]string{"region"}, keys...)
+	}
+
+	rows := make([][]string, 0, len(evaluations))
+	counts := make(map[string]int)
+	for _, eval := range evaluations {
+		row := []string{eval.job.Namespace, eval.job.ID, eval.id, eval.result, eval.description}
+		if withRegion {
+			row = append([]string{eval.region}, row...)
+		}
+
+		rows = append(rows, row)
+		counts[eval.result]++
+	}
+
+	res, err := helpers.RowsResponse(c.String("output-format"), keys, rows)
 	if err != nil {
 		return err
 	}
+	fmt.Println(res)
+
+	logger.Infof("%d evaluations: %d completed, %d blocked, %d failed, %d pending", len(evaluations), counts[resultCompleted], counts[resultBlocked], counts[resultFailed], counts[resultPending])
+
+	if regionErr != nil {
+		return regionErr
+	}
+
+	if counts[resultFailed] > 0 {
+		return fmt.Errorf("%d of %d evaluations failed", counts[resultFailed], len(evaluations))
+	}
+
+	return nil
+}
+
+// evaluateJobs forces the evaluation of the jobs matching the filters in a single region,
+// and waits for the evaluations unless --no-wait is used
+func evaluateJobs(c *cli.Context, client *api.Client, filter helpers.JobFilter, rate float64, region string, logger *log.Logger) ([]*evaluation, error) {
+	jobStubs, err := helpers.FilteredJobList(client, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// limit how fast evaluations are created, so the schedulers are not flooded
+	var throttle <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	jobStubs, _, err := client.Jobs().List(&api.QueryOptions{})
+	var wg sync.WaitGroup
+	evaluations := make([]*evaluation, 0, len(jobStubs))
 
 	for _, jobStub := range jobStubs {
-		if strings.Contains(jobStub.ID, "/periodic-") {
-			log.Infof("Skipping %s - periodic job", jobStub.Name)
+		if reason := skipReason(jobStub, filter); reason != "" {
+			logger.Infof("Skipping %s - %s", jobStub.ID, reason)
 			continue
 		}
 
-		if jobStub.Type == api.JobTypeBatch {
-			log.Infof("Skipping %s - batch job", jobStub.Name)
+		if c.Bool("dry") {
+			logger.Infof("Would evaluate %s", jobStub.ID)
 			continue
 		}
 
-		log.Infof("Evaluating %s", jobStub.Name)
-		evalID, _, err := client.Jobs().EvaluateWithOpts(jobStub.ID, api.EvalOptions{ForceReschedule: true}, nil)
+		if throttle != nil {
+			<-throttle
+		}
+
+		eval := &evaluation{region: region, job: jobStub}
+		evaluations = append(evaluations, eval)
+
+		eval.id, _, err = client.Jobs().EvaluateWithOpts(jobStub.ID, api.EvalOptions{ForceReschedule: true}, &api.WriteOptions{Namespace: jobStub.Namespace})
 		if err != nil {
-			log.Errorf("  %s", err)
+			logger.Errorf("Could not evaluate %s: %s", jobStub.ID, err)
+			eval.result = resultFailed
+			eval.description = err.Error()
+			continue
 		}
 
-		log.Infof("  OK - eval id %s", evalID)
+		logger.Infof("Evaluating %s - eval id %s", jobStub.ID, eval.id)
+
+		if c.Bool("no-wait") {
+			eval.result = resultPending
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			trackEvaluation(ctx, client, eval, logger)
+		}()
 	}
 
-	return nil
+	// the timeout starts once all evaluations are created, as the rate limit can take a while
+	timer := time.AfterFunc(c.Duration("timeout"), cancel)
+	defer timer.Stop()
+
+	wg.Wait()
+
+	return evaluations, nil
+}
+
+// skipReason tells why a job should not be re-evaluated, periodic job instances are always
+// skipped and batch jobs unless they are asked for with the type filter
+func skipReason(job *api.JobListStub, filter helpers.JobFilter) string {
+	if strings.Contains(job.ID, "/periodic-") {
+		return "periodic job"
+	}
+
+	if job.Type == api.JobTypeBatch && filter.Type != api.JobTypeBatch {
+		return "batch job"
+	}
+
+	if job.Stop {
+		return "stopped job"
+	}
+
+	return ""
+}
+
+// trackEvaluation waits for the evaluation to complete, or the context to be done
+func trackEvaluation(ctx context.Context, client *api.Client, eval *evaluation, logger *log.Logger) {
+	var index uint64
+	for {
+		info, meta, err := client.Evaluations().Info(eval.id, (&api.QueryOptions{Namespace: eval.job.Namespace, WaitIndex: index}).WithContext(ctx))
+		if ctx.Err() != nil {
+			eval.result = resultPending
+			eval.description = "still running when --timeout was reached"
+			return
+		}
+		if err != nil {
+			logger.Errorf("Could not read evaluation %s: %s", eval.id, err)
+			time.Sleep(time.Second)
+			continue
+		}
+		index = meta.LastIndex
+
+		if result, description, done := evaluationResult(info); done {
+			eval.result = result
+			eval.description = description
+			logger.Infof("Evaluation %s of %s %s", eval.id, eval.job.ID, result)
+			return
+		}
+	}
+}
+
+// evaluationResult maps the evaluation status to a result, a completed evaluation that
+// could not place every allocation created a blocked evaluation
+func evaluationResult(eval *api.Evaluation) (string, string, bool) {
+	switch eval.Status {
+	case "complete":
+		if eval.BlockedEval != "" {
+			return resultBlocked, fmt.Sprintf("blocked evaluation %s is waiting for capacity", eval.BlockedEval), true
+		}
+		return resultCompleted, "", true
+
+	case "blocked":
+		return resultBlocked, eval.StatusDescription, true
+
+	case "failed", "canceled":
+		return resultFailed, eval.StatusDescription, true
+	}
+
+	return "", "", false
 }
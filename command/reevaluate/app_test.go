@@ -0,0 +1,52 @@
+package reevaluate
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/helpers"
+)
+
+func TestSkipReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		job    *api.JobListStub
+		filter helpers.JobFilter
+		want   string
+	}{
+		{"service", &api.JobListStub{ID: "web", Type: "service"}, helpers.JobFilter{}, ""},
+		{"periodic instance", &api.JobListStub{ID: "cron/periodic-1665000000", Type: "batch"}, helpers.JobFilter{Type: "batch"}, "periodic job"},
+		{"batch", &api.JobListStub{ID: "import", Type: "batch"}, helpers.JobFilter{}, "batch job"},
+		{"batch asked for", &api.JobListStub{ID: "import", Type: "batch"}, helpers.JobFilter{Type: "batch"}, ""},
+		{"stopped", &api.JobListStub{ID: "old", Type: "service", Stop: true}, helpers.JobFilter{}, "stopped job"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := skipReason(tt.job, tt.filter); got != tt.want {
+				t.Errorf("skipReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluationResult(t *testing.T) {
+	tests := []struct {
+		eval   *api.Evaluation
+		result string
+		done   bool
+	}{
+		{&api.Evaluation{Status: "pending"}, "", false},
+		{&api.Evaluation{Status: "complete"}, resultCompleted, true},
+		{&api.Evaluation{Status: "complete", BlockedEval: "b1"}, resultBlocked, true},
+		{&api.Evaluation{Status: "blocked"}, resultBlocked, true},
+		{&api.Evaluation{Status: "failed"}, resultFailed, true},
+		{&api.Evaluation{Status: "canceled"}, resultFailed, true},
+	}
+
+	for _, tt := range tests {
+		if result, _, done := evaluationResult(tt.eval); result != tt.result || done != tt.done {
+			t.Errorf("evaluationResult(%s) = %q, %t, want %q, %t", tt.eval.Status, result, done, tt.result, tt.done)
+		}
+	}
+}
@@ -10,33 +10,69 @@ import (
 	"github.com/seatgeek/nomad-helper/nomad"
 	"github.com/seatgeek/nomad-helper/structs"
 	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
 	yaml "gopkg.in/yaml.v2"
 )
 
-func ExportCommand(file string) error {
-	log.Info("Reading jobs from Nomad")
+func ExportCommand(c *cli.Context, file string) error {
+	info := make(map[string]string)
+	info["nomad_addr"] = os.Getenv("NOMAD_ADDR")
+	info["exported_at"] = time.Now().UTC().Format(time.RFC1123Z)
+	info["exported_by"] = os.Getenv("USER")
+
+	state := &structs.NomadState{
+		Info: info,
+		Jobs: make(map[string]structs.TaskGroupState),
+	}
+
+	err := nomad.InRegions(c, log.StandardLogger(), func(client *api.Client, region string) error {
+		log.Info("Reading jobs from Nomad")
+
+		jobs, err := exportJobs(client)
+		if err != nil {
+			return err
+		}
 
-	client, err := nomad.NewNomadClient()
+		if region == "" {
+			state.Jobs = jobs
+			return nil
+		}
+
+		if state.Regions == nil {
+			state.Regions = make(map[string]map[string]structs.TaskGroupState)
+		}
+		state.Regions[region] = jobs
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	jobStubs, _, err := client.Jobs().List(&api.QueryOptions{})
+	bytes, err := yaml.Marshal(state)
+	if err != nil {
+		return err
+	}
 
+	err = ioutil.WriteFile(file, bytes, 0644)
 	if err != nil {
 		return err
 	}
 
-	info := make(map[string]string)
-	info["nomad_addr"] = os.Getenv("NOMAD_ADDR")
-	info["exported_at"] = time.Now().UTC().Format(time.RFC1123Z)
-	info["exported_by"] = os.Getenv("USER")
+	log.Info("Nomad state was successfully written out")
 
-	state := &structs.NomadState{
-		Info: info,
-		Jobs: make(map[string]structs.TaskGroupState),
+	return nil
+}
+
+// exportJobs reads the count of the groups of all service and system jobs
+func exportJobs(client *api.Client) (map[string]structs.TaskGroupState, error) {
+	jobStubs, _, err := client.Jobs().List(&api.QueryOptions{})
+
+	if err != nil {
+		return nil, err
 	}
 
+	jobs := make(map[string]structs.TaskGroupState)
+
 	for _, jobStub := range jobStubs {
 		log.Debugf("Scanning job %s", jobStub.Name)
 
@@ -63,20 +99,8 @@ func ExportCommand(file string) error {
 			jobState[*group.Name] = *group.Count
 		}
 
-		state.Jobs[*job.ID] = jobState
+		jobs[*job.ID] = jobState
 	}
 
-	bytes, err := yaml.Marshal(state)
-	if err != nil {
-		return err
-	}
-
-	err = ioutil.WriteFile(file, bytes, 0644)
-	if err != nil {
-		return err
-	}
-
-	log.Info("Nomad state was successfully written out")
-
-	return nil
+	return jobs, nil
 }
@@ -2,15 +2,17 @@ package scale
 
 import (
 	"io/ioutil"
+	"sort"
 
 	"github.com/hashicorp/nomad/api"
 	"github.com/seatgeek/nomad-helper/nomad"
 	"github.com/seatgeek/nomad-helper/structs"
 	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
 	yaml "gopkg.in/yaml.v2"
 )
 
-func ImportCommand(file string) error {
+func ImportCommand(c *cli.Context, file string) error {
 	log.Info("Reading state file")
 
 	data, err := ioutil.ReadFile(file)
@@ -24,13 +26,51 @@ func ImportCommand(file string) error {
 		return err
 	}
 
-	client, err := nomad.NewNomadClient()
-	if err != nil {
-		return err
+	logger := log.StandardLogger()
+
+	return nomad.InRegions(c, logger, func(client *api.Client, region string) error {
+		// a state exported per region only has the jobs of the selected region imported
+		if region != "" && len(localState.Regions) > 0 {
+			jobs, ok := localState.Regions[region]
+			if !ok {
+				logger.Warnf("The state has no jobs for region %s", region)
+				return nil
+			}
+
+			importJobs(client, jobs, logger)
+			return nil
+		}
+
+		Import(client, localState, logger)
+		return nil
+	})
+}
+
+// Import changes the count of the job groups in the cluster to the count in the state. A
+// state exported per region is imported into the same regions
+func Import(client *api.Client, localState *structs.NomadState, logger *log.Logger) {
+	if len(localState.Regions) == 0 {
+		importJobs(client, localState.Jobs, logger)
+		return
 	}
 
-	for localJobName, jobGroups := range localState.Jobs {
-		logger := log.WithField("job", localJobName)
+	regions := make([]string, 0, len(localState.Regions))
+	for region := range localState.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	for _, region := range regions {
+		logger.Infof("Importing region %s", region)
+		client.SetRegion(region)
+		importJobs(client, localState.Regions[region], logger.WithField("region", region))
+	}
+}
+
+// importJobs changes the count of the job groups in the cluster to the count of the jobs
+func importJobs(client *api.Client, jobs map[string]structs.TaskGroupState, logger log.FieldLogger) {
+	for localJobName, jobGroups := range jobs {
+		logger := logger.WithField("job", localJobName)
 
 		remoteJob, _, err := client.Jobs().Info(localJobName, &api.QueryOptions{})
 		if err != nil {
@@ -79,11 +119,9 @@ func ImportCommand(file string) error {
 		if shouldUpdate {
 			_, _, err = client.Jobs().Register(remoteJob, &api.WriteOptions{})
 			if err != nil {
-				log.Error(err)
+				logger.Error(err)
 				continue
 			}
 		}
 	}
-
-	return nil
 }
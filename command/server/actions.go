@@ -0,0 +1,220 @@
+package server
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/seatgeek/nomad-helper/command/job"
+	"github.com/seatgeek/nomad-helper/command/node"
+	"github.com/seatgeek/nomad-helper/command/scale"
+	"github.com/seatgeek/nomad-helper/nomad"
+	"github.com/seatgeek/nomad-helper/structs"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// commandAction runs a CLI command in the background, with the flags from the request parameters
+type commandAction func(c *cli.Context, logger *log.Logger) error
+
+// actionHandler starts the CLI command at path (like "node drain") as an operation. The
+// flags of the command and its parents (like the node filters) are read from the query
+// string or JSON body, the "args" parameter is used as the command arguments
+func actionHandler(a *cli.App, auth *auth, ops *operations, action commandAction, path ...string) http.HandlerFunc {
+	kind := strings.Join(path, " ")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.enabled() {
+			writeError(w, 403, codeForbidden, "Write endpoints require authentication, start the server with one of the --auth-* or --tls-client-ca flags")
+			return
+		}
+
+		params, err := requestParams(r)
+		if err != nil {
+			writeError(w, 400, codeInvalidRequest, err.Error())
+			return
+		}
+
+		args := params["args"]
+		delete(params, "args")
+
+		ctx, err := newCommandContext(a, nomad.TokenFromContext(r.Context()), params, args, path...)
+		if err != nil {
+			writeError(w, 400, codeInvalidRequest, err.Error())
+			return
+		}
+
+		op, err := ops.start(kind, func(logger *log.Logger) error {
+			return action(ctx, logger)
+		})
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+
+		writeJSON(w, 202, op.toStatus(false))
+	}
+}
+
+// scaleImportHandler imports the scale state (YAML or JSON, like "scale export" writes) from the request body
+func scaleImportHandler(auth *auth, ops *operations) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.enabled() {
+			writeError(w, 403, codeForbidden, "Write endpoints require authentication, start the server with one of the --auth-* or --tls-client-ca flags")
+			return
+		}
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, 400, codeInvalidRequest, err.Error())
+			return
+		}
+
+		state := &structs.NomadState{}
+		if err := yaml.Unmarshal(data, state); err != nil {
+			writeError(w, 400, codeInvalidRequest, fmt.Sprintf("Could not parse the scale state: %s", err))
+			return
+		}
+
+		nomadClient, err := nomad.NewNomadClientFromContext(r.Context())
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+
+		op, err := ops.start("scale import", func(logger *log.Logger) error {
+			scale.Import(nomadClient, state, logger)
+			return nil
+		})
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+
+		writeJSON(w, 202, op.toStatus(false))
+	}
+}
+
+func registerActions(r *mux.Router, prefix string, a *cli.App, auth *auth, ops *operations) {
+	r.HandleFunc(prefix+"/node/drain", actionHandler(a, auth, ops, node.Drain, "node", "drain")).Methods("POST")
+	r.HandleFunc(prefix+"/node/eligibility", actionHandler(a, auth, ops, node.Eligibility, "node", "eligibility")).Methods("POST")
+	r.HandleFunc(prefix+"/job/move", actionHandler(a, auth, ops, job.Move, "job", "move")).Methods("POST")
+	r.HandleFunc(prefix+"/scale/import", scaleImportHandler(auth, ops)).Methods("POST")
+	r.HandleFunc(prefix+"/operations/{id}", ops.statusHandler).Methods("GET")
+	r.HandleFunc(prefix+"/operations/{id}/events", ops.eventsHandler).Methods("GET")
+}
+
+// requestParams reads the parameters from the query string, and from the body for JSON
+// requests. JSON values can be strings, numbers, booleans or lists of those
+func requestParams(r *http.Request) (map[string][]string, error) {
+	params := make(map[string][]string)
+	for key, values := range r.URL.Query() {
+		params[key] = append(params[key], values...)
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		return params, nil
+	}
+
+	body := make(map[string]interface{})
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("Could not parse JSON body: %s", err)
+	}
+
+	for key, value := range body {
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+
+		for _, v := range values {
+			switch v.(type) {
+			case string, bool, float64:
+				params[key] = append(params[key], fmt.Sprintf("%v", v))
+			default:
+				return nil, fmt.Errorf("Invalid value for parameter '%s'", key)
+			}
+		}
+	}
+
+	return params, nil
+}
+
+// newCommandContext builds the CLI context for running the command at path, like the
+// CLI would have after parsing the same flags. The caller token (if any) is set as the
+// global --token flag, so the command queries Nomad with it
+func newCommandContext(a *cli.App, token string, params map[string][]string, args []string, path ...string) (*cli.Context, error) {
+	set := flag.NewFlagSet(a.Name, flag.ContinueOnError)
+	for _, f := range a.Flags {
+		f.Apply(set)
+	}
+	if token != "" {
+		if err := set.Set("token", token); err != nil {
+			return nil, err
+		}
+	}
+	ctx := cli.NewContext(a, set, nil)
+
+	used := make(map[string]bool)
+	commands := a.Commands
+	for i, name := range path {
+		command := findCommand(commands, name)
+		if command == nil {
+			return nil, fmt.Errorf("Unknown command '%s'", strings.Join(path[:i+1], " "))
+		}
+
+		set := flag.NewFlagSet(name, flag.ContinueOnError)
+		for _, f := range command.Flags {
+			f.Apply(set)
+		}
+
+		for key, values := range params {
+			if set.Lookup(key) == nil {
+				continue
+			}
+
+			for _, value := range values {
+				if err := set.Set(key, value); err != nil {
+					return nil, fmt.Errorf("Invalid value for parameter '%s': %s", key, err)
+				}
+			}
+			used[key] = true
+		}
+
+		var rest []string
+		if i == len(path)-1 {
+			rest = append([]string{"--"}, args...)
+		}
+		if err := set.Parse(rest); err != nil {
+			return nil, err
+		}
+
+		ctx = cli.NewContext(a, set, ctx)
+		ctx.Command = *command
+		commands = command.Subcommands
+	}
+
+	for key := range params {
+		if !used[key] {
+			return nil, fmt.Errorf("Unknown parameter '%s' for '%s'", key, strings.Join(path, " "))
+		}
+	}
+
+	return ctx, nil
+}
+
+func findCommand(commands []cli.Command, name string) *cli.Command {
+	for i := range commands {
+		if commands[i].HasName(name) {
+			return &commands[i]
+		}
+	}
+
+	return nil
+}
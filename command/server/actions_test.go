@@ -0,0 +1,92 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	cli "github.com/urfave/cli"
+)
+
+func TestNewCommandContext(t *testing.T) {
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "token"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "node",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "filter-class"},
+				cli.StringSliceFlag{Name: "filter-meta"},
+			},
+			Subcommands: []cli.Command{
+				{
+					Name: "drain",
+					Flags: []cli.Flag{
+						cli.BoolFlag{Name: "enable"},
+						cli.DurationFlag{Name: "deadline"},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		params  map[string][]string
+		args    []string
+		wantErr bool
+		check   func(t *testing.T, c *cli.Context)
+	}{
+		{
+			name:   "flags on the command and its parent",
+			params: map[string][]string{"enable": {"true"}, "deadline": {"10m"}, "filter-class": {"web"}, "filter-meta": {"a=b", "c=d"}},
+			args:   []string{"api"},
+			check: func(t *testing.T, c *cli.Context) {
+				if !c.Bool("enable") || c.Duration("deadline").String() != "10m0s" {
+					t.Errorf("command flags not set: enable=%v deadline=%s", c.Bool("enable"), c.Duration("deadline"))
+				}
+				if c.Parent().String("filter-class") != "web" {
+					t.Errorf("parent flag not set: %s", c.Parent().String("filter-class"))
+				}
+				if got := c.Parent().StringSlice("filter-meta"); !reflect.DeepEqual(got, []string{"a=b", "c=d"}) {
+					t.Errorf("parent slice flag not set: %v", got)
+				}
+				if c.Args().First() != "api" {
+					t.Errorf("args not set: %v", c.Args())
+				}
+				if c.GlobalString("token") != "secret" {
+					t.Errorf("token not set: %s", c.GlobalString("token"))
+				}
+			},
+		},
+		{
+			name:    "unknown parameter",
+			params:  map[string][]string{"purge": {"true"}},
+			wantErr: true,
+		},
+		{
+			name:    "global flags can't be set",
+			params:  map[string][]string{"token": {"other"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid value",
+			params:  map[string][]string{"deadline": {"soon"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newCommandContext(app, "secret", tt.params, tt.args, "node", "drain")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			if tt.check != nil {
+				tt.check(t, c)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/seatgeek/nomad-helper/helpers"
+	log "github.com/sirupsen/logrus"
+)
+
+// Error codes, returned in the "code" field of error responses
+const (
+	codeInvalidRequest   = "invalid_request"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeNomadError       = "nomad_error"
+	codeNomadUnavailable = "nomad_unavailable"
+	codeUnavailable      = "unavailable"
+	codeInternalError    = "internal_error"
+)
+
+// apiError is the body of all error responses
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// The Nomad API client doesn't have typed errors, only the status code in the message
+var nomadResponseCode = regexp.MustCompile(`Unexpected response code: (\d{3})`)
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiError{Code: code, Message: message})
+}
+
+// writeErr writes err with the status and code matching its cause: invalid input, a Nomad
+// error response, Nomad being unreachable or anything else
+func writeErr(w http.ResponseWriter, err error) {
+	status, code := errorStatus(err)
+	writeError(w, status, code, err.Error())
+}
+
+func errorStatus(err error) (int, string) {
+	if errors.Is(err, helpers.ErrInvalidInput) {
+		return http.StatusBadRequest, codeInvalidRequest
+	}
+
+	if m := nomadResponseCode.FindStringSubmatch(err.Error()); m != nil {
+		switch status, _ := strconv.Atoi(m[1]); status {
+		case http.StatusBadRequest:
+			return http.StatusBadRequest, codeInvalidRequest
+		case http.StatusForbidden:
+			return http.StatusForbidden, codeForbidden
+		case http.StatusNotFound:
+			return http.StatusNotFound, codeNotFound
+		default:
+			return http.StatusBadGateway, codeNomadError
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return http.StatusBadGateway, codeNomadUnavailable
+	}
+
+	return http.StatusInternalServerError, codeInternalError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(500)
+		w.Write([]byte(`{"code":"internal_error","message":"Could not encode the response"}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// negotiateFormat picks the output format of a response. An explicit output-format query
+// argument wins, otherwise the Accept header selects between json and table
+func negotiateFormat(r *http.Request, defaultFormat string) string {
+	if format := r.URL.Query().Get("output-format"); format != "" {
+		return format
+	}
+
+	best, bestQuality := "", 0.0
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		var format string
+		switch mediaType {
+		case "application/json", "application/*":
+			format = "json"
+		case "text/plain", "text/html", "text/*":
+			format = "table"
+		case "*/*":
+			format = defaultFormat
+		default:
+			continue
+		}
+
+		if quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+
+	if best == "" {
+		return defaultFormat
+	}
+
+	return best
+}
+
+func formatContentType(format string) string {
+	if format == "table" {
+		return "text/plain; charset=utf-8"
+	}
+
+	return "application/json"
+}
+
+// webFunc is the signature of the web functions in the command packages, which read the
+// fields from the request path and the output format from the output-format query argument
+type webFunc func(logger *log.Logger, r *http.Request) (string, error)
+
+// webHandler serves a web function, in the output format negotiated for the request
+func webHandler(defaultFormat string, fn webFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := negotiateFormat(r, defaultFormat)
+
+		query := r.URL.Query()
+		query.Set("output-format", format)
+		r.URL.RawQuery = query.Encode()
+
+		output, err := fn(log.New(), r)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", formatContentType(format))
+		w.WriteHeader(200)
+		w.Write([]byte(output))
+	}
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, codeNotFound, "Unknown path "+r.URL.Path)
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method "+r.Method+" is not allowed for "+r.URL.Path)
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/seatgeek/nomad-helper/helpers"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		accept string
+		want   string
+	}{
+		{name: "no preference", want: "default"},
+		{name: "any type", accept: "*/*", want: "default"},
+		{name: "json", accept: "application/json", want: "json"},
+		{name: "plain text", accept: "text/plain", want: "table"},
+		{name: "browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: "table"},
+		{name: "quality wins", accept: "text/plain;q=0.5, application/json", want: "json"},
+		{name: "unsupported types", accept: "application/xml", want: "default"},
+		{name: "query argument wins", query: "output-format=json-pretty", accept: "text/plain", want: "json-pretty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/node/list?"+tt.query, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			if got := negotiateFormat(r, "default"); got != tt.want {
+				t.Errorf("got format %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "invalid input",
+			err:        helpers.InvalidInputf("Invalid output-format: xml"),
+			wantStatus: 400,
+			wantCode:   codeInvalidRequest,
+		},
+		{
+			name:       "permission denied by Nomad",
+			err:        errors.New("Unexpected response code: 403 (Permission denied)"),
+			wantStatus: 403,
+			wantCode:   codeForbidden,
+		},
+		{
+			name:       "not found in Nomad",
+			err:        errors.New("Unexpected response code: 404 (alloc not found)"),
+			wantStatus: 404,
+			wantCode:   codeNotFound,
+		},
+		{
+			name:       "Nomad server error",
+			err:        errors.New("Unexpected response code: 500 (rpc error: No cluster leader)"),
+			wantStatus: 502,
+			wantCode:   codeNomadError,
+		},
+		{
+			name:       "Nomad unreachable",
+			err:        &url.Error{Op: "Get", URL: "http://127.0.0.1:4646/v1/nodes", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}},
+			wantStatus: 502,
+			wantCode:   codeNomadUnavailable,
+		},
+		{
+			name:       "anything else",
+			err:        errors.New("boom"),
+			wantStatus: 500,
+			wantCode:   codeInternalError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := errorStatus(tt.err)
+			if status != tt.wantStatus || code != tt.wantCode {
+				t.Errorf("got %d %s, want %d %s", status, code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestWebHandlerErrors(t *testing.T) {
+	handler := webHandler("json", func(logger *log.Logger, r *http.Request) (string, error) {
+		return "", helpers.InvalidInputf("Don't know how to find value for 'bogus'")
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/v1/node/list/bogus", nil))
+
+	if w.Code != 400 {
+		t.Errorf("got status %d, want 400", w.Code)
+	}
+
+	var body apiError
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body is not JSON: %s", err)
+	}
+	if body.Code != codeInvalidRequest || body.Message == "" {
+		t.Errorf("unexpected error body: %+v", body)
+	}
+}
+
+// Every path in the OpenAPI document must be served by the router
+func TestOpenAPIRoutes(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("invalid OpenAPI document: %s", err)
+	}
+
+	r := newRouter(cli.NewApp(), &auth{}, newOperations(log.New()), nil, newMetrics(), &health{}, log.New())
+	param := regexp.MustCompile(`\{[^}]+\}`)
+
+	for path, methods := range spec.Paths {
+		if !strings.HasPrefix(path, "/v1/") {
+			t.Errorf("%s is not versioned", path)
+		}
+
+		for method := range methods {
+			t.Run(fmt.Sprintf("%s %s", method, path), func(t *testing.T) {
+				req := httptest.NewRequest(strings.ToUpper(method), param.ReplaceAllString(path, "x"), nil)
+
+				var match mux.RouteMatch
+				if !r.Match(req, &match) || match.MatchErr != nil {
+					t.Errorf("no route for %s %s", method, path)
+				}
+			})
+		}
+	}
+}
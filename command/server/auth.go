@@ -0,0 +1,154 @@
+package server
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+const (
+	nomadTokenHeader = "X-Nomad-Token"
+	nomadTokenCookie = "nomad-token"
+)
+
+// auth authenticates the callers of the server. Without any auth configured all
+// requests are allowed, and Nomad is queried with the token of the server process
+type auth struct {
+	// nomadToken accepts the Nomad ACL token of the caller, and uses it for all Nomad queries
+	nomadToken bool
+
+	// bearerTokens are static tokens for service-to-service callers
+	bearerTokens []string
+
+	// clientCerts accepts callers with a client certificate signed by --tls-client-ca
+	clientCerts bool
+
+	logger *log.Logger
+}
+
+func newAuth(c *cli.Context, logger *log.Logger) *auth {
+	return &auth{
+		nomadToken:   c.Bool("auth-nomad-token"),
+		bearerTokens: helpers.DeleteEmpty(c.StringSlice("auth-bearer-token")),
+		clientCerts:  c.String("tls-client-ca") != "",
+		logger:       logger,
+	}
+}
+
+func (a *auth) enabled() bool {
+	return a.nomadToken || len(a.bearerTokens) > 0 || a.clientCerts
+}
+
+func (a *auth) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.enabled() || isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if token := requestNomadToken(r); a.nomadToken && token != "" {
+			if err := a.verifyNomadToken(token); err != nil {
+				a.logger.Warnf("Rejected Nomad token from %s: %s", r.RemoteAddr, err)
+				unauthorized(w, "Invalid Nomad ACL token")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(nomad.ContextWithToken(r.Context(), token)))
+			return
+		}
+
+		// Service-to-service callers use the Nomad token of the server process
+		if a.validBearerToken(r) || a.validClientCert(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		unauthorized(w, "Authentication required")
+	})
+}
+
+// verifyNomadToken makes sure the token is known to Nomad. This also rejects all tokens
+// when ACLs are disabled in Nomad, as they would give the caller full access
+func (a *auth) verifyNomadToken(token string) error {
+	nomadClient, err := nomad.NewNomadClient()
+	if err != nil {
+		return err
+	}
+	nomadClient.SetSecretID(token)
+
+	_, _, err = nomadClient.ACLTokens().Self(nil)
+	return err
+}
+
+func (a *auth) validBearerToken(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+
+	token := strings.TrimPrefix(header, "Bearer ")
+	for _, valid := range a.bearerTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(valid)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *auth) validClientCert(r *http.Request) bool {
+	return a.clientCerts && r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+// requestNomadToken reads the Nomad ACL token from the header, or from the cookie for browsers
+func requestNomadToken(r *http.Request) string {
+	if token := r.Header.Get(nomadTokenHeader); token != "" {
+		return token
+	}
+
+	if cookie, err := r.Cookie(nomadTokenCookie); err == nil {
+		return cookie.Value
+	}
+
+	return ""
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	writeError(w, http.StatusUnauthorized, codeUnauthorized, message)
+}
+
+// newTLSConfig verifies client certificates (if provided) against the --tls-client-ca
+func newTLSConfig(c *cli.Context) (*tls.Config, error) {
+	if c.String("tls-client-ca") == "" {
+		return nil, nil
+	}
+
+	if c.String("tls-cert") == "" || c.String("tls-key") == "" {
+		return nil, fmt.Errorf("--tls-client-ca requires --tls-cert and --tls-key")
+	}
+
+	pem, err := ioutil.ReadFile(c.String("tls-client-ca"))
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", c.String("tls-client-ca"))
+	}
+
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+	}, nil
+}
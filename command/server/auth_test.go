@@ -0,0 +1,143 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/seatgeek/nomad-helper/command/node"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    *auth
+		path    string
+		headers map[string]string
+		want    int
+	}{
+		{
+			name: "no auth configured",
+			auth: &auth{},
+			want: http.StatusOK,
+		},
+		{
+			name:    "valid bearer token",
+			auth:    &auth{bearerTokens: []string{"secret"}},
+			headers: map[string]string{"Authorization": "Bearer secret"},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "invalid bearer token",
+			auth:    &auth{bearerTokens: []string{"secret"}},
+			headers: map[string]string{"Authorization": "Bearer wrong"},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name: "missing credentials",
+			auth: &auth{nomadToken: true, bearerTokens: []string{"secret"}},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:    "nomad token is not a bearer token",
+			auth:    &auth{bearerTokens: []string{"secret"}},
+			headers: map[string]string{nomadTokenHeader: "secret"},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name: "client certificate without mTLS",
+			auth: &auth{clientCerts: true},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "the UI assets are public",
+			auth: &auth{bearerTokens: []string{"secret"}},
+			path: "/ui/app.js",
+			want: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.auth.logger = log.New()
+
+			handler := tt.auth.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			path := tt.path
+			if path == "" {
+				path = "/node/list"
+			}
+
+			r := httptest.NewRequest("GET", path, nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestNomadTokenNodeLookups(t *testing.T) {
+	nomadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/acl/token/self":
+			w.Write([]byte(`{"AccessorID":"accessor"}`))
+		case "/v1/nodes":
+			w.Write([]byte(`[{"ID":"node-1","Name":"node-1","Status":"ready","SchedulingEligibility":"eligible"}]`))
+		case "/v1/node/node-1":
+			if r.Header.Get(nomadTokenHeader) != "operator" {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte("Permission denied"))
+				return
+			}
+			w.Write([]byte(`{"ID":"node-1","Name":"node-1","Status":"ready","SchedulingEligibility":"eligible"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer nomadServer.Close()
+
+	t.Setenv("NOMAD_ADDR", nomadServer.URL)
+	t.Setenv("NOMAD_TOKEN", "")
+
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+
+	a := &auth{nomadToken: true, logger: logger}
+	handler := a.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := node.ListWeb(logger, r)
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		w.Write([]byte(res))
+	}))
+
+	// the node read with the first token must not be handed to the second one
+	for _, tt := range []struct {
+		token string
+		want  string
+	}{
+		{token: "operator", want: `[{"name":"node-1"}]`},
+		{token: "anonymous", want: `[]`},
+	} {
+		r := httptest.NewRequest("GET", "/name?output-format=json", nil)
+		r.Header.Set(nomadTokenHeader, tt.token)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("token %s: got %s, want %s", tt.token, got, tt.want)
+		}
+	}
+}
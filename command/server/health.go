@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/seatgeek/nomad-helper/nomad"
+)
+
+// readyTimeout is how long /readyz waits for Nomad
+const readyTimeout = 5 * time.Second
+
+// health serves the liveness and readiness checks. The server stops being ready when it
+// starts shutting down, so it's taken out of load balancing before the listener closes
+type health struct {
+	shuttingDown atomic.Bool
+}
+
+func (h *health) liveHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, 200, map[string]string{"status": "ok"})
+}
+
+// readyHandler checks that Nomad is reachable (with the token of the server) and has a leader
+func (h *health) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if h.shuttingDown.Load() {
+		writeError(w, 503, codeUnavailable, "The server is shutting down")
+		return
+	}
+
+	leader, err := nomadLeader(readyTimeout)
+	if err != nil {
+		writeError(w, 503, codeNomadUnavailable, fmt.Sprintf("Could not get the Nomad leader: %s", err))
+		return
+	}
+
+	if leader == "" {
+		writeError(w, 503, codeNomadUnavailable, "Nomad has no cluster leader")
+		return
+	}
+
+	writeJSON(w, 200, map[string]string{"status": "ok", "leader": leader})
+}
+
+func nomadLeader(timeout time.Duration) (string, error) {
+	nomadClient, err := nomad.NewNomadClient()
+	if err != nil {
+		return "", err
+	}
+
+	type result struct {
+		leader string
+		err    error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		leader, err := nomadClient.Status().Leader()
+		ch <- result{leader: leader, err: err}
+	}()
+
+	select {
+	case res := <-ch:
+		return res.leader, res.err
+	case <-time.After(timeout):
+		return "", fmt.Errorf("timed out after %s", timeout)
+	}
+}
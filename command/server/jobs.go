@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/command/job"
+	"github.com/seatgeek/nomad-helper/command/tail"
+	"github.com/seatgeek/nomad-helper/nomad"
+	log "github.com/sirupsen/logrus"
+)
+
+type connContextKey struct{}
+
+// saveConn keeps the connection of a request in its context, so streaming handlers can lift
+// the write timeout of the server for their connection
+func saveConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// disableWriteTimeout lets a handler stream for longer than the server write timeout
+func disableWriteTimeout(r *http.Request) {
+	if c, ok := r.Context().Value(connContextKey{}).(net.Conn); ok {
+		c.SetWriteDeadline(time.Time{})
+	}
+}
+
+func registerJobs(r *mux.Router, prefix, format string, logger *log.Logger) {
+	r.PathPrefix(prefix + "/job/list").Handler(http.StripPrefix(prefix+"/job/list", webHandler(format, job.ListWeb)))
+	r.PathPrefix(prefix + "/job/hunt").Handler(http.StripPrefix(prefix+"/job/hunt", webHandler(format, job.HuntWeb)))
+	r.PathPrefix(prefix + "/job/{id}/allocations").Handler(jobAllocationsHandler(prefix, format))
+	r.Path(prefix + "/alloc/{id}/logs").Handler(allocLogsHandler(logger))
+}
+
+func jobAllocationsHandler(prefix, format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID := mux.Vars(r)["id"]
+
+		handler := webHandler(format, func(logger *log.Logger, r *http.Request) (string, error) {
+			return job.AllocationsWeb(logger, r, jobID)
+		})
+
+		http.StripPrefix(prefix+"/job/"+jobID+"/allocations", handler).ServeHTTP(w, r)
+	}
+}
+
+// allocLogsHandler streams the log of an allocation task as a chunked response. Query arguments:
+// task (required when the allocation has multiple tasks), type (stdout or stderr), lines (the
+// number of lines to start with) and follow (set to false to return only the last lines)
+func allocLogsHandler(logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		logType := query.Get("type")
+		if logType == "" {
+			logType = "stdout"
+		}
+		if logType != "stdout" && logType != "stderr" {
+			writeError(w, 400, codeInvalidRequest, "Invalid type, must be stdout or stderr")
+			return
+		}
+
+		lines := int64(15)
+		if v := query.Get("lines"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 1 {
+				writeError(w, 400, codeInvalidRequest, "Invalid lines, must be a positive number")
+				return
+			}
+			lines = n
+		}
+
+		follow := query.Get("follow") != "false"
+
+		nomadClient, err := nomad.NewNomadClientFromContext(r.Context())
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+
+		alloc, err := findWebAllocation(nomadClient, mux.Vars(r)["id"])
+		if err != nil {
+			if errors.Is(err, errAllocNotFound) {
+				writeError(w, 404, codeNotFound, err.Error())
+				return
+			}
+			writeErr(w, err)
+			return
+		}
+
+		task, err := findWebTask(alloc, query.Get("task"))
+		if err != nil {
+			writeError(w, 400, codeInvalidRequest, err.Error())
+			return
+		}
+
+		entry := logger.WithField("alloc", alloc.ID).WithField("task", task).WithField("log_type", logType)
+		reader, err := tail.NewLogReader(nomadClient, alloc, task, logType, lines, follow, r.Context().Done(), entry)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		defer reader.Close()
+
+		if follow {
+			disableWriteTimeout(r)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(200)
+
+		if _, err := io.Copy(flushWriter{w}, reader); err != nil && r.Context().Err() == nil {
+			entry.Warnf("Error streaming logs: %s", err)
+		}
+	}
+}
+
+// flushWriter sends every write to the client right away
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return n, err
+}
+
+var errAllocNotFound = errors.New("No allocations found")
+
+// findWebAllocation looks up an allocation by its ID or a unique ID prefix, in any namespace
+func findWebAllocation(client *api.Client, id string) (*api.Allocation, error) {
+	allocs, _, err := client.Allocations().List(&api.QueryOptions{Prefix: id, Namespace: "*"})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(allocs) == 0 {
+		return nil, fmt.Errorf("%w with prefix: %s", errAllocNotFound, id)
+	}
+	if len(allocs) > 1 {
+		return nil, fmt.Errorf("%d allocations found with prefix: %s, use a longer prefix", len(allocs), id)
+	}
+
+	alloc, _, err := client.Allocations().Info(allocs[0].ID, &api.QueryOptions{Namespace: allocs[0].Namespace})
+	return alloc, err
+}
+
+// findWebTask picks the task to read logs from, when the allocation has a single task it's used by default
+func findWebTask(alloc *api.Allocation, task string) (string, error) {
+	tasks := make([]string, 0, len(alloc.TaskStates))
+	for name := range alloc.TaskStates {
+		if name == task {
+			return task, nil
+		}
+		tasks = append(tasks, name)
+	}
+	sort.Strings(tasks)
+
+	if task == "" && len(tasks) == 1 {
+		return tasks[0], nil
+	}
+
+	if task == "" {
+		return "", fmt.Errorf("The allocation has multiple tasks, pick one with ?task=: %s", strings.Join(tasks, ", "))
+	}
+
+	return "", fmt.Errorf("Unknown task '%s', the allocation has: %s", task, strings.Join(tasks, ", "))
+}
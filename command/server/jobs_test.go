@@ -0,0 +1,82 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestFindWebAllocation(t *testing.T) {
+	allocs := map[string]string{
+		"5a3c1b8e-0000-4000-8000-000000000001": "batch",
+		"5a3c1b8e-0000-4000-8000-000000000002": "default",
+		"9f1e2d3c-0000-4000-8000-000000000003": "batch",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		if r.URL.Path == "/v1/allocations" {
+			if query.Get("namespace") != "*" {
+				w.Write([]byte(`[]`))
+				return
+			}
+
+			var stubs []string
+			for id, ns := range allocs {
+				if strings.HasPrefix(id, query.Get("prefix")) {
+					stubs = append(stubs, `{"ID":"`+id+`","Namespace":"`+ns+`"}`)
+				}
+			}
+			w.Write([]byte("[" + strings.Join(stubs, ",") + "]"))
+			return
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, "/v1/allocation/")
+		ns, ok := allocs[id]
+		if !ok || query.Get("namespace") != ns {
+			http.Error(w, "alloc not found", 404)
+			return
+		}
+		w.Write([]byte(`{"ID":"` + id + `","Namespace":"` + ns + `"}`))
+	}))
+	defer server.Close()
+
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		id       string
+		want     string
+		notFound bool
+		wantErr  bool
+	}{
+		{name: "non-default namespace", id: "9f1e", want: "9f1e2d3c-0000-4000-8000-000000000003"},
+		{name: "full ID", id: "5a3c1b8e-0000-4000-8000-000000000001", want: "5a3c1b8e-0000-4000-8000-000000000001"},
+		{name: "default namespace", id: "5a3c1b8e-0000-4000-8000-000000000002", want: "5a3c1b8e-0000-4000-8000-000000000002"},
+		{name: "ambiguous prefix", id: "5a3c", wantErr: true},
+		{name: "unknown", id: "0000", notFound: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alloc, err := findWebAllocation(client, tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if errors.Is(err, errAllocNotFound) != tt.notFound {
+				t.Errorf("got error %v, want not found %v", err, tt.notFound)
+			}
+			if err == nil && alloc.ID != tt.want {
+				t.Errorf("got %s, want %s", alloc.ID, tt.want)
+			}
+		})
+	}
+}
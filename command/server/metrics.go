@@ -0,0 +1,263 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// Request latency histogram buckets, in seconds
+var latencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// metrics keeps the server metrics, exported in the Prometheus text format on /metrics
+type metrics struct {
+	mu             sync.Mutex
+	requests       map[[3]string]int64 // route, method, status
+	latencies      map[string]*histogram
+	nomadRequests  map[[3]string]int64 // endpoint, method, status
+	nomadLatencies map[string]*histogram
+}
+
+type histogram struct {
+	buckets []int64
+	sum     float64
+	count   int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:       make(map[[3]string]int64),
+		latencies:      make(map[string]*histogram),
+		nomadRequests:  make(map[[3]string]int64),
+		nomadLatencies: make(map[string]*histogram),
+	}
+}
+
+func (h *histogram) observe(seconds float64) {
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			h.buckets[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+func observe(histograms map[string]*histogram, key string, d time.Duration) {
+	h, ok := histograms[key]
+	if !ok {
+		h = &histogram{buckets: make([]int64, len(latencyBuckets))}
+		histograms[key] = h
+	}
+	h.observe(d.Seconds())
+}
+
+func (m *metrics) observeRequest(route, method string, status int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[[3]string{route, method, fmt.Sprintf("%d", status)}]++
+	observe(m.latencies, route, d)
+}
+
+func (m *metrics) observeNomadRequest(endpoint, method, status string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nomadRequests[[3]string{endpoint, method, status}]++
+	observe(m.nomadLatencies, endpoint, d)
+}
+
+// nomadTransport counts the Nomad API calls, by endpoint (like "/v1/nodes"), method and status
+// code. Only the first path segment after the version is used, to leave out IDs
+func (m *metrics) nomadTransport(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		chunks := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if len(chunks) > 2 {
+			chunks = chunks[:2]
+		}
+		endpoint := "/" + strings.Join(chunks, "/")
+
+		start := time.Now()
+		resp, err := next.RoundTrip(r)
+
+		status := "error"
+		if err == nil {
+			status = fmt.Sprintf("%d", resp.StatusCode)
+		}
+		m.observeNomadRequest(endpoint, r.Method, status, time.Since(start))
+
+		return resp, err
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func (m *metrics) handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeCounter(w, "nomad_helper_http_requests_total", "HTTP requests served, by route, method and status code.", []string{"route", "method", "status"}, m.requests)
+	writeHistogram(w, "nomad_helper_http_request_duration_seconds", "HTTP request latency, by route.", "route", m.latencies)
+	writeCounter(w, "nomad_helper_nomad_requests_total", "Nomad API calls, by endpoint, method and status code.", []string{"endpoint", "method", "status"}, m.nomadRequests)
+	writeHistogram(w, "nomad_helper_nomad_request_duration_seconds", "Nomad API call latency, by endpoint.", "endpoint", m.nomadLatencies)
+}
+
+func writeCounter(w io.Writer, name, help string, labels []string, values map[[3]string]int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+
+	keys := make([][3]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.Join(keys[i][:], "\x00") < strings.Join(keys[j][:], "\x00")
+	})
+
+	for _, key := range keys {
+		pairs := make([]string, len(labels))
+		for i, label := range labels {
+			pairs[i] = fmt.Sprintf("%s=%q", label, key[i])
+		}
+		fmt.Fprintf(w, "%s{%s} %d\n", name, strings.Join(pairs, ","), values[key])
+	}
+}
+
+func writeHistogram(w io.Writer, name, help, label string, histograms map[string]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+
+	keys := make([]string, 0, len(histograms))
+	for key := range histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		h := histograms[key]
+		for i, le := range latencyBuckets {
+			fmt.Fprintf(w, "%s_bucket{%s=%q,le=\"%g\"} %d\n", name, label, key, le, h.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s=%q,le=\"+Inf\"} %d\n", name, label, key, h.count)
+		fmt.Fprintf(w, "%s_sum{%s=%q} %g\n", name, label, key, h.sum)
+		fmt.Fprintf(w, "%s_count{%s=%q} %d\n", name, label, key, h.count)
+	}
+}
+
+type requestInfoKey struct{}
+
+// requestInfo is filled in by the router for the access log and metrics, which wrap it
+type requestInfo struct {
+	route string
+}
+
+// routeMiddleware records the path template of the matched route, like "/v1/node/list"
+func routeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+			if route := mux.CurrentRoute(r); route != nil {
+				if template, err := route.GetPathTemplate(); err == nil {
+					info.route = template
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// observeHandler writes an access log line and records the metrics of every request
+func observeHandler(next http.Handler, m *metrics, logger *log.Logger, accessLog bool, writeTimeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{route: "unmatched"}
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+
+		if rec.status == 0 {
+			rec.status = 200
+		}
+		duration := time.Since(start)
+		m.observeRequest(info.route, r.Method, rec.status, duration)
+
+		fields := log.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"route":       info.route,
+			"status":      rec.status,
+			"bytes":       rec.bytes,
+			"duration_ms": duration.Milliseconds(),
+			"remote_addr": r.RemoteAddr,
+			"user_agent":  r.UserAgent(),
+		}
+
+		// The connection is closed once the write timeout passed, the client got nothing
+		if writeTimeout > 0 && duration > writeTimeout && !rec.streaming {
+			logger.WithFields(fields).Warnf("Request took longer than the write timeout (%s), the response was dropped. Raise --write-timeout", writeTimeout)
+			return
+		}
+
+		if accessLog {
+			logger.WithFields(fields).Info("request")
+		}
+	})
+}
+
+// statusRecorder captures the status code and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status    int
+	bytes     int
+	streaming bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = 200
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += n
+	return n, err
+}
+
+// Flush keeps streaming responses (logs and operation events) working through the recorder
+func (s *statusRecorder) Flush() {
+	s.streaming = true
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijacking is not supported")
+	}
+	return hijacker.Hijack()
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+func TestObserveHandler(t *testing.T) {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+
+	m := newMetrics()
+	r := newRouter(cli.NewApp(), &auth{}, newOperations(logger), nil, m, &health{}, logger)
+	handler := observeHandler(r, m, logger, true, 0)
+
+	for _, path := range []string{"/healthz", "/healthz", "/v1/bogus"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	var out bytes.Buffer
+	m.write(&out)
+
+	tests := []string{
+		`nomad_helper_http_requests_total{route="/healthz",method="GET",status="200"} 2`,
+		`nomad_helper_http_requests_total{route="unmatched",method="GET",status="404"} 1`,
+		`nomad_helper_http_request_duration_seconds_count{route="/healthz"} 2`,
+	}
+
+	for _, want := range tests {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("metrics are missing %s, got:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec documents the /v1 API
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	operationStatusRunning  = "running"
+	operationStatusComplete = "complete"
+	operationStatusFailed   = "failed"
+
+	// operationRetention is how long finished operations can still be read
+	operationRetention = 24 * time.Hour
+
+	// sseStreamDuration ends an event stream before the server write timeout,
+	// the client reconnects with Last-Event-ID and continues where it left off
+	sseStreamDuration = 20 * time.Second
+)
+
+// operation is a write command started from the server, its log lines are the progress events
+type operation struct {
+	id        string
+	kind      string
+	startedAt time.Time
+
+	mu      sync.Mutex
+	status  string
+	err     string
+	endedAt time.Time
+	events  []string
+	partial string
+
+	// changed is closed (and replaced) when there are new events or the status changes
+	changed chan struct{}
+}
+
+type operationStatus struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	StatusURL string     `json:"status_url"`
+	EventsURL string     `json:"events_url"`
+	Events    []string   `json:"events,omitempty"`
+}
+
+// Write splits the log output into events, one per line
+func (o *operation) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	lines := strings.Split(o.partial+string(p), "\n")
+	o.partial = lines[len(lines)-1]
+	o.events = append(o.events, lines[:len(lines)-1]...)
+	o.notify()
+
+	return len(p), nil
+}
+
+func (o *operation) finish(err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.status = operationStatusComplete
+	if err != nil {
+		o.status = operationStatusFailed
+		o.err = err.Error()
+	}
+	o.endedAt = time.Now()
+	o.notify()
+}
+
+// notify wakes up all event streams, must be called with the lock held
+func (o *operation) notify() {
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// since returns the events after the first n events, and a channel to wait for more
+func (o *operation) since(n int) ([]string, bool, chan struct{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if n > len(o.events) {
+		n = len(o.events)
+	}
+
+	events := make([]string, len(o.events)-n)
+	copy(events, o.events[n:])
+
+	return events, o.status != operationStatusRunning, o.changed
+}
+
+func (o *operation) toStatus(withEvents bool) operationStatus {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	status := operationStatus{
+		ID:        o.id,
+		Kind:      o.kind,
+		Status:    o.status,
+		Error:     o.err,
+		StartedAt: o.startedAt,
+		StatusURL: "/v1/operations/" + o.id,
+		EventsURL: "/v1/operations/" + o.id + "/events",
+	}
+
+	if !o.endedAt.IsZero() {
+		endedAt := o.endedAt
+		status.EndedAt = &endedAt
+	}
+
+	if withEvents {
+		status.Events = append([]string{}, o.events...)
+	}
+
+	return status
+}
+
+// operations keeps track of the running and recently finished operations
+type operations struct {
+	mu         sync.Mutex
+	operations map[string]*operation
+	logger     *log.Logger
+}
+
+func newOperations(logger *log.Logger) *operations {
+	return &operations{
+		operations: make(map[string]*operation),
+		logger:     logger,
+	}
+}
+
+// start runs the operation in the background, with a logger that records its progress
+func (o *operations) start(kind string, run func(logger *log.Logger) error) (*operation, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	op := &operation{
+		id:        hex.EncodeToString(id),
+		kind:      kind,
+		startedAt: time.Now(),
+		status:    operationStatusRunning,
+		events:    make([]string, 0),
+		changed:   make(chan struct{}),
+	}
+
+	logger := log.New()
+	logger.SetLevel(o.logger.GetLevel())
+	logger.SetFormatter(&log.TextFormatter{DisableColors: true, FullTimestamp: true})
+	logger.SetOutput(io.MultiWriter(op, o.logger.Out))
+
+	o.mu.Lock()
+	o.prune()
+	o.operations[op.id] = op
+	o.mu.Unlock()
+
+	o.logger.Infof("Starting %s operation %s", kind, op.id)
+
+	go func() {
+		err := run(logger)
+		if err != nil {
+			logger.Error(err)
+		}
+
+		op.finish(err)
+		o.logger.Infof("Finished %s operation %s", kind, op.id)
+	}()
+
+	return op, nil
+}
+
+func (o *operations) get(id string) (*operation, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	op, ok := o.operations[id]
+	return op, ok
+}
+
+// running returns the number of operations that are not finished yet
+func (o *operations) running() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	count := 0
+	for _, op := range o.operations {
+		if op.toStatus(false).Status == operationStatusRunning {
+			count++
+		}
+	}
+
+	return count
+}
+
+// prune removes finished operations past their retention, must be called with the lock held
+func (o *operations) prune() {
+	for id, op := range o.operations {
+		status := op.toStatus(false)
+		if status.EndedAt != nil && time.Since(*status.EndedAt) > operationRetention {
+			delete(o.operations, id)
+		}
+	}
+}
+
+func (o *operations) statusHandler(w http.ResponseWriter, r *http.Request) {
+	op, ok := o.get(mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, 404, codeNotFound, "Unknown operation")
+		return
+	}
+
+	writeJSON(w, 200, op.toStatus(true))
+}
+
+// eventsHandler streams the progress of the operation as server-sent events. Every
+// log line is a "progress" event, and the final status is sent as a "done" event
+func (o *operations) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	op, ok := o.get(mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, 404, codeNotFound, "Unknown operation")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, 500, codeInternalError, "Streaming is not supported")
+		return
+	}
+
+	// Event IDs are the number of events seen, so a reconnect resumes after the last one
+	next := 0
+	if id, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil && id > 0 {
+		next = id
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	fmt.Fprint(w, "retry: 1000\n\n")
+
+	timeout := time.After(sseStreamDuration)
+	for {
+		events, done, changed := op.since(next)
+		for _, event := range events {
+			next++
+			fmt.Fprintf(w, "id: %d\nevent: progress\ndata: %s\n\n", next, event)
+		}
+
+		if done {
+			data, _ := json.Marshal(op.toStatus(false))
+			fmt.Fprintf(w, "id: %d\nevent: done\ndata: %s\n\n", next, data)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-timeout:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -3,63 +3,163 @@ package server
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
-	"time"
+	"syscall"
 
 	"github.com/buildkite/terminal-to-html"
 	"github.com/gorilla/mux"
 	"github.com/seatgeek/nomad-helper/command/node"
 	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli"
 )
 
 func Run(a *cli.App, c *cli.Context, logger *log.Logger) error {
+	switch c.String("log-format") {
+	case "json":
+		logger.SetFormatter(&log.JSONFormatter{})
+	case "text":
+	default:
+		return fmt.Errorf("Invalid log-format: %s", c.String("log-format"))
+	}
+
+	history, err := newBreakdownHistory(c, logger)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := newTLSConfig(c)
+	if err != nil {
+		return err
+	}
+
+	auth := newAuth(c, logger)
+	if !auth.enabled() {
+		logger.Warn("No authentication configured, all callers can read the nodes using the Nomad token of the server")
+	}
+
+	m := newMetrics()
+	nomad.SetTransportWrapper(m.nomadTransport)
+
+	ops := newOperations(logger)
+	health := &health{}
+	r := newRouter(a, auth, ops, history, m, health, logger)
+
+	srv := &http.Server{
+		Handler:      observeHandler(r, m, logger, !c.Bool("no-access-log"), c.Duration("write-timeout")),
+		Addr:         c.String("listen"),
+		ReadTimeout:  c.Duration("read-timeout"),
+		WriteTimeout: c.Duration("write-timeout"),
+		IdleTimeout:  c.Duration("idle-timeout"),
+		TLSConfig:    tlsConfig,
+		ConnContext:  saveConn,
+	}
+
+	// Shut down gracefully on SIGTERM (like Nomad sends) or SIGINT: stop being ready,
+	// then stop accepting connections and wait for the requests in flight
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-sigs
+
+		logger.Infof("Caught %s, shutting down (timeout: %s)", sig, c.Duration("shutdown-timeout"))
+		health.shuttingDown.Store(true)
+		if running := ops.running(); running > 0 {
+			logger.Warnf("%d operations are still running, they are stopped with the server", running)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.Duration("shutdown-timeout"))
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Warnf("Could not finish all requests in time: %s", err)
+			srv.Close()
+		}
+	}()
+
+	if c.String("tls-cert") != "" {
+		logger.Infof("Starting TLS server on %s", c.String("listen"))
+		err = srv.ListenAndServeTLS(c.String("tls-cert"), c.String("tls-key"))
+	} else {
+		logger.Infof("Starting server on %s", c.String("listen"))
+		err = srv.ListenAndServe()
+	}
+
+	if err != http.ErrServerClosed {
+		return err
+	}
+
+	<-stopped
+	logger.Info("Server stopped")
+	return nil
+}
+
+// newRouter registers all endpoints. The API is served under /v1, and defaults to JSON output.
+// The unversioned paths are kept for existing users, and default to table output
+func newRouter(a *cli.App, auth *auth, ops *operations, history *node.BreakdownHistory, m *metrics, health *health, logger *log.Logger) *mux.Router {
 	r := mux.NewRouter()
+	r.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	r.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
+	r.Use(routeMiddleware, auth.middleware)
+
+	r.Path("/healthz").HandlerFunc(health.liveHandler)
+	r.Path("/readyz").HandlerFunc(health.readyHandler)
+	r.Path("/metrics").HandlerFunc(m.handler)
+
 	r.Path("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Location", "/help")
+		w.Header().Set("Location", "/ui/")
 		w.WriteHeader(302)
 	})
-	r.Path("/node/discover").HandlerFunc(nodeDiscoverHandler)
-	r.PathPrefix("/node/empty").Handler(http.StripPrefix("/node/empty", http.HandlerFunc(nodeEmptyHandler)))
-	r.PathPrefix("/node/breakdown").Handler(http.StripPrefix("/node/breakdown", http.HandlerFunc(nodeBreakdownHandler)))
-	r.PathPrefix("/node/list").Handler(http.StripPrefix("/node/list", http.HandlerFunc(nodeListHandler)))
-	r.PathPrefix("/help").Handler(http.StripPrefix("/help", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Store old ioWriter for CLI
-		oldWriter := a.Writer
-		oldExitHandler := a.ExitErrHandler
-
-		// Write new exit handler!
-		a.ExitErrHandler = func(ctx *cli.Context, err error) {
-			logger.Error(err.Error())
-			w.WriteHeader(500)
-			w.Write([]byte(err.Error()))
-		}
+	r.Path("/ui").Handler(http.RedirectHandler("/ui/", 301))
+	r.PathPrefix("/ui/").Handler(uiHandler())
+	r.Path("/openapi.json").HandlerFunc(openAPIHandler)
+	r.PathPrefix("/help").Handler(http.StripPrefix("/help", helpHandler(a)))
+
+	versions := []struct{ prefix, format string }{
+		{prefix: "/v1", format: "json"},
+		{prefix: "", format: "table"},
+	}
+	for _, v := range versions {
+		registerActions(r, v.prefix, a, auth, ops)
+		registerNodes(r, v.prefix, v.format, history)
+		registerJobs(r, v.prefix, v.format, logger)
+	}
+
+	return r
+}
 
-		// Create a new empty context
-		ctx := cli.NewContext(a, nil, nil)
-		ctx.App = a
+func registerNodes(r *mux.Router, prefix, format string, history *node.BreakdownHistory) {
+	r.Path(prefix + "/node/discover").Handler(webHandler(format, node.DiscoverWeb))
+	r.PathPrefix(prefix + "/node/breakdown/history").Handler(http.StripPrefix(prefix+"/node/breakdown/history", nodeBreakdownHistoryHandler(format, history)))
+	r.PathPrefix(prefix + "/node/empty").Handler(http.StripPrefix(prefix+"/node/empty", webHandler(format, node.EmptytWeb)))
+	r.PathPrefix(prefix + "/node/breakdown").Handler(http.StripPrefix(prefix+"/node/breakdown", webHandler(format, node.BreakdownWeb)))
+	r.PathPrefix(prefix + "/node/list").Handler(http.StripPrefix(prefix+"/node/list", webHandler(format, node.ListWeb)))
+}
 
-		// Create the byte buffers
+// helpHandler renders the CLI help of the command in the path as HTML
+func helpHandler(a *cli.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		var b bytes.Buffer
 		writer := bufio.NewWriter(&b)
-		a.Writer = writer
-
-		chunks := helpers.DeleteEmpty(strings.Split(r.URL.Path, "/"))
-		if len(chunks) == 0 {
-			cli.ShowAppHelp(ctx)
-		} else {
-			chunks = append([]string{"nomad-helper"}, chunks...)
-			chunks = append(chunks, "-h")
-			a.Run(chunks)
+
+		path := helpers.DeleteEmpty(strings.Split(r.URL.Path, "/"))
+		if err := writeHelp(writer, a, path); err != nil {
+			writeError(w, 404, codeNotFound, err.Error())
+			return
 		}
 		writer.Flush()
 
-		// Restore old ioWriter for CLI
-		a.Writer = oldWriter
-		a.ExitErrHandler = oldExitHandler
-
 		// Capture the output
 		output := b.Bytes()
 		text := string(terminal.Render(output))
@@ -78,96 +178,90 @@ func Run(a *cli.App, c *cli.Context, logger *log.Logger) error {
 
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.Write([]byte(html))
-	})))
-
-	srv := &http.Server{
-		Handler:      r,
-		Addr:         c.String("listen"),
-		WriteTimeout: 30 * time.Second,
-		ReadTimeout:  30 * time.Second,
 	}
-
-	logger.Infof("Starting server on %s", c.String("listen"))
-	return srv.ListenAndServe()
 }
 
-func nodeBreakdownHandler(w http.ResponseWriter, r *http.Request) {
-	output, err := node.BreakdownWeb(log.New(), r)
-	if err != nil {
-		w.Write([]byte(err.Error()))
-		w.WriteHeader(500)
-		return
+// writeHelp writes the CLI help of the command at path, or of the app without a path. The
+// app is not run for this, as that would run its Before hook and change the global state
+// of the server, like the Nomad token
+func writeHelp(writer io.Writer, a *cli.App, path []string) error {
+	if len(path) == 0 {
+		template := a.CustomAppHelpTemplate
+		if template == "" {
+			template = cli.AppHelpTemplate
+		}
+
+		cli.HelpPrinter(writer, template, a)
+		return nil
 	}
 
-	switch r.Header.Get("output-format") {
-	case "table":
-		w.Header().Set("Content-Type", "text/html")
-	default:
-		w.Header().Set("Content-Type", "application/json")
+	commands := a.Commands
+	helpName := a.Name
+	var command *cli.Command
+	for _, name := range path {
+		if command = findCommand(commands, name); command == nil {
+			return fmt.Errorf("No help for unknown command '%s'", strings.Join(path, " "))
+		}
+
+		helpName += " " + command.Name
+		commands = command.Subcommands
 	}
 
-	w.Write([]byte(output))
-}
+	// a command with subcommands is shown like an app of its own, the same as the CLI does
+	if len(command.Subcommands) > 0 {
+		app := &cli.App{
+			Name:        command.Name,
+			HelpName:    helpName,
+			Usage:       command.Usage,
+			UsageText:   command.UsageText,
+			Description: command.Description,
+			ArgsUsage:   command.ArgsUsage,
+			Flags:       command.Flags,
+			Commands:    append([]cli.Command(nil), command.Subcommands...),
+			Writer:      ioutil.Discard,
+		}
+		app.Setup()
 
-func nodeEmptyHandler(w http.ResponseWriter, r *http.Request) {
-	output, err := node.EmptytWeb(log.New(), r)
-	if err != nil {
-		w.Write([]byte(err.Error()))
-		w.WriteHeader(500)
-		return
+		cli.HelpPrinter(writer, cli.SubcommandHelpTemplate, app)
+		return nil
 	}
 
-	switch r.Header.Get("output-format") {
-	case "table":
-		w.Header().Set("Content-Type", "text/html")
-	default:
-		w.Header().Set("Content-Type", "application/json")
+	leaf := *command
+	leaf.HelpName = helpName
+
+	template := leaf.CustomHelpTemplate
+	if template == "" {
+		template = cli.CommandHelpTemplate
 	}
 
-	w.Write([]byte(output))
+	cli.HelpPrinter(writer, template, leaf)
+	return nil
 }
 
-func nodeListHandler(w http.ResponseWriter, r *http.Request) {
-	fieldsInput := helpers.DeleteEmpty(strings.Split(r.URL.Path, "/"))
-	if len(fieldsInput) == 0 {
-		w.Header().Set("Location", "/node/list/name/status/SchedulingEligibility/drain/class?"+r.URL.RawQuery)
-		w.WriteHeader(302)
-		return
+func newBreakdownHistory(c *cli.Context, logger *log.Logger) (*node.BreakdownHistory, error) {
+	if c.String("history-file") == "" {
+		return nil, nil
 	}
 
-	output, err := node.ListWeb(log.New(), r)
+	history, err := node.NewBreakdownHistory(c.String("history-file"), c.StringSlice("history-dimension"), c.Duration("history-retention"), logger)
 	if err != nil {
-		w.Write([]byte(err.Error()))
-		w.WriteHeader(500)
-		return
+		return nil, err
 	}
 
-	switch r.Header.Get("output-format") {
-	case "table":
-		w.Header().Set("Content-Type", "text/html")
-	default:
-		w.Header().Set("Content-Type", "application/json")
-	}
+	logger.Infof("Recording node breakdown history every %s to %s", c.Duration("history-interval"), c.String("history-file"))
+	go history.Run(c.Duration("history-interval"))
 
-	w.Write([]byte(output))
+	return history, nil
 }
 
-func nodeDiscoverHandler(w http.ResponseWriter, r *http.Request) {
-	output, err := node.DiscoverWeb(log.New(), r)
-	if err != nil {
-		w.Write([]byte(err.Error()))
-		w.WriteHeader(500)
-		return
-	}
-
-	switch r.Header.Get("output-format") {
-	case "table":
-		w.Header().Set("Content-Type", "text/html")
-	default:
-		w.Header().Set("Content-Type", "application/json")
+func nodeBreakdownHistoryHandler(format string, history *node.BreakdownHistory) http.HandlerFunc {
+	if history == nil {
+		return func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, 404, codeNotFound, "Node breakdown history is not enabled, start the server with --history-file")
+		}
 	}
 
-	w.Write([]byte(output))
+	return webHandler(format, history.Web)
 }
 
 // Copied from https://github.com/buildkite/terminal-to-html/blob/master/assets/terminal.css
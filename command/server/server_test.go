@@ -0,0 +1,60 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	cli "github.com/urfave/cli"
+)
+
+func TestWriteHelp(t *testing.T) {
+	app := cli.NewApp()
+	app.Name = "nomad-helper"
+	app.Before = func(c *cli.Context) error {
+		t.Errorf("the app must not run to write the help")
+		return nil
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "node",
+			Usage: "node commands",
+			Flags: []cli.Flag{cli.StringFlag{Name: "filter-class"}},
+			Subcommands: []cli.Command{
+				{
+					Name:  "list",
+					Usage: "list the nodes",
+					Flags: []cli.Flag{cli.StringFlag{Name: "output-format"}},
+				},
+			},
+		},
+	}
+	app.Setup()
+
+	tests := []struct {
+		path    []string
+		want    []string
+		wantErr bool
+	}{
+		{path: nil, want: []string{"nomad-helper", "node commands"}},
+		{path: []string{"node"}, want: []string{"nomad-helper node command", "list the nodes", "--filter-class"}},
+		{path: []string{"node", "list"}, want: []string{"nomad-helper node list - list the nodes", "--output-format"}},
+		{path: []string{"node", "missing"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.path, " "), func(t *testing.T) {
+			var b bytes.Buffer
+			err := writeHelp(&b, app, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("help does not contain %q:\n%s", want, b.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// The web UI is a static single page app, compiled into the binary
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// publicPaths can be requested without authentication, they don't expose any Nomad data
+var publicPaths = []string{"/ui/", "/openapi.json", "/healthz", "/readyz", "/metrics"}
+
+func isPublicPath(path string) bool {
+	for _, prefix := range publicPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func uiHandler() http.Handler {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(files)))
+}
@@ -0,0 +1,468 @@
+// nomad-helper UI - all state lives in the location hash, so every view can be shared as a link:
+//
+//   #list?fields=name,class&filter-class=web&where=status%3Dready&sort=name&order=asc
+//   #breakdown?fields=class,attribute.nomad.version&filter-meta=aws.instance.region%3Dus-east-1
+(function () {
+  "use strict";
+
+  var defaultFields = {
+    list: "name,status,SchedulingEligibility,drain,class",
+    breakdown: "class,status"
+  };
+
+  var filterInputs = ["filter-class", "filter-version", "filter-eligibility", "filter-status", "filter-prefix"];
+  var pairFilters = { meta: "filter-meta", attribute: "filter-attribute" };
+
+  var state = null;
+  var discover = null;
+  var rows = [];
+  var columns = [];
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function el(tag, props, children) {
+    var node = document.createElement(tag);
+    Object.keys(props || {}).forEach(function (key) {
+      if (key === "text") {
+        node.textContent = props[key];
+      } else if (key.indexOf("on") === 0) {
+        node.addEventListener(key.substring(2), props[key]);
+      } else {
+        node.setAttribute(key, props[key]);
+      }
+    });
+    (children || []).forEach(function (child) {
+      node.appendChild(child);
+    });
+    return node;
+  }
+
+  function splitList(value) {
+    return (value || "").split(",").map(function (s) { return s.trim(); }).filter(Boolean);
+  }
+
+  // State <-> hash
+
+  function parseHash() {
+    var hash = location.hash.replace(/^#/, "");
+    var view = hash.split("?")[0] || "list";
+    var params = new URLSearchParams(hash.split("?")[1] || "");
+
+    if (view !== "list" && view !== "breakdown") {
+      view = "list";
+    }
+
+    return {
+      view: view,
+      fields: params.get("fields") || defaultFields[view],
+      filters: filterInputs.concat(Object.values(pairFilters)).reduce(function (m, key) {
+        if (params.get(key)) {
+          m[key] = params.get(key);
+        }
+        return m;
+      }, {}),
+      where: params.getAll("where"),
+      q: params.get("q") || "",
+      sort: params.get("sort") || "",
+      order: params.get("order") || "asc"
+    };
+  }
+
+  function toHash(s) {
+    var params = new URLSearchParams();
+    params.set("fields", s.fields);
+    Object.keys(s.filters).forEach(function (key) {
+      if (s.filters[key]) {
+        params.set(key, s.filters[key]);
+      }
+    });
+    s.where.forEach(function (w) { params.append("where", w); });
+    if (s.q) { params.set("q", s.q); }
+    if (s.sort) {
+      params.set("sort", s.sort);
+      params.set("order", s.order);
+    }
+    return "#" + s.view + "?" + params.toString();
+  }
+
+  function navigate(s) {
+    location.hash = toHash(s);
+  }
+
+  // Replace the hash without triggering a reload, for changes that are only client side
+  function replaceState(s) {
+    history.replaceState(null, "", toHash(s));
+    $("share").href = location.href;
+  }
+
+  // Data
+
+  function apiURL(kind, s) {
+    var path = splitList(s.fields).map(encodeURIComponent).join("/");
+    var params = new URLSearchParams(s.filters);
+    // The server only uses ready nodes unless asked for specific statuses or all of them
+    if (params.get("filter-status") === "any") {
+      params.delete("filter-status");
+      params.set("all-statuses", "true");
+    }
+    return "/v1/node/" + kind + "/" + path + "?" + params.toString();
+  }
+
+  function fetchJSON(url) {
+    return fetch(url, { credentials: "same-origin", headers: { Accept: "application/json" } }).then(function (resp) {
+      return resp.json().catch(function () {
+        throw new Error(resp.status + " " + resp.statusText);
+      }).then(function (data) {
+        if (!resp.ok) {
+          throw new Error(resp.status + " " + (data.code || resp.statusText) + ": " + (data.message || ""));
+        }
+        return data;
+      });
+    });
+  }
+
+  function loadDiscover() {
+    return fetchJSON("/v1/node/discover?all-statuses=true").then(function (data) {
+      discover = data;
+      renderFilterOptions();
+    });
+  }
+
+  function load() {
+    state = parseHash();
+    renderControls();
+    $("error").textContent = "";
+    $("summary").textContent = "Loading...";
+
+    fetchJSON(apiURL(state.view, state)).then(function (data) {
+      var fields = splitList(state.fields);
+
+      if (state.view === "list") {
+        columns = fields;
+        rows = (data || []).map(function (node) {
+          return fields.map(function (f) { return node[f]; });
+        });
+      } else {
+        columns = fields.concat(["count"]);
+        rows = (data || []).map(function (r) {
+          return r.path.concat([r.value]);
+        });
+      }
+
+      renderTable();
+    }).catch(function (err) {
+      rows = [];
+      renderTable();
+      $("error").textContent = err.message;
+    });
+  }
+
+  // Filter builder
+
+  function renderFilterOptions() {
+    var versions = (discover.Attribute && discover.Attribute["nomad.version"]) || [];
+    var options = {
+      "filter-class": discover.Node.class || [],
+      "filter-version": versions,
+      "filter-eligibility": discover.Node.eligibility || [],
+      "filter-status": (discover.Node.status || []).filter(function (s) { return s !== "ready"; })
+    };
+
+    Object.keys(options).forEach(function (id) {
+      var select = $(id);
+      select.innerHTML = "";
+      if (id === "filter-status") {
+        select.appendChild(el("option", { value: "", text: "ready" }));
+        select.appendChild(el("option", { value: "any", text: "any" }));
+      } else {
+        select.appendChild(el("option", { value: "", text: "any" }));
+      }
+      options[id].slice().sort().forEach(function (value) {
+        var count = discover.Count ? discover.Count[countKey(id, value)] : undefined;
+        var label = value === "" ? "(none)" : value;
+        select.appendChild(el("option", { value: value, text: count ? label + " (" + count + ")" : label }));
+      });
+      select.value = state.filters[id] || "";
+    });
+
+    renderPairKeys();
+  }
+
+  function countKey(id, value) {
+    switch (id) {
+      case "filter-class": return "class=" + value;
+      case "filter-eligibility": return "eligibility=" + value;
+      case "filter-status": return "status=" + value;
+      case "filter-version": return "attribute.nomad.version=" + value;
+    }
+  }
+
+  function pairOptions() {
+    if (!discover) {
+      return {};
+    }
+    return $("pair-type").value === "meta" ? discover.Meta : discover.Attribute;
+  }
+
+  function renderPairKeys() {
+    var list = $("pair-keys");
+    list.innerHTML = "";
+    Object.keys(pairOptions() || {}).sort().forEach(function (key) {
+      list.appendChild(el("option", { value: key }));
+    });
+    renderPairValues();
+  }
+
+  function renderPairValues() {
+    var list = $("pair-values");
+    var type = $("pair-type").value;
+    var key = $("pair-key").value;
+    list.innerHTML = "";
+    ((pairOptions() || {})[key] || []).slice().sort().forEach(function (value) {
+      var count = discover.Count ? discover.Count[type + "." + key + "=" + value] : undefined;
+      list.appendChild(el("option", { value: value, label: count ? count + " nodes" : "" }));
+    });
+  }
+
+  function addPair() {
+    var key = $("pair-key").value.trim();
+    var value = $("pair-value").value.trim();
+    if (!key || !value) {
+      return;
+    }
+
+    var id = pairFilters[$("pair-type").value];
+    var pairs = splitList(state.filters[id]);
+    pairs.push(key + "=" + value);
+    state.filters[id] = pairs.join(",");
+
+    $("pair-key").value = "";
+    $("pair-value").value = "";
+    navigate(state);
+  }
+
+  function removeFilter(id, value) {
+    state.filters[id] = splitList(state.filters[id]).filter(function (v) { return v !== value; }).join(",");
+    navigate(state);
+  }
+
+  function removeWhere(value) {
+    state.where = state.where.filter(function (w) { return w !== value; });
+    navigate(state);
+  }
+
+  function renderControls() {
+    document.querySelectorAll("nav a").forEach(function (a) {
+      a.classList.toggle("active", a.getAttribute("data-view") === state.view);
+      a.href = "#" + a.getAttribute("data-view");
+    });
+
+    $("fields-label").firstChild.textContent = state.view === "list" ? "Fields " : "Dimensions ";
+    $("fields").value = state.fields;
+    $("search").value = state.q;
+    $("share").href = location.href;
+
+    filterInputs.forEach(function (id) {
+      $(id).value = state.filters[id] || "";
+    });
+
+    var chips = $("chips");
+    chips.innerHTML = "";
+    Object.keys(pairFilters).forEach(function (type) {
+      var id = pairFilters[type];
+      splitList(state.filters[id]).forEach(function (pair) {
+        chips.appendChild(chip(type + "." + pair, function () { removeFilter(id, pair); }));
+      });
+    });
+    state.where.forEach(function (w) {
+      chips.appendChild(chip("where " + w, function () { removeWhere(w); }));
+    });
+  }
+
+  function chip(text, onRemove) {
+    return el("span", { class: "chip", text: text }, [
+      el("button", { type: "button", title: "Remove", text: "×", onclick: onRemove })
+    ]);
+  }
+
+  function applyControls() {
+    state.fields = splitList($("fields").value).join(",") || defaultFields[state.view];
+    filterInputs.forEach(function (id) {
+      state.filters[id] = $(id).value;
+    });
+    navigate(state);
+  }
+
+  // Table
+
+  function visibleRows() {
+    var where = state.where.map(function (w) {
+      var i = w.indexOf("=");
+      return { index: columns.indexOf(w.substring(0, i)), value: w.substring(i + 1) };
+    });
+    var q = state.q.toLowerCase();
+
+    var result = rows.filter(function (row) {
+      for (var i = 0; i < where.length; i++) {
+        if (where[i].index === -1 || String(row[where[i].index]) !== where[i].value) {
+          return false;
+        }
+      }
+
+      return !q || row.some(function (cell) { return String(cell).toLowerCase().indexOf(q) !== -1; });
+    });
+
+    var sortIndex = columns.indexOf(state.sort);
+    if (sortIndex !== -1) {
+      var direction = state.order === "desc" ? -1 : 1;
+      result.sort(function (a, b) {
+        var x = a[sortIndex], y = b[sortIndex];
+        if (typeof x === "number" && typeof y === "number") {
+          return (x - y) * direction;
+        }
+        return String(x).localeCompare(String(y), undefined, { numeric: true }) * direction;
+      });
+    }
+
+    return result;
+  }
+
+  function renderTable() {
+    var thead = $("table").querySelector("thead");
+    var tbody = $("table").querySelector("tbody");
+    thead.innerHTML = "";
+    tbody.innerHTML = "";
+
+    thead.appendChild(el("tr", {}, columns.map(function (column) {
+      var cls = column === state.sort ? state.order : "";
+      return el("th", { class: cls, text: column, onclick: function () { sortBy(column); } });
+    })));
+
+    var visible = visibleRows();
+    visible.forEach(function (row) {
+      tbody.appendChild(el("tr", {}, row.map(function (cell, i) {
+        if (state.view === "breakdown" && i === row.length - 1) {
+          return el("td", { class: "count" }, [
+            el("a", { href: drillDown(row), title: "Show the matching nodes", text: String(cell) })
+          ]);
+        }
+        return el("td", { text: String(cell) });
+      })));
+    });
+
+    if (state.view === "breakdown") {
+      var total = visible.reduce(function (sum, row) { return sum + row[row.length - 1]; }, 0);
+      $("summary").textContent = visible.length + " of " + rows.length + " groups, " + total + " nodes";
+    } else {
+      $("summary").textContent = visible.length + " of " + rows.length + " nodes";
+    }
+  }
+
+  function sortBy(column) {
+    if (state.sort === column) {
+      state.order = state.order === "asc" ? "desc" : "asc";
+    } else {
+      state.sort = column;
+      state.order = "asc";
+    }
+    replaceState(state);
+    renderTable();
+  }
+
+  // drillDown links a breakdown row to the node list, with a filter for every dimension value.
+  // Dimensions the server can filter on become server filters, the rest are matched in the browser
+  function drillDown(row) {
+    var dimensions = splitList(state.fields);
+    var fields = dimensions.slice();
+    splitList(defaultFields.list).forEach(function (f) {
+      if (fields.indexOf(f) === -1) {
+        fields.push(f);
+      }
+    });
+
+    var target = {
+      view: "list",
+      fields: fields.join(","),
+      filters: Object.assign({}, state.filters),
+      where: state.where.slice(),
+      q: "",
+      sort: "",
+      order: "asc"
+    };
+
+    dimensions.forEach(function (dimension, i) {
+      var value = String(row[i]);
+      var lower = dimension.toLowerCase();
+      var prefix = lower.split(".")[0];
+      var key = dimension.split(".").slice(1).join(".");
+
+      if ((lower === "class" || lower === "nodeclass") && value !== "") {
+        target.filters["filter-class"] = value;
+      } else if ((lower === "eligibility" || lower === "schedulingeligibility") && value !== "") {
+        target.filters["filter-eligibility"] = value;
+      } else if (lower === "status" && value !== "") {
+        target.filters["filter-status"] = value === "ready" ? "" : value;
+      } else if (prefix === "meta" && key && value !== "- missing -") {
+        target.filters["filter-meta"] = splitList(target.filters["filter-meta"]).concat([key + "=" + value]).join(",");
+      } else if ((prefix === "attribute" || prefix === "attributes") && key && value !== "- missing -") {
+        target.filters["filter-attribute"] = splitList(target.filters["filter-attribute"]).concat([key + "=" + value]).join(",");
+      }
+
+      target.where.push(dimension + "=" + value);
+    });
+
+    return toHash(target);
+  }
+
+  // Token
+
+  function saveToken(e) {
+    e.preventDefault();
+    var token = $("token").value;
+    var cookie = "nomad-token=" + encodeURIComponent(token) + "; path=/; SameSite=Strict";
+    if (!token) {
+      cookie += "; max-age=0";
+    }
+    if (location.protocol === "https:") {
+      cookie += "; Secure";
+    }
+    document.cookie = cookie;
+    $("token").value = "";
+    loadDiscover().catch(function () {});
+    load();
+  }
+
+  // Wiring
+
+  $("apply").addEventListener("click", applyControls);
+  $("fields").addEventListener("keydown", function (e) {
+    if (e.key === "Enter") { applyControls(); }
+  });
+  filterInputs.forEach(function (id) {
+    $(id).addEventListener("change", applyControls);
+  });
+  $("pair-type").addEventListener("change", renderPairKeys);
+  $("pair-key").addEventListener("change", renderPairValues);
+  $("pair-add").addEventListener("click", addPair);
+  $("search").addEventListener("input", function () {
+    state.q = $("search").value;
+    replaceState(state);
+    renderTable();
+  });
+  $("token-form").addEventListener("submit", saveToken);
+  document.querySelectorAll("nav a").forEach(function (a) {
+    a.addEventListener("click", function (e) {
+      e.preventDefault();
+      var view = a.getAttribute("data-view");
+      navigate(Object.assign({}, state, { view: view, fields: defaultFields[view], where: [], sort: "", q: "" }));
+    });
+  });
+  window.addEventListener("hashchange", load);
+
+  load();
+  loadDiscover().catch(function (err) {
+    $("error").textContent = "Could not load filter options: " + err.message;
+  });
+})();
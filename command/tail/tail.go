@@ -11,6 +11,7 @@ import (
 
 	"github.com/hashicorp/nomad/api"
 	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli"
 )
@@ -27,7 +28,7 @@ const (
 )
 
 func Run(c *cli.Context) error {
-	nomadClient, err := api.NewClient(api.DefaultConfig())
+	nomadClient, err := nomad.NewNomadClient()
 	if err != nil {
 		return err
 	}
@@ -89,22 +90,11 @@ func getWriter(target, kind, theme string) io.Writer {
 }
 
 func Tail(wr io.Writer, logType, task string, alloc *api.Allocation, client *api.Client, wg *sync.WaitGroup, logger *log.Entry) {
-	var err error
-	var r io.ReadCloser
-	var readErr error
-
 	defer wg.Done()
 
-	// Parse the offset
-	var offset = defaultTailLines * bytesToLines
-	r, readErr = followFile(client, alloc, logger, true, task, logType, api.OriginEnd, offset)
-	r = NewLineLimitReader(r, int(defaultTailLines), int(defaultTailLines*bytesToLines), 1*time.Second)
-	if readErr != nil {
-		readErr = fmt.Errorf("Error tailing file: %v", readErr)
-	}
-
-	if readErr != nil {
-		logger.Error(readErr.Error())
+	r, err := NewLogReader(client, alloc, task, logType, defaultTailLines, true, nil, logger)
+	if err != nil {
+		logger.Error(err.Error())
 		return
 	}
 
@@ -116,8 +106,19 @@ func Tail(wr io.Writer, logType, task string, alloc *api.Allocation, client *api
 	}
 }
 
+// NewLogReader reads the stdout or stderr log of the task, starting with the last lines of
+// the log. When following, the reader is closed once the allocation is done, or when done is closed
+func NewLogReader(client *api.Client, alloc *api.Allocation, task, logType string, lines int64, follow bool, done <-chan struct{}, logger *log.Entry) (io.ReadCloser, error) {
+	r, err := followFile(client, alloc, logger, follow, task, logType, api.OriginEnd, lines*bytesToLines, done)
+	if err != nil {
+		return nil, fmt.Errorf("Error tailing file: %v", err)
+	}
+
+	return NewLineLimitReader(r, int(lines), int(lines*bytesToLines), 1*time.Second), nil
+}
+
 func followFile(client *api.Client, alloc *api.Allocation, logger *log.Entry,
-	follow bool, task, logType, origin string, offset int64) (io.ReadCloser, error) {
+	follow bool, task, logType, origin string, offset int64, done <-chan struct{}) (io.ReadCloser, error) {
 
 	cancel := make(chan struct{})
 	frames, errCh := client.AllocFS().Logs(alloc, follow, task, logType, origin, offset, cancel, nil)
@@ -126,8 +127,6 @@ func followFile(client *api.Client, alloc *api.Allocation, logger *log.Entry,
 		return nil, err
 	default:
 	}
-	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
 
 	// Create a reader
 	var r io.ReadCloser
@@ -135,20 +134,22 @@ func followFile(client *api.Client, alloc *api.Allocation, logger *log.Entry,
 	frameReader.SetUnblockTime(500 * time.Millisecond)
 	r = frameReader
 
-	go func() {
-		<-signalCh
-		r.Close()
-	}()
-
 	go func() {
 		ticker := time.NewTicker(time.Second * 3)
+		defer ticker.Stop()
+
 		for {
 			if isAllocDone(client, alloc, logger, task) {
 				r.Close()
-				ticker.Stop()
 				return
 			}
-			<-ticker.C
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				r.Close()
+				return
+			}
 		}
 	}()
 
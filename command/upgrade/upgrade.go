@@ -0,0 +1,418 @@
+package upgrade
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/olekukonko/tablewriter"
+	"github.com/seatgeek/nomad-helper/helpers"
+	"github.com/seatgeek/nomad-helper/nomad"
+	"github.com/seatgeek/nomad-helper/structs"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	nodeStatusDraining = "draining"
+	nodeStatusDrained  = "drained"
+)
+
+// target is the desired value of a node property, like attribute.nomad.version=1.6.2
+type target struct {
+	raw    string
+	value  string
+	reader helpers.PropReader
+}
+
+type complianceRow struct {
+	Class      string  `json:"class"`
+	Datacenter string  `json:"datacenter"`
+	Compliant  int     `json:"compliant"`
+	Total      int     `json:"total"`
+	Percent    float64 `json:"percent"`
+	Drained    int     `json:"drained"`
+}
+
+func parseTarget(input string) (*target, error) {
+	split := strings.SplitN(input, "=", 2)
+	if len(split) != 2 || split[0] == "" || split[1] == "" {
+		return nil, fmt.Errorf("Could not parse target '%s' as 'key=value' pair", input)
+	}
+
+	key := split[0]
+
+	// Allow the attribute prefix to be left out, 'nomad.version' is a lot nicer to type
+	reader := helpers.NewMetaPropReader(key)
+	if _, err := reader.Read(&api.Node{}); err != nil {
+		reader = helpers.NewMetaPropReader("attribute." + key)
+	}
+
+	return &target{raw: input, value: split[1], reader: reader}, nil
+}
+
+func (t *target) matches(node *api.Node) (bool, error) {
+	values, err := t.reader.Read(node)
+	if err != nil {
+		return false, err
+	}
+
+	return values[0] == t.value, nil
+}
+
+func Status(c *cli.Context, logger *log.Logger) error {
+	target, err := parseTarget(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	campaign, err := loadCampaign(c.String("campaign-file"), target)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := getNodes(c, logger)
+	if err != nil {
+		return err
+	}
+
+	rows, err := computeCompliance(nodes, target, campaign)
+	if err != nil {
+		return err
+	}
+
+	switch format := c.String("output-format"); format {
+	case "table":
+		var b bytes.Buffer
+		writer := bufio.NewWriter(&b)
+		printComplianceTable(rows, writer)
+		writer.Flush()
+		fmt.Println(b.String())
+
+	case "json":
+		jsonText, err := json.Marshal(rows)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jsonText))
+
+	case "json-pretty":
+		jsonText, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jsonText))
+
+	default:
+		return fmt.Errorf("Invalid output-format: %s", format)
+	}
+
+	return nil
+}
+
+func Drain(c *cli.Context, logger *log.Logger) error {
+	target, err := parseTarget(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	batchSize := c.Int("batch-size")
+	if batchSize < 1 {
+		return fmt.Errorf("--batch-size must be at least 1")
+	}
+
+	if c.String("campaign-file") == "" {
+		return fmt.Errorf("--campaign-file is required to keep track of the upgrade progress")
+	}
+
+	campaign, err := loadCampaign(c.String("campaign-file"), target)
+	if err != nil {
+		return err
+	}
+
+	nomadClient, err := nomad.NewNomadClient()
+	if err != nil {
+		return err
+	}
+
+	nodes, err := getNodes(c, logger)
+	if err != nil {
+		return err
+	}
+
+	// Nodes that were draining when a previous run was interrupted go first
+	resumed := make([]*api.Node, 0)
+	pending := make([]*api.Node, 0)
+	for _, node := range nodes {
+		ok, err := target.matches(node)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			continue
+		}
+
+		switch campaign.Nodes[node.ID].Status {
+		case nodeStatusDrained:
+			continue
+		case nodeStatusDraining:
+			resumed = append(resumed, node)
+		default:
+			pending = append(pending, node)
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Name < pending[j].Name
+	})
+	queue := append(resumed, pending...)
+
+	logger.Infof("%d nodes do not match %s yet (%d resumed from a previous run)", len(queue), target.raw, len(resumed))
+
+	for batch := 0; len(queue) > 0; batch++ {
+		if max := c.Int("max-batches"); max > 0 && batch >= max {
+			logger.Infof("Reached --max-batches %d, %d nodes left for the next run", max, len(queue))
+			break
+		}
+
+		size := batchSize
+		if size > len(queue) {
+			size = len(queue)
+		}
+
+		nodes := queue[0:size]
+		queue = queue[size:]
+
+		for _, node := range nodes {
+			logger.Infof("Batch %d: draining node %s (class: %s / datacenter: %s)", batch+1, node.Name, node.NodeClass, node.Datacenter)
+		}
+
+		if c.Bool("dry") {
+			logger.Infof("Skipping drain of batch %d because dry flag was provided", batch+1)
+			continue
+		}
+
+		if err := drainBatch(nomadClient, nodes, campaign, c, logger); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func drainBatch(nomadClient *api.Client, nodes []*api.Node, campaign *structs.UpgradeCampaign, c *cli.Context, logger *log.Logger) error {
+	spec := &api.DrainSpec{
+		Deadline:         c.Duration("deadline"),
+		IgnoreSystemJobs: true,
+	}
+
+	for _, node := range nodes {
+		if campaign.Nodes[node.ID].Status != nodeStatusDraining {
+			if _, err := nomadClient.Nodes().UpdateDrain(node.ID, spec, false, nil); err != nil {
+				return fmt.Errorf("could not drain %s: %s", node.Name, err)
+			}
+		}
+
+		setNodeStatus(campaign, node, nodeStatusDraining)
+	}
+
+	if err := saveCampaign(c.String("campaign-file"), campaign); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(nodes))
+	for i, node := range nodes {
+		wg.Add(1)
+
+		go func(i int, node *api.Node) {
+			defer wg.Done()
+			errs[i] = waitForDrain(nomadClient, node)
+		}(i, node)
+	}
+	wg.Wait()
+
+	for i, node := range nodes {
+		if errs[i] != nil {
+			logger.Errorf("Could not wait for drain of %s: %s", node.Name, errs[i])
+			continue
+		}
+
+		logger.Infof("Node %s is drained", node.Name)
+		setNodeStatus(campaign, node, nodeStatusDrained)
+	}
+
+	if err := saveCampaign(c.String("campaign-file"), campaign); err != nil {
+		return err
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return fmt.Errorf("batch did not drain cleanly, fix the issue and run the command again to resume")
+		}
+	}
+
+	return nil
+}
+
+// waitForDrain uses blocking queries until Nomad removed the drain strategy from the node
+func waitForDrain(nomadClient *api.Client, node *api.Node) error {
+	var index uint64
+	for {
+		info, meta, err := nomadClient.Nodes().Info(node.ID, &api.QueryOptions{WaitIndex: index, WaitTime: 5 * time.Minute})
+		if err != nil {
+			return err
+		}
+
+		if info.DrainStrategy == nil {
+			return nil
+		}
+
+		index = meta.LastIndex
+	}
+}
+
+func getNodes(c *cli.Context, logger *log.Logger) ([]*api.Node, error) {
+	nomadClient, err := nomad.NewNomadClient()
+	if err != nil {
+		return nil, err
+	}
+
+	filters := helpers.ClientFilterFromCLI(c.Parent())
+
+	return helpers.FilteredClientList(nomadClient, false, filters, logger)
+}
+
+func computeCompliance(nodes []*api.Node, target *target, campaign *structs.UpgradeCampaign) ([]*complianceRow, error) {
+	m := make(map[string]*complianceRow)
+	total := &complianceRow{Class: "* total *", Datacenter: "* total *"}
+
+	for _, node := range nodes {
+		key := node.NodeClass + "/" + node.Datacenter
+		row, ok := m[key]
+		if !ok {
+			row = &complianceRow{Class: node.NodeClass, Datacenter: node.Datacenter}
+			m[key] = row
+		}
+
+		compliant, err := target.matches(node)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range []*complianceRow{row, total} {
+			r.Total++
+			if compliant {
+				r.Compliant++
+			} else if campaign.Nodes[node.ID].Status == nodeStatusDrained {
+				r.Drained++
+			}
+		}
+	}
+
+	rows := make([]*complianceRow, 0, len(m)+1)
+	for _, row := range m {
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Class == rows[j].Class {
+			return rows[i].Datacenter < rows[j].Datacenter
+		}
+		return rows[i].Class < rows[j].Class
+	})
+
+	rows = append(rows, total)
+	for _, row := range rows {
+		if row.Total > 0 {
+			row.Percent = float64(row.Compliant) * 100 / float64(row.Total)
+		}
+	}
+
+	return rows, nil
+}
+
+func printComplianceTable(rows []*complianceRow, writer io.Writer) {
+	table := tablewriter.NewWriter(writer)
+	table.SetRowLine(true)
+	table.SetHeader([]string{"class", "datacenter", "compliant", "drained", "total", "percent"})
+
+	for _, row := range rows {
+		table.Append([]string{
+			row.Class,
+			row.Datacenter,
+			fmt.Sprintf("%d", row.Compliant),
+			fmt.Sprintf("%d", row.Drained),
+			fmt.Sprintf("%d", row.Total),
+			fmt.Sprintf("%.1f%%", row.Percent),
+		})
+	}
+
+	table.Render()
+}
+
+func setNodeStatus(campaign *structs.UpgradeCampaign, node *api.Node, status string) {
+	campaign.Nodes[node.ID] = structs.UpgradeNodeState{
+		Name:      node.Name,
+		Status:    status,
+		UpdatedAt: time.Now().UTC().Format(time.RFC1123Z),
+	}
+}
+
+// loadCampaign reads the campaign progress from file, or starts a new campaign
+// if there is no file (yet)
+func loadCampaign(file string, target *target) (*structs.UpgradeCampaign, error) {
+	campaign := &structs.UpgradeCampaign{
+		Target:    target.raw,
+		StartedAt: time.Now().UTC().Format(time.RFC1123Z),
+		Nodes:     make(map[string]structs.UpgradeNodeState),
+	}
+
+	if file == "" {
+		return campaign, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return campaign, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, campaign); err != nil {
+		return nil, err
+	}
+
+	if campaign.Target != target.raw {
+		return nil, fmt.Errorf("campaign file %s is for target '%s', not '%s'", file, campaign.Target, target.raw)
+	}
+
+	if campaign.Nodes == nil {
+		campaign.Nodes = make(map[string]structs.UpgradeNodeState)
+	}
+
+	return campaign, nil
+}
+
+func saveCampaign(file string, campaign *structs.UpgradeCampaign) error {
+	campaign.UpdatedAt = time.Now().UTC().Format(time.RFC1123Z)
+
+	bytes, err := yaml.Marshal(campaign)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, bytes, 0644)
+}
@@ -0,0 +1,130 @@
+package upgrade
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/nomad-helper/structs"
+)
+
+func TestParseTarget(t *testing.T) {
+	for _, input := range []string{"", "nomad.version", "=1.4.2", "nomad.version="} {
+		if _, err := parseTarget(input); err == nil {
+			t.Errorf("expected an error parsing %q", input)
+		}
+	}
+
+	node := &api.Node{Attributes: map[string]string{"nomad.version": "1.4.2"}, NodeClass: "web"}
+
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{input: "attribute.nomad.version=1.4.2", want: true},
+		{input: "nomad.version=1.4.2", want: true},
+		{input: "nomad.version=1.4.20", want: false},
+		{input: "nomad.version=1.4", want: false},
+		{input: "class=web", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			target, err := parseTarget(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			got, err := target.matches(node)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeCompliance(t *testing.T) {
+	target, err := parseTarget("nomad.version=1.4.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := func(id, class, dc, version string) *api.Node {
+		return &api.Node{ID: id, NodeClass: class, Datacenter: dc, Attributes: map[string]string{"nomad.version": version}}
+	}
+
+	nodes := []*api.Node{
+		node("1", "web", "dc1", "1.4.2"),
+		node("2", "web", "dc1", "1.3.0"),
+		node("3", "web", "dc1", "1.3.0"),
+		node("4", "batch", "dc2", "1.4.2"),
+	}
+
+	campaign := &structs.UpgradeCampaign{Nodes: map[string]structs.UpgradeNodeState{
+		"2": {Status: nodeStatusDrained},
+		"3": {Status: nodeStatusDraining},
+	}}
+
+	rows, err := computeCompliance(nodes, target, campaign)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]complianceRow, 0, len(rows))
+	for _, row := range rows {
+		got = append(got, *row)
+	}
+
+	want := []complianceRow{
+		{Class: "batch", Datacenter: "dc2", Compliant: 1, Total: 1, Percent: 100},
+		{Class: "web", Datacenter: "dc1", Compliant: 1, Total: 3, Percent: 100.0 / 3, Drained: 1},
+		{Class: "* total *", Datacenter: "* total *", Compliant: 2, Total: 4, Percent: 50, Drained: 1},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestCampaignFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "campaign.yml")
+
+	target, err := parseTarget("nomad.version=1.4.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a missing file starts a new campaign
+	campaign, err := loadCampaign(file, target)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(campaign.Nodes) != 0 || campaign.Target != target.raw {
+		t.Fatalf("unexpected new campaign %+v", campaign)
+	}
+
+	setNodeStatus(campaign, &api.Node{ID: "1", Name: "node-1"}, nodeStatusDrained)
+	if err := saveCampaign(file, campaign); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadCampaign(file, target)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if state := loaded.Nodes["1"]; state.Name != "node-1" || state.Status != nodeStatusDrained {
+		t.Errorf("got node state %+v after loading the campaign", state)
+	}
+
+	other, err := parseTarget("nomad.version=1.5.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCampaign(file, other); err == nil {
+		t.Errorf("expected an error loading a campaign for another target")
+	}
+}
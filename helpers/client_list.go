@@ -1,9 +1,12 @@
 package helpers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"os"
+	"reflect"
 	"runtime"
 	"strings"
 	"sync"
@@ -23,25 +26,33 @@ var (
 )
 
 type ClientFilter struct {
+	AllStatuses bool
 	Attribute   []string
 	Class       string
+	Count       int
 	Eligibility string
 	Meta        []string
 	NOOP        bool
 	Percent     int
 	Prefix      string
+	SpreadBy    string
+	Status      []string
 	Version     string
 }
 
 func ClientFilterFromCLI(c *cli.Context) ClientFilter {
 	filter := ClientFilter{
+		AllStatuses: c.Bool("all-statuses"),
 		Attribute:   DeleteEmpty(c.StringSlice("filter-attribute")),
 		Class:       c.String("filter-class"),
+		Count:       c.Int("count"),
 		Eligibility: c.String("filter-eligibility"),
 		Meta:        DeleteEmpty(c.StringSlice("filter-meta")),
 		NOOP:        c.Bool("noop"),
 		Percent:     c.Int("percent"),
 		Prefix:      c.String("filter-prefix"),
+		SpreadBy:    c.String("spread-by"),
+		Status:      DeleteEmpty(c.StringSlice("filter-status")),
 		Version:     c.String("filter-version"),
 	}
 
@@ -50,12 +61,14 @@ func ClientFilterFromCLI(c *cli.Context) ClientFilter {
 
 func ClientFilterFromWeb(r *http.Request) ClientFilter {
 	filter := ClientFilter{
+		AllStatuses: r.URL.Query().Get("all-statuses") == "true",
 		Attribute:   DeleteEmpty(strings.Split(r.URL.Query().Get("filter-attribute"), ",")),
 		Class:       r.URL.Query().Get("filter-class"),
 		Eligibility: r.URL.Query().Get("filter-eligibility"),
 		Meta:        DeleteEmpty(strings.Split(r.URL.Query().Get("filter-meta"), ",")),
 		Percent:     100,
 		Prefix:      r.URL.Query().Get("filter-prefix"),
+		Status:      DeleteEmpty(strings.Split(r.URL.Query().Get("filter-status"), ",")),
 		Version:     r.URL.Query().Get("filter-version"),
 	}
 
@@ -70,7 +83,72 @@ func init() {
 	stderrLog.Out = os.Stderr
 }
 
+// Validate checks the filters can be parsed, before any nodes are read
+func (filter ClientFilter) Validate() error {
+	for _, list := range [][]string{filter.Meta, filter.Attribute} {
+		for _, chunk := range list {
+			if len(strings.Split(chunk, "=")) != 2 {
+				return InvalidInputf("Could not parse filter '%s' as 'key=value' pair", chunk)
+			}
+		}
+	}
+
+	if filter.AllStatuses && len(filter.Status) > 0 {
+		return InvalidInputf("Only one of all-statuses and filter-status can be used")
+	}
+
+	if filter.Count < 0 {
+		return InvalidInputf("Invalid count %d", filter.Count)
+	}
+
+	if filter.Percent < 0 || filter.Percent > 100 {
+		return InvalidInputf("Invalid percent %d, must be between 0 and 100", filter.Percent)
+	}
+
+	if filter.Count > 0 && filter.Percent > 0 && filter.Percent < 100 {
+		return InvalidInputf("Only one of percent and count can be used")
+	}
+
+	if filter.SpreadBy != "" {
+		if filter.Count == 0 && (filter.Percent <= 0 || filter.Percent >= 100) {
+			return InvalidInputf("Spreading by '%s' needs a percent or count of nodes", filter.SpreadBy)
+		}
+
+		if _, err := NewMetaPropReader(filter.SpreadBy).Read(&api.Node{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// statuses are the node statuses to match, only ready nodes unless asked otherwise
+func (filter ClientFilter) statuses() []string {
+	if len(filter.Status) == 0 {
+		return []string{"ready"}
+	}
+
+	return filter.Status
+}
+
+// selectionCount is how many of the matched nodes should be used
+func (filter ClientFilter) selectionCount(matched int) int {
+	if filter.Count > 0 && filter.Count < matched {
+		return filter.Count
+	}
+
+	if percent := filter.Percent; percent > 0 && percent < 100 {
+		return matched * percent / 100
+	}
+
+	return matched
+}
+
 func FilteredClientList(client *api.Client, progress bool, filter ClientFilter, logger *log.Logger) ([]*api.Node, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
 	stderrLog.SetLevel(logger.GetLevel())
 
 	stderrLog.Info("Finding eligible nodes")
@@ -129,10 +207,18 @@ func FilteredClientList(client *api.Client, progress bool, filter ClientFilter,
 
 	stderrLog.Infof("Found %d matched nodes", len(matches))
 
-	// only work on specific percent of nodes
-	if percent := filter.Percent; percent > 0 && percent < 100 {
-		stderrLog.Infof("Only %d percent of nodes should be used", percent)
-		matches = matches[0 : len(matches)*percent/100]
+	// only work on a specific percent or count of nodes, picked the same way on every run
+	if count := filter.selectionCount(len(matches)); count < len(matches) {
+		if filter.SpreadBy != "" {
+			stderrLog.Infof("Only %d nodes should be used, spread by %s", count, filter.SpreadBy)
+		} else {
+			stderrLog.Infof("Only %d nodes should be used", count)
+		}
+
+		matches, err = selectNodes(matches, count, filter.SpreadBy)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// noop mode will fail the matching to prevent any further processing
@@ -150,9 +236,9 @@ func readNodeWorker(filter ClientFilter, client *api.Client) func(payload interf
 	return func(payload interface{}) interface{} {
 		nodeStub := payload.(*api.NodeListStub)
 
-		// only consider nodes that is ready
-		if nodeStub.Status != "ready" {
-			stderrLog.Debugf("Node %s is not in status=ready (%s)", nodeStub.Name, nodeStub.Status)
+		// only consider nodes with the right status
+		if statuses := filter.statuses(); !filter.AllStatuses && !Contains(nodeStub.Status, statuses) {
+			stderrLog.Debugf("Node %s status '%s' do not match expected status '%s'", nodeStub.Name, nodeStub.Status, strings.Join(statuses, ","))
 			return nil
 		}
 
@@ -175,7 +261,7 @@ func readNodeWorker(filter ClientFilter, client *api.Client) func(payload interf
 		}
 
 		// Read full Node info from Nomad
-		node, err := lookupNode(nodeStub.ID, client)
+		node, err := LookupNode(nodeStub.ID, client)
 		if err != nil {
 			stderrLog.Error(err)
 			return nil
@@ -241,8 +327,15 @@ func getNodeAttributesProperty(node *api.Node, key string) string {
 	return d
 }
 
-func lookupNode(nodeID string, client *api.Client) (*api.Node, error) {
-	item, err := nodeCache.Fetch(nodeID, 1*time.Minute, func() (interface{}, error) {
+// LookupNode reads a node from Nomad, cached for a minute per cluster, region and token
+func LookupNode(nodeID string, client *api.Client) (*api.Node, error) {
+	scope, ok := cacheScope(client)
+	if !ok {
+		node, _, err := client.Nodes().Info(nodeID, nil)
+		return node, err
+	}
+
+	item, err := nodeCache.Fetch(scope+"/"+nodeID, 1*time.Minute, func() (interface{}, error) {
 		node, _, err := client.Nodes().Info(nodeID, nil)
 		if err != nil {
 			return nil, err
@@ -257,3 +350,23 @@ func lookupNode(nodeID string, client *api.Client) (*api.Node, error) {
 
 	return item.Value().(*api.Node), nil
 }
+
+// cacheScope tells apart the clients of different clusters, regions and ACL tokens, so a
+// cached node or job is only handed to callers that are allowed to read it themselves, like
+// the callers of the server with their own Nomad token. The api package has no getters for
+// the region and token of a client, so they are read from its configuration. Nothing may
+// be cached when that fails
+func cacheScope(client *api.Client) (string, bool) {
+	config := reflect.ValueOf(client).Elem().FieldByName("config")
+	if !config.IsValid() {
+		return "", false
+	}
+
+	region, token := config.FieldByName("Region"), config.FieldByName("SecretID")
+	if region.Kind() != reflect.String || token.Kind() != reflect.String {
+		return "", false
+	}
+
+	sum := sha256.Sum256([]byte(client.Address() + "\x00" + region.String() + "\x00" + token.String()))
+	return hex.EncodeToString(sum[:8]), true
+}
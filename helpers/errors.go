@@ -0,0 +1,27 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidInput matches (with errors.Is) all errors caused by invalid user input, like an
+// unknown field or output format, so the server can tell them apart from Nomad errors
+var ErrInvalidInput = errors.New("invalid input")
+
+type inputError struct {
+	msg string
+}
+
+func (e *inputError) Error() string {
+	return e.msg
+}
+
+func (e *inputError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+// InvalidInputf formats an error caused by invalid user input
+func InvalidInputf(format string, a ...interface{}) error {
+	return &inputError{msg: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,144 @@
+package helpers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/karlseguin/ccache"
+	"github.com/urfave/cli"
+)
+
+var jobCache = ccache.New(ccache.Configure().MaxSize(5000).ItemsToPrune(10))
+
+// JobFilter narrows down jobs, like ClientFilter does for nodes
+type JobFilter struct {
+	Datacenter string
+	Meta       []string
+	Namespace  string
+	Prefix     string
+	Status     string
+	Type       string
+}
+
+func JobFilterFromCLI(c *cli.Context) JobFilter {
+	return JobFilter{
+		Datacenter: c.String("filter-datacenter"),
+		Meta:       DeleteEmpty(c.StringSlice("filter-meta")),
+		Namespace:  c.String("filter-namespace"),
+		Prefix:     c.String("filter-prefix"),
+		Status:     c.String("filter-status"),
+		Type:       c.String("filter-type"),
+	}
+}
+
+func JobFilterFromWeb(r *http.Request) JobFilter {
+	return JobFilter{
+		Datacenter: r.URL.Query().Get("filter-datacenter"),
+		Meta:       DeleteEmpty(strings.Split(r.URL.Query().Get("filter-meta"), ",")),
+		Namespace:  r.URL.Query().Get("filter-namespace"),
+		Prefix:     r.URL.Query().Get("filter-prefix"),
+		Status:     r.URL.Query().Get("filter-status"),
+		Type:       r.URL.Query().Get("filter-type"),
+	}
+}
+
+// Validate checks the filters can be parsed, before any jobs are read
+func (filter JobFilter) Validate() error {
+	for _, chunk := range filter.Meta {
+		if len(strings.SplitN(chunk, "=", 2)) != 2 {
+			return InvalidInputf("Could not parse filter '%s' as 'key=value' pair", chunk)
+		}
+	}
+
+	return nil
+}
+
+// FilteredJobList lists the jobs matching the filters. The full jobs are only read from
+// Nomad when filtering by meta. Without a namespace filter the namespace of the Nomad
+// client is used, "*" lists the jobs of all namespaces
+func FilteredJobList(client *api.Client, filter JobFilter) ([]*api.JobListStub, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	jobs, _, err := client.Jobs().List(&api.QueryOptions{Namespace: filter.Namespace, Prefix: filter.Prefix})
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]*api.JobListStub, 0, len(jobs))
+	for _, job := range jobs {
+		if filter.Type != "" && job.Type != filter.Type {
+			continue
+		}
+
+		if filter.Status != "" && job.Status != filter.Status {
+			continue
+		}
+
+		if filter.Datacenter != "" && !Contains(filter.Datacenter, job.Datacenters) {
+			continue
+		}
+
+		if len(filter.Meta) > 0 {
+			full, err := LookupJob(job, client)
+			if err != nil {
+				return nil, err
+			}
+
+			if !matchJobMeta(full, filter.Meta) {
+				continue
+			}
+		}
+
+		matches = append(matches, job)
+	}
+
+	return matches, nil
+}
+
+func matchJobMeta(job *api.Job, meta []string) bool {
+	for _, chunk := range meta {
+		split := strings.SplitN(chunk, "=", 2)
+
+		value, ok := job.Meta[split[0]]
+		if !ok {
+			value = "__not_found__"
+		}
+
+		if value != split[1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// LookupJob reads the full job of a job list entry, cached until the job changes, per
+// cluster, region and token
+func LookupJob(job *api.JobListStub, client *api.Client) (*api.Job, error) {
+	scope, ok := cacheScope(client)
+	if !ok {
+		full, _, err := client.Jobs().Info(job.ID, &api.QueryOptions{Namespace: job.Namespace})
+		return full, err
+	}
+
+	key := fmt.Sprintf("%s/%s/%s@%d", scope, job.Namespace, job.ID, job.JobModifyIndex)
+
+	item, err := jobCache.Fetch(key, 5*time.Minute, func() (interface{}, error) {
+		full, _, err := client.Jobs().Info(job.ID, &api.QueryOptions{Namespace: job.Namespace})
+		if err != nil {
+			return nil, err
+		}
+
+		return full, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item.Value().(*api.Job), nil
+}
@@ -0,0 +1,425 @@
+package helpers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	api "github.com/hashicorp/nomad/api"
+)
+
+// JobReader reads fields from Nomad jobs, like Reader does for nodes. The fields that are
+// not in the job list (like meta, groups and constraints) are available with WithJobs
+type JobReader struct {
+	keys []string
+	jobs func(job *api.JobListStub) (*api.Job, error)
+}
+
+func NewJobPropReader(props ...string) JobReader {
+	return JobReader{keys: props}
+}
+
+// WithJobs returns a reader that looks up the full jobs with client, for the fields that
+// are not in the job list
+func (r JobReader) WithJobs(client *api.Client) JobReader {
+	r.jobs = func(job *api.JobListStub) (*api.Job, error) {
+		return LookupJob(job, client)
+	}
+
+	return r
+}
+
+func (r JobReader) GetKeys() []string {
+	return r.keys
+}
+
+func (r JobReader) Read(job *api.JobListStub) ([]string, error) {
+	s := make([]string, 0)
+
+	for _, prop := range r.keys {
+		val, err := r.getPropValue(prop, job)
+		if err != nil {
+			return nil, err
+		}
+
+		s = append(s, val)
+	}
+
+	return s, nil
+}
+
+func (r JobReader) ReadMap(job *api.JobListStub) (map[string]string, error) {
+	s := make(map[string]string, 0)
+
+	for _, prop := range r.keys {
+		val, err := r.getPropValue(prop, job)
+		if err != nil {
+			return nil, err
+		}
+
+		s[prop] = val
+	}
+
+	return s, nil
+}
+
+func (r JobReader) getPropValue(prop string, job *api.JobListStub) (string, error) {
+	lower := strings.ToLower(prop)
+	if strings.HasPrefix(lower, "meta.") || fullJobFields[lower] {
+		return r.getJobPropValue(prop, job)
+	}
+
+	switch lower {
+	case "id":
+		return job.ID, nil
+
+	case "name":
+		return job.Name, nil
+
+	case "namespace":
+		return job.Namespace, nil
+
+	case "parent", "parentid":
+		return job.ParentID, nil
+
+	case "type":
+		return job.Type, nil
+
+	case "priority":
+		return fmt.Sprintf("%d", job.Priority), nil
+
+	case "status":
+		return job.Status, nil
+
+	case "description", "statusdescription":
+		return job.StatusDescription, nil
+
+	case "datacenters", "dc":
+		return strings.Join(job.Datacenters, ","), nil
+
+	case "stop":
+		return fmt.Sprintf("%+v", job.Stop), nil
+
+	case "periodic":
+		return fmt.Sprintf("%+v", job.Periodic), nil
+
+	case "parameterized":
+		return fmt.Sprintf("%+v", job.ParameterizedJob), nil
+
+	case "submitted", "submittime":
+		return formatNanoTime(job.SubmitTime), nil
+
+	// Allocation counts, summed over all task groups
+	case "queued", "starting", "running", "complete", "failed", "lost", "unknown":
+		return fmt.Sprintf("%d", jobSummaryCount(job.JobSummary, strings.ToLower(prop))), nil
+
+	default:
+		return "", InvalidInputf("Don't know how to find value for '%s'", prop)
+	}
+}
+
+// Fields that are only in the full job
+var fullJobFields = map[string]bool{
+	"version": true, "stable": true, "region": true, "groups": true, "count": true, "constraints": true,
+}
+
+func (r JobReader) getJobPropValue(prop string, stub *api.JobListStub) (string, error) {
+	if r.jobs == nil {
+		return "", InvalidInputf("Job fields like '%s' are not available here", prop)
+	}
+
+	job, err := r.jobs(stub)
+	if err != nil {
+		return "", err
+	}
+
+	chunks := strings.Split(prop, ".")
+
+	switch strings.ToLower(chunks[0]) {
+	case "meta":
+		value, ok := job.Meta[strings.Join(chunks[1:], ".")]
+		if !ok {
+			return "- missing -", nil
+		}
+		return value, nil
+
+	case "version":
+		if job.Version == nil {
+			return "", nil
+		}
+		return fmt.Sprintf("%d", *job.Version), nil
+
+	case "stable":
+		return fmt.Sprintf("%+v", job.Stable != nil && *job.Stable), nil
+
+	case "region":
+		if job.Region == nil {
+			return "", nil
+		}
+		return *job.Region, nil
+
+	case "groups":
+		return fmt.Sprintf("%d", len(job.TaskGroups)), nil
+
+	case "count":
+		count := 0
+		for _, group := range job.TaskGroups {
+			if group.Count != nil {
+				count += *group.Count
+			}
+		}
+		return fmt.Sprintf("%d", count), nil
+
+	case "constraints":
+		return strings.Join(jobConstraints(job), "; "), nil
+
+	default:
+		return "", InvalidInputf("Don't know how to find value for '%s'", prop)
+	}
+}
+
+// jobConstraints lists the distinct constraints of the job, its groups and tasks, like
+// "${node.class} = web", sorted
+func jobConstraints(job *api.Job) []string {
+	constraints := append([]*api.Constraint{}, job.Constraints...)
+	for _, group := range job.TaskGroups {
+		constraints = append(constraints, group.Constraints...)
+		for _, task := range group.Tasks {
+			constraints = append(constraints, task.Constraints...)
+		}
+	}
+
+	seen := make(map[string]bool)
+	result := make([]string, 0)
+	for _, c := range constraints {
+		operand := c.Operand
+		if operand == "" {
+			operand = "="
+		}
+
+		s := strings.TrimSpace(fmt.Sprintf("%s %s %s", c.LTarget, operand, c.RTarget))
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+func jobSummaryCount(summary *api.JobSummary, status string) int {
+	if summary == nil {
+		return 0
+	}
+
+	count := 0
+	for _, group := range summary.Summary {
+		switch status {
+		case "queued":
+			count += group.Queued
+		case "starting":
+			count += group.Starting
+		case "running":
+			count += group.Running
+		case "complete":
+			count += group.Complete
+		case "failed":
+			count += group.Failed
+		case "lost":
+			count += group.Lost
+		case "unknown":
+			count += group.Unknown
+		}
+	}
+
+	return count
+}
+
+// AllocReader reads fields from Nomad allocations, like Reader does for nodes. The fields
+// of the node an allocation runs on are available as "node.<field>" with WithNodes
+type AllocReader struct {
+	keys  []string
+	nodes func(nodeID string) (*api.Node, error)
+}
+
+func NewAllocPropReader(props ...string) AllocReader {
+	return AllocReader{keys: props}
+}
+
+// WithNodes returns a reader that looks up the nodes of the allocations with client, for the
+// "node.<field>" fields
+func (r AllocReader) WithNodes(client *api.Client) AllocReader {
+	r.nodes = func(nodeID string) (*api.Node, error) {
+		return LookupNode(nodeID, client)
+	}
+
+	return r
+}
+
+func (r AllocReader) GetKeys() []string {
+	return r.keys
+}
+
+func (r AllocReader) Read(alloc *api.AllocationListStub) ([]string, error) {
+	s := make([]string, 0)
+
+	for _, prop := range r.keys {
+		val, err := r.getPropValue(prop, alloc)
+		if err != nil {
+			return nil, err
+		}
+
+		s = append(s, val)
+	}
+
+	return s, nil
+}
+
+func (r AllocReader) ReadMap(alloc *api.AllocationListStub) (map[string]string, error) {
+	s := make(map[string]string, 0)
+
+	for _, prop := range r.keys {
+		val, err := r.getPropValue(prop, alloc)
+		if err != nil {
+			return nil, err
+		}
+
+		s[prop] = val
+	}
+
+	return s, nil
+}
+
+func (r AllocReader) getPropValue(prop string, alloc *api.AllocationListStub) (string, error) {
+	if strings.HasPrefix(strings.ToLower(prop), "node.") {
+		return r.getNodePropValue(prop[len("node."):], alloc)
+	}
+
+	switch strings.ToLower(prop) {
+	case "id":
+		return alloc.ID, nil
+
+	case "name":
+		return alloc.Name, nil
+
+	case "namespace":
+		return alloc.Namespace, nil
+
+	case "eval", "evalid":
+		return alloc.EvalID, nil
+
+	case "node", "nodename":
+		return alloc.NodeName, nil
+
+	case "nodeid":
+		return alloc.NodeID, nil
+
+	case "job", "jobid":
+		return alloc.JobID, nil
+
+	case "jobtype":
+		return alloc.JobType, nil
+
+	case "version", "jobversion":
+		return fmt.Sprintf("%d", alloc.JobVersion), nil
+
+	case "group", "taskgroup":
+		return alloc.TaskGroup, nil
+
+	case "desired", "desiredstatus":
+		return alloc.DesiredStatus, nil
+
+	case "desireddescription":
+		return alloc.DesiredDescription, nil
+
+	case "status", "clientstatus":
+		return alloc.ClientStatus, nil
+
+	case "description", "clientdescription":
+		return alloc.ClientDescription, nil
+
+	case "healthy":
+		if alloc.DeploymentStatus == nil || alloc.DeploymentStatus.Healthy == nil {
+			return "- unset -", nil
+		}
+		return fmt.Sprintf("%+v", *alloc.DeploymentStatus.Healthy), nil
+
+	case "canary":
+		return fmt.Sprintf("%+v", alloc.DeploymentStatus != nil && alloc.DeploymentStatus.Canary), nil
+
+	case "tasks", "task":
+		tasks := make([]string, 0, len(alloc.TaskStates))
+		for name := range alloc.TaskStates {
+			tasks = append(tasks, name)
+		}
+		sort.Strings(tasks)
+		return strings.Join(tasks, ","), nil
+
+	case "restarts":
+		restarts := uint64(0)
+		for _, state := range alloc.TaskStates {
+			if state != nil {
+				restarts += state.Restarts
+			}
+		}
+		return fmt.Sprintf("%d", restarts), nil
+
+	case "age":
+		return formatAge(alloc.CreateTime), nil
+
+	case "created", "createtime":
+		return formatNanoTime(alloc.CreateTime), nil
+
+	case "modified", "modifytime":
+		return formatNanoTime(alloc.ModifyTime), nil
+
+	default:
+		return "", InvalidInputf("Don't know how to find value for '%s'", prop)
+	}
+}
+
+func (r AllocReader) getNodePropValue(prop string, alloc *api.AllocationListStub) (string, error) {
+	if r.nodes == nil {
+		return "", InvalidInputf("Node fields like 'node.%s' are not available here", prop)
+	}
+
+	node, err := r.nodes(alloc.NodeID)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := NewMetaPropReader(prop).Read(node)
+	if err != nil {
+		return "", err
+	}
+
+	return value[0], nil
+}
+
+// formatAge is how long ago t was, in the largest whole unit so allocations of about the same
+// age are grouped in breakdowns, like "3d", "5h" or "12m"
+func formatAge(t int64) string {
+	if t == 0 {
+		return ""
+	}
+
+	age := time.Since(time.Unix(0, t))
+	switch {
+	case age >= 48*time.Hour:
+		return fmt.Sprintf("%dd", age/(24*time.Hour))
+	case age >= time.Hour:
+		return fmt.Sprintf("%dh", age/time.Hour)
+	default:
+		return fmt.Sprintf("%dm", age/time.Minute)
+	}
+}
+
+func formatNanoTime(t int64) string {
+	if t == 0 {
+		return ""
+	}
+
+	return time.Unix(0, t).UTC().Format(time.RFC3339)
+}
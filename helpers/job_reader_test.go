@@ -0,0 +1,132 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+
+	api "github.com/hashicorp/nomad/api"
+)
+
+func TestJobReader(t *testing.T) {
+	job := &api.JobListStub{
+		ID:          "web",
+		Type:        "service",
+		Priority:    50,
+		Datacenters: []string{"us-east-1", "us-west-2"},
+		JobSummary: &api.JobSummary{
+			Summary: map[string]api.TaskGroupSummary{
+				"app":   {Running: 3, Failed: 1},
+				"proxy": {Running: 2},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		props   []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "fields and aliases",
+			props: []string{"ID", "type", "priority", "dc"},
+			want:  []string{"web", "service", "50", "us-east-1,us-west-2"},
+		},
+		{
+			name:  "summary counts over all groups",
+			props: []string{"running", "failed", "queued"},
+			want:  []string{"5", "1", "0"},
+		},
+		{
+			name:  "full job fields",
+			props: []string{"meta.owner", "meta.team", "version", "stable", "groups", "count", "constraints"},
+			want:  []string{"payments", "- missing -", "4", "true", "2", "5", "${attr.kernel.name} = linux; ${node.class} = web"},
+		},
+		{
+			name:    "unknown field",
+			props:   []string{"bogus"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewJobPropReader(tt.props...)
+			reader.jobs = func(stub *api.JobListStub) (*api.Job, error) {
+				version := uint64(4)
+				web := &api.Constraint{LTarget: "${node.class}", RTarget: "web", Operand: "="}
+				return &api.Job{
+					Version:     &version,
+					Stable:      BoolToPtr(true),
+					Meta:        map[string]string{"owner": "payments"},
+					Constraints: []*api.Constraint{web},
+					TaskGroups: []*api.TaskGroup{
+						{Count: IntToPtr(3), Tasks: []*api.Task{{Constraints: []*api.Constraint{web}}}},
+						{Count: IntToPtr(2), Constraints: []*api.Constraint{{LTarget: "${attr.kernel.name}", RTarget: "linux"}}},
+					},
+				}, nil
+			}
+
+			got, err := reader.Read(job)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocReader(t *testing.T) {
+	healthy := true
+	alloc := &api.AllocationListStub{
+		ID:               "6f3c8a40-1f2b-4c1e-9a0c-0e5b8f1d2a3b",
+		JobID:            "web",
+		JobVersion:       4,
+		NodeName:         "worker-1",
+		TaskGroup:        "app",
+		ClientStatus:     "running",
+		DeploymentStatus: &api.AllocDeploymentStatus{Healthy: &healthy},
+		NodeID:           "node-1",
+		TaskStates:       map[string]*api.TaskState{"web": {Restarts: 2}, "log-shipper": {Restarts: 1}},
+		CreateTime:       1600000000000000000,
+	}
+
+	tests := []struct {
+		name  string
+		props []string
+		want  []string
+	}{
+		{
+			name:  "fields and aliases",
+			props: []string{"job", "version", "node", "group", "status"},
+			want:  []string{"web", "4", "worker-1", "app", "running"},
+		},
+		{
+			name:  "derived fields",
+			props: []string{"healthy", "canary", "tasks", "created", "modified"},
+			want:  []string{"true", "false", "log-shipper,web", "2020-09-13T12:26:40Z", ""},
+		},
+		{
+			name:  "restarts and node fields",
+			props: []string{"restarts", "node.class", "node.meta.zone"},
+			want:  []string{"3", "batch", "us-east-1a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewAllocPropReader(tt.props...)
+			reader.nodes = func(nodeID string) (*api.Node, error) {
+				return &api.Node{ID: nodeID, NodeClass: "batch", Meta: map[string]string{"zone": "us-east-1a"}}, nil
+			}
+
+			got, err := reader.Read(alloc)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
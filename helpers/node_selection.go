@@ -0,0 +1,67 @@
+package helpers
+
+import (
+	"hash/fnv"
+	"sort"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// selectNodes picks count nodes from matches. The nodes are ordered by a hash of their ID, so
+// repeated runs pick the same nodes, and new or removed nodes barely change the selection.
+//
+// With spreadBy (a node field like "meta.aws.instance.availability-zone") the nodes are picked
+// round-robin from every value of the field, so each value gets an even share of the selection
+func selectNodes(matches []*api.Node, count int, spreadBy string) ([]*api.Node, error) {
+	sorted := make([]*api.Node, len(matches))
+	copy(sorted, matches)
+	sort.Slice(sorted, func(i, j int) bool {
+		hi, hj := nodeHash(sorted[i]), nodeHash(sorted[j])
+		if hi != hj {
+			return hi < hj
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	if count >= len(sorted) {
+		return sorted, nil
+	}
+
+	if spreadBy == "" {
+		return sorted[:count], nil
+	}
+
+	reader := NewMetaPropReader(spreadBy)
+	groups := make(map[string][]*api.Node)
+	for _, node := range sorted {
+		value, err := reader.Read(node)
+		if err != nil {
+			return nil, err
+		}
+
+		groups[value[0]] = append(groups[value[0]], node)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	selected := make([]*api.Node, 0, count)
+	for round := 0; len(selected) < count; round++ {
+		for _, key := range keys {
+			if round < len(groups[key]) && len(selected) < count {
+				selected = append(selected, groups[key][round])
+			}
+		}
+	}
+
+	return selected, nil
+}
+
+func nodeHash(node *api.Node) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(node.ID))
+	return h.Sum64()
+}
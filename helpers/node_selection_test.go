@@ -0,0 +1,102 @@
+package helpers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestSelectNodes(t *testing.T) {
+	nodes := make([]*api.Node, 0)
+	for i := 0; i < 12; i++ {
+		zone := []string{"a", "b", "c"}[i%3]
+		// zone c only has 2 nodes
+		if zone == "c" && i > 5 {
+			zone = "a"
+		}
+		nodes = append(nodes, &api.Node{ID: fmt.Sprintf("node-%d", i), Meta: map[string]string{"zone": zone}})
+	}
+
+	reversed := make([]*api.Node, len(nodes))
+	for i, node := range nodes {
+		reversed[len(nodes)-1-i] = node
+	}
+
+	tests := []struct {
+		name     string
+		count    int
+		spreadBy string
+		want     map[string]int // nodes selected per zone
+	}{
+		{name: "all nodes", count: 20, want: map[string]int{"a": 6, "b": 4, "c": 2}},
+		{name: "spread evenly", count: 6, spreadBy: "meta.zone", want: map[string]int{"a": 2, "b": 2, "c": 2}},
+		{name: "small zone runs out", count: 9, spreadBy: "meta.zone", want: map[string]int{"a": 4, "b": 3, "c": 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectNodes(nodes, tt.count, tt.spreadBy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			zones := make(map[string]int)
+			for _, node := range got {
+				zones[node.Meta["zone"]]++
+			}
+			if !reflect.DeepEqual(zones, tt.want) {
+				t.Errorf("got %v nodes per zone, want %v", zones, tt.want)
+			}
+
+			// the input order must not change the selection
+			again, _ := selectNodes(reversed, tt.count, tt.spreadBy)
+			if !reflect.DeepEqual(got, again) {
+				t.Errorf("selection depends on the order of the nodes")
+			}
+		})
+	}
+}
+
+func TestClientFilterValidateSelection(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  ClientFilter
+		wantErr bool
+	}{
+		{name: "defaults", filter: ClientFilter{Percent: 100}},
+		{name: "count", filter: ClientFilter{Percent: 100, Count: 3, SpreadBy: "meta.zone"}},
+		{name: "percent and count", filter: ClientFilter{Percent: 10, Count: 3}, wantErr: true},
+		{name: "spread without a subset", filter: ClientFilter{Percent: 100, SpreadBy: "meta.zone"}, wantErr: true},
+		{name: "unknown spread field", filter: ClientFilter{Percent: 10, SpreadBy: "bogus"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientFilterValidateStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  ClientFilter
+		wantErr bool
+	}{
+		{name: "some statuses", filter: ClientFilter{Percent: 100, Status: []string{"ready", "down"}}},
+		{name: "all statuses", filter: ClientFilter{Percent: 100, AllStatuses: true}},
+		{name: "all and some statuses", filter: ClientFilter{Percent: 100, AllStatuses: true, Status: []string{"down"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
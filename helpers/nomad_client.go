@@ -3,13 +3,13 @@ package helpers
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	api "github.com/hashicorp/nomad/api"
 )
 
 type PropReader interface {
 	Read(node *api.Node) ([]string, error)
-	ReadMap(node *api.Node) (map[string]string, error)
 	GetKeys() []string
 }
 
@@ -40,21 +40,6 @@ func (r Reader) Read(node *api.Node) ([]string, error) {
 	return s, nil
 }
 
-func (r Reader) ReadMap(node *api.Node) (map[string]string, error) {
-	s := make(map[string]string, 0)
-
-	for _, prop := range r.keys {
-		val, err := r.getPropValue(prop, node)
-		if err != nil {
-			return nil, err
-		}
-
-		s[prop] = val
-	}
-
-	return s, nil
-}
-
 func (r *Reader) getPropValue(prop string, node *api.Node) (string, error) {
 	chunks := strings.Split(prop, ".")
 
@@ -101,10 +86,27 @@ func (r *Reader) getPropValue(prop string, node *api.Node) (string, error) {
 	case "status":
 		return node.Status, nil
 
+	case "status_updated", "statusupdated", "statusupdatedat":
+		if node.StatusUpdatedAt == 0 {
+			return "", nil
+		}
+		return time.Unix(node.StatusUpdatedAt, 0).UTC().Format(time.RFC3339), nil
+
+	// Nomad only updates the status time on changes, so for nodes that are not ready it's
+	// about when they were last heard from
+	case "last_seen", "lastseen":
+		if node.Status == "ready" {
+			return "now", nil
+		}
+		if node.StatusUpdatedAt == 0 {
+			return "", nil
+		}
+		return time.Since(time.Unix(node.StatusUpdatedAt, 0)).Round(time.Minute).String(), nil
+
 	case "schedulingeligibility", "eligibility":
 		return node.SchedulingEligibility, nil
 
 	default:
-		return "", fmt.Errorf("Don't know how to find value for '%s'", prop)
+		return "", InvalidInputf("Don't know how to find value for '%s'", prop)
 	}
 }
@@ -0,0 +1,131 @@
+package helpers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// RowsResponse renders rows of field values in the requested output format, the JSON
+// formats return a list of objects keyed by field name
+func RowsResponse(format string, keys []string, rows [][]string) (string, error) {
+	switch format {
+	case "table":
+		var b bytes.Buffer
+		writer := bufio.NewWriter(&b)
+
+		table := tablewriter.NewWriter(writer)
+		table.SetAutoMergeCells(false)
+		table.SetRowLine(true)
+		table.SetHeader(keys)
+		table.AppendBulk(rows)
+		table.Render()
+
+		writer.Flush()
+		return b.String(), nil
+
+	case "json", "json-pretty":
+		res := make([]map[string]string, 0, len(rows))
+		for _, row := range rows {
+			m := make(map[string]string, len(keys))
+			for i, key := range keys {
+				m[key] = row[i]
+			}
+			res = append(res, m)
+		}
+
+		return MarshalJSON(format, res)
+
+	default:
+		return "", InvalidInputf("Invalid output-format: %s", format)
+	}
+}
+
+// BreakdownRow is the number of rows with the same field values, like "node breakdown" returns
+type BreakdownRow struct {
+	Key   string   `json:"key"`
+	Path  []string `json:"path"`
+	Value int      `json:"value"`
+}
+
+// Breakdown counts the rows with the same field values, sorted by key
+func Breakdown(rows [][]string) []*BreakdownRow {
+	counts := make(map[string]*BreakdownRow)
+	for _, row := range rows {
+		key := strings.Join(row, ".")
+		if r, ok := counts[key]; ok {
+			r.Value++
+			continue
+		}
+
+		counts[key] = &BreakdownRow{Key: key, Path: row, Value: 1}
+	}
+
+	result := make([]*BreakdownRow, 0, len(counts))
+	for _, r := range counts {
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+
+	return result
+}
+
+// BreakdownResponse renders the breakdown of rows in the requested output format
+func BreakdownResponse(format string, keys []string, rows [][]string) (string, error) {
+	result := Breakdown(rows)
+
+	switch format {
+	case "table":
+		var b bytes.Buffer
+		writer := bufio.NewWriter(&b)
+
+		table := tablewriter.NewWriter(writer)
+		table.SetAutoMergeCells(true)
+		table.SetRowLine(true)
+		table.SetHeader(append(append([]string{}, keys...), "count"))
+
+		for i, r := range result {
+			// hack: make sure the count is never merged with the row above
+			char := "\001"
+			if i%2 == 0 {
+				char = "\002"
+			}
+
+			row := append(append([]string{}, r.Path...), fmt.Sprintf("%d%s", r.Value, char))
+			table.Append(row)
+		}
+
+		table.Render()
+		writer.Flush()
+		return b.String(), nil
+
+	case "json", "json-pretty":
+		return MarshalJSON(format, result)
+
+	default:
+		return "", InvalidInputf("Invalid output-format: %s", format)
+	}
+}
+
+// MarshalJSON encodes v for the json or json-pretty output format
+func MarshalJSON(format string, v interface{}) (string, error) {
+	var jsonText []byte
+	var err error
+	if format == "json" {
+		jsonText, err = json.Marshal(v)
+	} else {
+		jsonText, err = json.MarshalIndent(v, "", "  ")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonText), nil
+}
@@ -0,0 +1,25 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBreakdown(t *testing.T) {
+	rows := [][]string{
+		{"web", "failed"},
+		{"api", "running"},
+		{"web", "failed"},
+		{"web", "running"},
+	}
+
+	want := []*BreakdownRow{
+		{Key: "api.running", Path: []string{"api", "running"}, Value: 1},
+		{Key: "web.failed", Path: []string{"web", "failed"}, Value: 2},
+		{Key: "web.running", Path: []string{"web", "running"}, Value: 1},
+	}
+
+	if got := Breakdown(rows); !reflect.DeepEqual(got, want) {
+		t.Errorf("Breakdown() = %+v, want %+v", got, want)
+	}
+}
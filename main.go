@@ -7,7 +7,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/seatgeek/nomad-helper/command/alloc"
 	"github.com/seatgeek/nomad-helper/command/attach"
+	"github.com/seatgeek/nomad-helper/command/eval"
 	"github.com/seatgeek/nomad-helper/command/gc"
 	"github.com/seatgeek/nomad-helper/command/job"
 	"github.com/seatgeek/nomad-helper/command/namespace"
@@ -16,6 +18,8 @@ import (
 	"github.com/seatgeek/nomad-helper/command/scale"
 	"github.com/seatgeek/nomad-helper/command/server"
 	"github.com/seatgeek/nomad-helper/command/tail"
+	"github.com/seatgeek/nomad-helper/command/upgrade"
+	"github.com/seatgeek/nomad-helper/nomad"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 	"gopkg.in/workanator/go-ataman.v1"
@@ -37,6 +41,8 @@ var fieldHelpText = `
 		* <bold>meta.<reset,underline>key<reset> will look up <underline>key<reset> in the "Meta" Nomad client configuration
 		* <bold>name<reset> for the Nomad client "Name" property
 		* <bold>status<reset> for the Nomad client "Status" property
+		* <bold>status_updated<reset> for when the Nomad client "Status" last changed
+		* <bold>last_seen<reset> for how long ago a node that is not ready was last heard from
 `
 
 var filterHelpText = `
@@ -47,7 +53,9 @@ var filterHelpText = `
 		--filter-eligibility eligible/ineligible                   Filter nodes by their eligibility status eligible/ineligible
 		--filter-meta 'aws.instance.availability-zone=us-east-1e'  Filter nodes by their meta key/value like 'aws.instance.availability-zone=us-east-1e'. Flag can be repeated.
 		--filter-prefix ef30d57c                                   Filter nodes by their ID with prefix matching ef30d57c
+		--filter-status down                                       Filter nodes by their status down, only ready nodes are used by default. Flag can be repeated.
 		--filter-version 0.8.4                                     Filter nodes by their Nomad version 0.8.4
+		--all-statuses                                             Use nodes in any status, not only ready nodes
 `
 
 var filterWebHelpText = `
@@ -60,7 +68,9 @@ var filterWebHelpText = `
 		/?filter-eligibility=eligible/ineligible                   Filter nodes by their eligibility status eligible/ineligible
 		/?filter-meta=aws.instance.availability-zone=us-east-1e    Filter nodes by their meta key/value like 'aws.instance.availability-zone=us-east-1e'.
 		/?filter-prefix=ef30d57c                                   Filter nodes by their ID with prefix matching ef30d57c
+		/?filter-status=down,initializing                          Filter nodes by their status, only ready nodes are used by default
 		/?filter-version=0.8.4                                     Filter nodes by their Nomad version 0.8.4
+		/?all-statuses=true                                        Use nodes in any status, not only ready nodes
 `
 
 var helpExamples = `
@@ -84,8 +94,100 @@ var helpWebExamples = `
 		* /node/[breakdown|list]/<bold>class<reset>/<bold>status<reset>
 		* /node/[breakdown|list]/<bold>meta.<reset,underline>aws.instance.region<reset>/<bold>attribute.<reset,underline>nomad.version<reset>
 		* /node/[breakdown|list]/<bold>attribute<reset,underline>.nomad.version<reset>/<bold>attribute.<reset,underline>driver.docker<reset>
+		* /node/breakdown/history/<bold>class<reset>/<bold>attribute.<reset,underline>nomad.version<reset>?since=24h (requires --history-file and a matching --history-dimension)
+		* /job/list/<bold>id<reset>/<bold>type<reset>/<bold>running<reset>?filter-type=service
+		* /job/hunt/<bold>job<reset>/<bold>id<reset>/<bold>version<reset>
+		* /job/<underline>web<reset>/allocations/<bold>id<reset>/<bold>node<reset>/<bold>status<reset>?all=true
+		* /alloc/<underline>6f3c8a40<reset>/logs?task=<underline>web<reset>&type=stderr&lines=100
 `
 
+var allocFieldHelpText = `
+	<bold,underline>** Arguments **<reset>
+
+		* <bold>id<reset> / <bold>name<reset> / <bold>namespace<reset> / <bold>eval<reset> for the allocation properties
+		* <bold>job<reset> / <bold>jobtype<reset> / <bold>version<reset> for the job and job version of the allocation
+		* <bold>group<reset> / <bold>task<reset> for the task group and the (comma separated) tasks
+		* <bold>status<reset> / <bold>description<reset> for the client status, <bold>desired<reset> / <bold>desireddescription<reset> for the desired status
+		* <bold>node<reset> / <bold>nodeid<reset> for the name and ID of the node the allocation runs on
+		* <bold>node.<reset,underline>field<reset> for any field of the node, like <bold>node.class<reset> or <bold>node.meta.<reset,underline>aws.instance.availability-zone<reset>
+		* <bold>healthy<reset> / <bold>canary<reset> for the deployment status
+		* <bold>restarts<reset> for the task restarts, summed over all tasks
+		* <bold>age<reset> for how long ago the allocation was created, like 3d, 5h or 12m
+		* <bold>created<reset> / <bold>modified<reset> for the create and modify times
+`
+
+var allocHelpExamples = `
+	<bold,underline>** Examples **<reset>
+
+		* nomad-helper alloc --filter-job web __COMMAND__ <bold>node.meta.<reset,underline>aws.instance.availability-zone<reset>
+		* nomad-helper alloc --filter-status failed __COMMAND__ <bold>job<reset> <bold>node.class<reset>
+		* nomad-helper alloc --filter-status running __COMMAND__ <bold>job<reset> <bold>version<reset> <bold>restarts<reset>
+`
+
+var jobFieldHelpText = `
+	<bold,underline>** Arguments **<reset>
+
+		* <bold>id<reset> / <bold>name<reset> / <bold>namespace<reset> / <bold>parent<reset> for the job properties
+		* <bold>type<reset> / <bold>priority<reset> / <bold>status<reset> / <bold>datacenters<reset> / <bold>submitted<reset>
+		* <bold>stop<reset> / <bold>periodic<reset> / <bold>parameterized<reset> for the job flags
+		* <bold>queued<reset> / <bold>starting<reset> / <bold>running<reset> / <bold>complete<reset> / <bold>failed<reset> / <bold>lost<reset> for the allocation counts
+		* <bold>meta.<reset,underline>key<reset> will look up <underline>key<reset> in the job "Meta"
+		* <bold>version<reset> / <bold>stable<reset> / <bold>region<reset> for the current job version
+		* <bold>groups<reset> for the number of task groups, <bold>count<reset> for the summed group counts
+		* <bold>constraints<reset> for the distinct job, group and task constraints
+`
+
+var jobHelpExamples = `
+	<bold,underline>** Examples **<reset>
+
+		* nomad-helper job __COMMAND__ <bold>type<reset> <bold>meta.<reset,underline>owner<reset>
+		* nomad-helper job __COMMAND__ --filter-type service <bold>constraints<reset>
+		* nomad-helper job __COMMAND__ --filter-meta <underline>owner=payments<reset> <bold>id<reset> <bold>version<reset> <bold>stable<reset>
+`
+
+var jobFilterFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "filter-prefix",
+		Usage: "Filter jobs by their ID with prefix matching `api-`",
+	},
+	cli.StringFlag{
+		Name:  "filter-namespace",
+		Usage: "Only use jobs in the namespace `default`, or * for all namespaces",
+	},
+	cli.StringFlag{
+		Name:  "filter-type",
+		Usage: "Filter jobs by their type `service/batch/system/sysbatch`",
+	},
+	cli.StringFlag{
+		Name:  "filter-status",
+		Usage: "Filter jobs by their status `pending/running/dead`",
+	},
+	cli.StringFlag{
+		Name:  "filter-datacenter",
+		Usage: "Filter jobs running in the datacenter `us-east-1`",
+	},
+	cli.StringSliceFlag{
+		Name:  "filter-meta",
+		Usage: "Filter jobs by their meta key/value like `'owner=payments'`. Can be provided multiple times.",
+	},
+	cli.StringFlag{
+		Name:  "output-format",
+		Value: "table",
+		Usage: "Either `table, json or json-pretty`",
+	},
+}
+
+var gcFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "dry",
+		Usage: "Dry run, just print what would be removed",
+	},
+	cli.BoolFlag{
+		Name:  "reconcile",
+		Usage: "Reconcile the job summaries after removing",
+	},
+}
+
 var filterFlags = []cli.Flag{
 	cli.StringFlag{
 		Name:  "filter-prefix",
@@ -103,11 +205,27 @@ var filterFlags = []cli.Flag{
 		Name:  "filter-eligibility",
 		Usage: "Filter nodes by their eligibility status `eligible/ineligible`",
 	},
+	cli.StringSliceFlag{
+		Name:  "filter-status",
+		Usage: "Filter nodes by their status `initializing/ready/down/disconnected`, only ready nodes are used by default. Can be provided multiple times.",
+	},
+	cli.BoolFlag{
+		Name:  "all-statuses",
+		Usage: "Use nodes in any status, not only ready nodes",
+	},
 	cli.IntFlag{
 		Name:  "percent",
-		Usage: "Filter only specific percent of nodes percent of nodes",
+		Usage: "Only use this percent of the matched nodes, the same nodes are picked on every run",
 		Value: 100,
 	},
+	cli.IntFlag{
+		Name:  "count",
+		Usage: "Only use this many of the matched nodes, the same nodes are picked on every run",
+	},
+	cli.StringFlag{
+		Name:  "spread-by",
+		Usage: "Spread the nodes picked by --percent or --count evenly over the values of a node field, like `meta.aws.instance.availability-zone`",
+	},
 	cli.StringSliceFlag{
 		Name:  "filter-meta",
 		Usage: "Filter nodes by their meta key/value like `'aws.instance.availability-zone=us-east-1e'`. Can be provided multiple times.",
@@ -126,6 +244,28 @@ var filterFlags = []cli.Flag{
 	},
 }
 
+var clusterFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "cluster",
+		Usage: "Run against the named clusters from the config file instead of NOMAD_ADDR, like `staging,production`",
+	},
+	cli.BoolFlag{
+		Name:  "all-clusters",
+		Usage: "Run against all clusters from the config file instead of NOMAD_ADDR",
+	},
+}
+
+var regionFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "region",
+		Usage: "Run against the named regions instead of the region of the Nomad agent, like `eu-west,us-east`",
+	},
+	cli.BoolFlag{
+		Name:  "all-regions",
+		Usage: "Run against all regions of the federated Nomad clusters",
+	},
+}
+
 // Version is filled in by the compiler (git tag + changes)
 var Version = "local-dev"
 
@@ -142,6 +282,21 @@ func main() {
 			Usage:  "Debug level (debug, info, warn/warning, error, fatal, panic)",
 			EnvVar: "LOG_LEVEL",
 		},
+		cli.StringFlag{
+			Name:   "config",
+			Value:  nomad.DefaultConfigFile,
+			Usage:  "Config file with the profiles for --profile and named clusters for --cluster and --all-clusters",
+			EnvVar: "NOMAD_HELPER_CONFIG",
+		},
+		cli.StringFlag{
+			Name:  "token",
+			Usage: "Nomad ACL token to use, instead of NOMAD_TOKEN or the token from the profile",
+		},
+		cli.StringFlag{
+			Name:   "profile",
+			Usage:  "Profile from the config file to use for the Nomad connection and default flags, instead of the NOMAD_* environment",
+			EnvVar: "NOMAD_HELPER_PROFILE",
+		},
 	}
 	app.Commands = []cli.Command{
 		{
@@ -223,10 +378,124 @@ func main() {
 				return err
 			},
 		},
+		{
+			Name:  "alloc",
+			Usage: "allocation commands that act on all allocations that match the filters provided",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "filter-job",
+					Usage: "Filter allocations by their job ID `web`",
+				},
+				cli.StringFlag{
+					Name:  "filter-group",
+					Usage: "Filter allocations by their task group `app`",
+				},
+				cli.StringSliceFlag{
+					Name:  "filter-status",
+					Usage: "Filter allocations by their client status `pending/running/complete/failed/lost`. Can be provided multiple times.",
+				},
+				cli.StringFlag{
+					Name:  "filter-desired",
+					Usage: "Filter allocations by their desired status `run/stop/evict`",
+				},
+				cli.StringFlag{
+					Name:  "filter-prefix",
+					Usage: "Filter allocations by their ID with prefix matching `6f3c8a40`",
+				},
+			},
+			Subcommands: []cli.Command{
+				{
+					Name:        "list",
+					Usage:       "Output list of key properties for the allocations",
+					UsageText:   "nomad-helper alloc [filters...] list [command options] [keys...]",
+					Description: rndr.MustRender(allocFieldHelpText) + rndr.MustRender(strings.ReplaceAll(allocHelpExamples, "__COMMAND__", "list")),
+					ArgsUsage:   "[keys...]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "output-format",
+							Value: "table",
+							Usage: "Either `table, json or json-pretty`",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						err := alloc.ListCLI(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
+				{
+					Name:        "breakdown",
+					Usage:       "Break down (count) how many allocations match a list of key properties",
+					UsageText:   "nomad-helper alloc [filters...] breakdown [command options] [keys...]",
+					Description: rndr.MustRender(allocFieldHelpText) + rndr.MustRender(strings.ReplaceAll(allocHelpExamples, "__COMMAND__", "breakdown")),
+					ArgsUsage:   "[keys...]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "output-format",
+							Value: "table",
+							Usage: "Either `table, json or json-pretty`",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						err := alloc.BreakdownCLI(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
+				{
+					Name:      "doctor",
+					Usage:     "Find pending and running allocations in problem states, and optionally stop or reschedule them",
+					UsageText: "nomad-helper alloc [filters...] doctor [command options]",
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{
+							Name:  "check",
+							Usage: "Only run these checks `stopped-but-running/job-stopped/node-down/node-missing/stuck-pending/restarting`. Can be provided multiple times, defaults to all checks",
+						},
+						cli.DurationFlag{
+							Name:  "stuck-after",
+							Usage: "How long an allocation can be pending, or running after being stopped, before it is flagged",
+							Value: 10 * time.Minute,
+						},
+						cli.IntFlag{
+							Name:  "max-restarts",
+							Usage: "Flag allocations whose tasks restarted this many times in total, 0 disables the check",
+							Value: 5,
+						},
+						cli.StringFlag{
+							Name:  "fix",
+							Usage: "Remediate the problem allocations, either `stop` them or `reschedule` their jobs. Rescheduling only replaces failed allocations, running and pending ones are left until they fail or are stopped",
+						},
+						cli.BoolFlag{
+							Name:  "dry",
+							Usage: "Dry run, just print the remediation actions",
+						},
+						cli.StringFlag{
+							Name:  "output-format",
+							Value: "table",
+							Usage: "Either `table, json or json-pretty`",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						err := alloc.Doctor(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
+			},
+		},
 		{
 			Name:  "job",
 			Usage: "job specific commands with a twist (see help)",
-			Flags: filterFlags,
+			Flags: append(append(clusterFlags, regionFlags...), filterFlags...),
 			Subcommands: []cli.Command{
 				{
 					Name:  "stop",
@@ -254,11 +523,67 @@ func main() {
 						return err
 					},
 				},
+				{
+					Name:        "list",
+					Usage:       "Output list of key properties for the jobs",
+					UsageText:   "nomad-helper job list [command options] [keys...]",
+					Description: rndr.MustRender(jobFieldHelpText) + rndr.MustRender(strings.ReplaceAll(jobHelpExamples, "__COMMAND__", "list")),
+					ArgsUsage:   "[keys...]",
+					Flags:       jobFilterFlags,
+					Action: func(c *cli.Context) error {
+						err := job.ListCLI(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
+				{
+					Name:        "breakdown",
+					Usage:       "Break down (count) how many jobs match a list of key properties",
+					UsageText:   "nomad-helper job breakdown [command options] [keys...]",
+					Description: rndr.MustRender(jobFieldHelpText) + rndr.MustRender(strings.ReplaceAll(jobHelpExamples, "__COMMAND__", "breakdown")),
+					ArgsUsage:   "[keys...]",
+					Flags:       jobFilterFlags,
+					Action: func(c *cli.Context) error {
+						err := job.BreakdownCLI(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
+				{
+					Name:      "spread",
+					Usage:     "Show how the running allocations of every service task group are spread over the nodes, and flag the groups in a single zone or on a single host",
+					UsageText: "nomad-helper job spread [command options]",
+					Flags: append([]cli.Flag{
+						cli.StringFlag{
+							Name:  "by",
+							Value: "datacenter",
+							Usage: "Node field to check the spread over, like `meta.aws.instance.availability-zone`, class or datacenter",
+						},
+						cli.BoolFlag{
+							Name:  "only-problems",
+							Usage: "Only show the task groups in a single zone or on a single host",
+						},
+					}, jobFilterFlags...),
+					Action: func(c *cli.Context) error {
+						err := job.Spread(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
 				{
 					Name:  "hunt",
 					Usage: "Hunt the Jobs with discrepancy in Job version between allocations",
 					Action: func(c *cli.Context) error {
-						err := job.Hunt()
+						err := job.Hunt(c)
 						if err != nil {
 							log.Fatal(err)
 						}
@@ -323,6 +648,33 @@ func main() {
 							Name:  "ignore-job",
 							Usage: "Ignore a job ID when marking a namespace as empty. Can be provided multiple times.",
 						},
+						cli.DurationFlag{
+							Name:  "min-age",
+							Usage: "Only delete namespaces without any job submitted or variable changed for this long, namespaces without jobs or variables are kept when set",
+						},
+						cli.StringSliceFlag{
+							Name:  "protect",
+							Usage: "Never delete namespaces matching the regular expression `'^team-'`, the default namespace is always protected. Can be provided multiple times.",
+						},
+						cli.StringFlag{
+							Name:  "protect-meta-key",
+							Usage: "Never delete namespaces with this meta key set to true",
+							Value: "protected",
+						},
+						cli.IntFlag{
+							Name:  "confirm-over",
+							Usage: "Ask for confirmation before deleting more than this many namespaces",
+							Value: 5,
+						},
+						cli.BoolFlag{
+							Name:  "yes",
+							Usage: "Don't ask for confirmation",
+						},
+						cli.StringFlag{
+							Name:  "output-format",
+							Value: "table",
+							Usage: "Either `table, json or json-pretty`",
+						},
 					},
 					Action: func(c *cli.Context) error {
 						err := namespace.GC(c, log.StandardLogger())
@@ -338,7 +690,7 @@ func main() {
 		{
 			Name:  "node",
 			Usage: "node specific commands that act on all Nomad clients that match the filters provided, rather than a single node",
-			Flags: filterFlags,
+			Flags: append(append(clusterFlags, regionFlags...), filterFlags...),
 			Subcommands: []cli.Command{
 				{
 					Name:  "drain",
@@ -387,7 +739,7 @@ func main() {
 						},
 						cli.BoolFlag{
 							Name:  "with-benefits",
-							Usage: "Instead of draining the node in a regular way move the jobs to specific constraints",
+							Usage: "Instead of draining the node in a regular way move the jobs to specific constraints. Without a constraint allocations are stopped per task group respecting the migrate max_parallel, waiting for replacements to become healthy",
 						},
 						cli.StringFlag{
 							Name:  "constraint",
@@ -403,7 +755,7 @@ func main() {
 						},
 						cli.BoolFlag{
 							Name:  "wait-for-pending",
-							Usage: "Will wait for pending allocation and blocked evaluations per job",
+							Usage: "Will wait for pending allocation and blocked evaluations per job when moving jobs to a constraint",
 						},
 					},
 					Action: func(c *cli.Context) error {
@@ -438,6 +790,40 @@ func main() {
 						return err
 					},
 				},
+				{
+					Name:  "meta",
+					Usage: "Change the dynamic meta of the nodes, which can be targeted later with --filter-meta (requires Nomad 1.5+ clients)",
+					Subcommands: []cli.Command{
+						{
+							Name:      "set",
+							Usage:     "Set meta keys on the nodes",
+							UsageText: "nomad-helper node [filters...] meta set key=value [key=value...]",
+							ArgsUsage: "key=value [key=value...]",
+							Action: func(c *cli.Context) error {
+								err := node.MetaSet(c, log.StandardLogger())
+								if err != nil {
+									log.Fatal(err)
+								}
+
+								return err
+							},
+						},
+						{
+							Name:      "unset",
+							Usage:     "Remove meta keys from the nodes",
+							UsageText: "nomad-helper node [filters...] meta unset key [key...]",
+							ArgsUsage: "key [key...]",
+							Action: func(c *cli.Context) error {
+								err := node.MetaUnset(c, log.StandardLogger())
+								if err != nil {
+									log.Fatal(err)
+								}
+
+								return err
+							},
+						},
+					},
+				},
 				{
 					Name:        "list",
 					Usage:       `Output list of key properties for a Nomad client`,
@@ -502,6 +888,29 @@ func main() {
 						return err
 					},
 				},
+				{
+					Name:      "diff",
+					Usage:     `Compare the Meta, Attribute and node fields of two Nomad clusters, or a Nomad cluster and a saved "node discover --output-format json" snapshot`,
+					UsageText: "nomad-helper node [filters...] diff [command options] [left] <right>",
+					Description: "Both sides are either a Nomad address (http:// or https://) or a snapshot file. " +
+						"If only one side is provided, it's compared against the cluster configured with the NOMAD_* environment variables.",
+					ArgsUsage: "[left] <right>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "output-format",
+							Value: "table",
+							Usage: `Either "table", "json" or "json-pretty"`,
+						},
+					},
+					Action: func(c *cli.Context) error {
+						err := node.DiffCLI(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
 				{
 					Name:      "empty",
 					Usage:     `List nodes that only have system jobs running`,
@@ -514,7 +923,49 @@ func main() {
 						},
 					},
 					Action: func(c *cli.Context) error {
-						err := node.Empty(c, log.StandardLogger())
+						err := node.EmptyCLI(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
+				{
+					Name:      "reap",
+					Usage:     `Act on drained or ineligible nodes that only have system jobs running`,
+					UsageText: "nomad-helper node [filters...] reap [command options]",
+					Flags: []cli.Flag{
+						cli.DurationFlag{
+							Name:  "min-idle",
+							Value: time.Hour,
+							Usage: "How long a node must have been drained/ineligible and empty before it is reaped",
+						},
+						cli.IntFlag{
+							Name:  "max-nodes",
+							Value: 5,
+							Usage: "Maximum number of nodes to reap in a single run",
+						},
+						cli.StringFlag{
+							Name:  "action",
+							Value: "none",
+							Usage: "Action to take for each node, either `none, shell, webhook or purge`",
+						},
+						cli.StringFlag{
+							Name:  "shell-command",
+							Usage: "Command to run (through 'sh -c') for each node when using '--action shell'. NOMAD_NODE_ID, NOMAD_NODE_NAME, NOMAD_NODE_CLASS, NOMAD_NODE_DATACENTER and NOMAD_NODE_IP are set in the environment",
+						},
+						cli.StringFlag{
+							Name:  "webhook-url",
+							Usage: "URL to POST the node details (JSON) to when using '--action webhook'",
+						},
+						cli.BoolFlag{
+							Name:  "dry",
+							Usage: "Dry run, just print actions",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						err := node.Reap(c, log.StandardLogger())
 						if err != nil {
 							log.Fatal(err)
 						}
@@ -527,6 +978,7 @@ func main() {
 		{
 			Name:  "scale",
 			Usage: "Import / Export job -> group -> count values",
+			Flags: regionFlags,
 			Subcommands: []cli.Command{
 				{
 					Name:  "export",
@@ -537,7 +989,7 @@ func main() {
 							return fmt.Errorf("missing file name")
 						}
 
-						err := scale.ExportCommand(configFile)
+						err := scale.ExportCommand(c.Parent(), configFile)
 						if err != nil {
 							log.Fatal(err)
 						}
@@ -554,7 +1006,77 @@ func main() {
 							return fmt.Errorf("missing file name")
 						}
 
-						err := scale.ImportCommand(configFile)
+						err := scale.ImportCommand(c.Parent(), configFile)
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
+			},
+		},
+		{
+			Name:  "upgrade",
+			Usage: "Track and drive the rollout of a Nomad (or driver) version across the Nomad clients that match the filters provided",
+			Flags: filterFlags,
+			Subcommands: []cli.Command{
+				{
+					Name:      "status",
+					Usage:     "Report how many Nomad clients match the target, per class and datacenter",
+					UsageText: "nomad-helper upgrade [filters...] status [command options] <key=value>",
+					ArgsUsage: "<key=value>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "campaign-file",
+							Usage: "Include the drain progress recorded in this campaign file",
+						},
+						cli.StringFlag{
+							Name:  "output-format",
+							Value: "table",
+							Usage: `Either "table", "json" or "json-pretty"`,
+						},
+					},
+					Action: func(c *cli.Context) error {
+						err := upgrade.Status(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
+				{
+					Name:      "drain",
+					Usage:     "Drain the Nomad clients that do not match the target in batches, recording the progress in a campaign file",
+					UsageText: "nomad-helper upgrade [filters...] drain [command options] <key=value>",
+					ArgsUsage: "<key=value>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "campaign-file",
+							Usage: "File to record the upgrade progress in, running the command again resumes the campaign",
+						},
+						cli.IntFlag{
+							Name:  "batch-size",
+							Value: 1,
+							Usage: "Number of nodes to drain at the same time",
+						},
+						cli.IntFlag{
+							Name:  "max-batches",
+							Usage: "Stop after this many batches, 0 drains all nodes",
+						},
+						cli.DurationFlag{
+							Name:  "deadline",
+							Value: time.Hour,
+							Usage: "Set the deadline by which all allocations must be moved off the node",
+						},
+						cli.BoolFlag{
+							Name:  "dry",
+							Usage: "Dry run, just print actions",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						err := upgrade.Drain(c, log.StandardLogger())
 						if err != nil {
 							log.Fatal(err)
 						}
@@ -590,19 +1112,163 @@ func main() {
 				return err
 			},
 		},
+		{
+			Name:  "eval",
+			Usage: "evaluation commands",
+			Subcommands: []cli.Command{
+				{
+					Name:      "explain",
+					Usage:     "Explain why the blocked or failed evaluations of a job could not place its task groups, and which nodes came closest to fitting",
+					UsageText: "nomad-helper eval explain [command options] <job>",
+					ArgsUsage: "<job>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "namespace",
+							Usage: "Namespace of the job `default`, defaults to the namespace of the Nomad client",
+						},
+						cli.IntFlag{
+							Name:  "nodes",
+							Usage: "Number of closest nodes to show per task group, 0 shows all nodes",
+							Value: 5,
+						},
+						cli.StringFlag{
+							Name:  "output-format",
+							Value: "table",
+							Usage: "Either `table, json or json-pretty`",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						err := eval.Explain(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
+			},
+		},
 		{
 			Name:  "reevaluate-all",
-			Usage: "Force re-evaluate all jobs",
+			Usage: "Force re-evaluate all jobs matching the filters, and report the evaluations that completed, got blocked or failed",
+			Flags: append([]cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry",
+					Usage: "Dry run, just print the jobs that would be evaluated",
+				},
+				cli.Float64Flag{
+					Name:  "rate",
+					Usage: "Maximum number of evaluations to create per second, 0 for no limit",
+					Value: 5,
+				},
+				cli.BoolFlag{
+					Name:  "no-wait",
+					Usage: "Don't wait for the evaluations to complete",
+				},
+				cli.DurationFlag{
+					Name:  "timeout",
+					Usage: "How long to wait for the evaluations to complete, after the last one was created",
+					Value: 5 * time.Minute,
+				},
+			}, append(regionFlags, jobFilterFlags...)...),
 			Action: func(c *cli.Context) error {
-				return reevaluate.App()
+				err := reevaluate.App(c, log.StandardLogger())
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				return err
 			},
 		},
 		{
 			Name:  "gc",
-			Usage: "Force a cluster GC",
+			Usage: "Force a cluster GC, or remove specific jobs, allocations, evaluations or nodes with the subcommands",
 			Action: func(c *cli.Context) error {
 				return gc.App()
 			},
+			Subcommands: []cli.Command{
+				{
+					Name:  "jobs",
+					Usage: "Purge the stopped and dead jobs matching the filters",
+					Flags: append(append([]cli.Flag{
+						cli.DurationFlag{
+							Name:  "older-than",
+							Usage: "Only purge jobs stopped or dead for longer than this",
+							Value: 24 * time.Hour,
+						},
+					}, gcFlags...), jobFilterFlags...),
+					Action: func(c *cli.Context) error {
+						err := gc.Jobs(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
+				{
+					Name:  "allocs",
+					Usage: "Garbage collect the terminal allocations of the jobs matching the filters from their clients",
+					Flags: append(append([]cli.Flag{
+						cli.DurationFlag{
+							Name:  "older-than",
+							Usage: "Only remove allocations terminal for longer than this",
+							Value: time.Hour,
+						},
+					}, gcFlags...), jobFilterFlags...),
+					Action: func(c *cli.Context) error {
+						err := gc.Allocs(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
+				{
+					Name:  "evals",
+					Usage: "Delete the terminal evaluations of the jobs matching the filters (requires a paused eval broker)",
+					Flags: append(append([]cli.Flag{
+						cli.DurationFlag{
+							Name:  "older-than",
+							Usage: "Only delete evaluations terminal for longer than this",
+							Value: time.Hour,
+						},
+					}, gcFlags...), jobFilterFlags...),
+					Action: func(c *cli.Context) error {
+						err := gc.Evals(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
+				{
+					Name:  "nodes",
+					Usage: "Purge the nodes that are down",
+					Flags: append([]cli.Flag{
+						cli.DurationFlag{
+							Name:  "older-than",
+							Usage: "Only purge nodes down for longer than this",
+							Value: 24 * time.Hour,
+						},
+						cli.StringFlag{
+							Name:  "output-format",
+							Value: "table",
+							Usage: "Either `table, json or json-pretty`",
+						},
+					}, gcFlags...),
+					Action: func(c *cli.Context) error {
+						err := gc.Nodes(c, log.StandardLogger())
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						return err
+					},
+				},
+			},
 		},
 		{
 			Name:        "server",
@@ -614,6 +1280,85 @@ func main() {
 					Value:  "0.0.0.0:8000",
 					EnvVar: "LISTEN",
 				},
+				cli.StringFlag{
+					Name:   "history-file",
+					Usage:  "Record node breakdown snapshots to this file and serve them on /node/breakdown/history",
+					EnvVar: "HISTORY_FILE",
+				},
+				cli.StringSliceFlag{
+					Name:  "history-dimension",
+					Usage: "Comma separated list of fields to record node breakdown history for, like `'class,attribute.nomad.version'`. Can be provided multiple times.",
+				},
+				cli.DurationFlag{
+					Name:  "history-interval",
+					Value: 5 * time.Minute,
+					Usage: "How often to record node breakdown snapshots",
+				},
+				cli.DurationFlag{
+					Name:  "history-retention",
+					Value: 30 * 24 * time.Hour,
+					Usage: "How long to keep node breakdown snapshots, 0 keeps them forever",
+				},
+				cli.BoolFlag{
+					Name:   "auth-nomad-token",
+					Usage:  "Authenticate callers by their Nomad ACL token (X-Nomad-Token header or nomad-token cookie), and query Nomad with it so ACL policies apply per caller",
+					EnvVar: "AUTH_NOMAD_TOKEN",
+				},
+				cli.StringSliceFlag{
+					Name:   "auth-bearer-token",
+					Usage:  "Static token for service-to-service callers (Authorization: Bearer header), these callers use the Nomad token of the server. Can be provided multiple times.",
+					EnvVar: "AUTH_BEARER_TOKEN",
+				},
+				cli.StringFlag{
+					Name:   "tls-cert",
+					Usage:  "Serve HTTPS with this certificate file",
+					EnvVar: "TLS_CERT",
+				},
+				cli.StringFlag{
+					Name:   "tls-key",
+					Usage:  "Private key file for --tls-cert",
+					EnvVar: "TLS_KEY",
+				},
+				cli.StringFlag{
+					Name:   "tls-client-ca",
+					Usage:  "Authenticate service-to-service callers by a client certificate signed by this CA file (mTLS), these callers use the Nomad token of the server",
+					EnvVar: "TLS_CLIENT_CA",
+				},
+				cli.DurationFlag{
+					Name:   "read-timeout",
+					Value:  30 * time.Second,
+					Usage:  "Maximum duration for reading a request, including the body",
+					EnvVar: "READ_TIMEOUT",
+				},
+				cli.DurationFlag{
+					Name:   "write-timeout",
+					Value:  2 * time.Minute,
+					Usage:  "Maximum duration for writing a response, raise it for slow breakdowns on large clusters. Log streams are not limited",
+					EnvVar: "WRITE_TIMEOUT",
+				},
+				cli.DurationFlag{
+					Name:   "idle-timeout",
+					Value:  2 * time.Minute,
+					Usage:  "How long to keep idle keep-alive connections open",
+					EnvVar: "IDLE_TIMEOUT",
+				},
+				cli.DurationFlag{
+					Name:   "shutdown-timeout",
+					Value:  30 * time.Second,
+					Usage:  "How long to wait for requests in flight on SIGTERM or SIGINT",
+					EnvVar: "SHUTDOWN_TIMEOUT",
+				},
+				cli.StringFlag{
+					Name:   "log-format",
+					Value:  "text",
+					Usage:  "Server log format, text or json",
+					EnvVar: "LOG_FORMAT",
+				},
+				cli.BoolFlag{
+					Name:   "no-access-log",
+					Usage:  "Don't log every request",
+					EnvVar: "NO_ACCESS_LOG",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				return server.Run(app, c, log.StandardLogger())
@@ -628,10 +1373,44 @@ func main() {
 		}
 
 		log.SetLevel(level)
+
+		if err := nomad.ConfigureFromCLI(c); err != nil {
+			log.Fatal(err)
+		}
+
 		return nil
 	}
+	app.Commands = withProfileDefaults(app.Commands, "")
 
 	sort.Sort(cli.FlagsByName(app.Flags))
 	sort.Sort(cli.CommandsByName(app.Commands))
 	app.Run(os.Args)
 }
+
+// withProfileDefaults makes every command apply the defaults from the selected profile
+// before it runs, "name" is the full command name like "node list"
+func withProfileDefaults(commands []cli.Command, prefix string) []cli.Command {
+	for i := range commands {
+		name := strings.TrimSpace(prefix + " " + commands[i].Name)
+
+		if len(commands[i].Subcommands) > 0 {
+			commands[i].Subcommands = withProfileDefaults(commands[i].Subcommands, name)
+			continue
+		}
+
+		commands[i].Before = func(c *cli.Context) error {
+			profile := nomad.ActiveProfile()
+			if profile == nil {
+				return nil
+			}
+
+			if err := profile.ApplyDefaults(c, name); err != nil {
+				log.Fatal(err)
+			}
+
+			return nil
+		}
+	}
+
+	return commands
+}
@@ -1,8 +1,193 @@
 package nomad
 
-import "github.com/hashicorp/nomad/api"
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
 
-// NewNomadClient ...
+	"github.com/hashicorp/nomad/api"
+	cli "github.com/urfave/cli"
+)
+
+var (
+	// activeProfile is the profile selected with --profile, if any
+	activeProfile *Profile
+
+	// activeToken is the token provided with --token, if any
+	activeToken string
+
+	// transportWrapper wraps the HTTP transport of all clients, if set (see SetTransportWrapper)
+	transportWrapper func(http.RoundTripper) http.RoundTripper
+)
+
+// SetTransportWrapper wraps the HTTP transport of all clients created afterwards. The
+// server uses this to count the Nomad API calls
+func SetTransportWrapper(wrap func(http.RoundTripper) http.RoundTripper) {
+	transportWrapper = wrap
+}
+
+// methodHeader asks the transport of the clients for another HTTP method than the api
+// package uses, see Post
+const methodHeader = "X-Nomad-Helper-Method"
+
+// methodTransport sends the request with the method from methodHeader, if set
+type methodTransport struct {
+	next http.RoundTripper
+}
+
+func (t methodTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := req.Header.Get(methodHeader)
+	if method == "" {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Method = method
+	req.Header.Del(methodHeader)
+	return t.next.RoundTrip(req)
+}
+
+// newAPIClient is api.NewClient, with the method override and the transport wrapper applied
+func newAPIClient(config *api.Config) (*api.Client, error) {
+	if config.HttpClient != nil {
+		return api.NewClient(config)
+	}
+
+	// The same transport settings as the api package uses by default
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	transport.ForceAttemptHTTP2 = false
+
+	httpClient := &http.Client{Transport: transport}
+	if err := api.ConfigureTLS(httpClient, config.TLSConfig); err != nil {
+		return nil, err
+	}
+	httpClient.Transport = methodTransport{next: httpClient.Transport}
+	if transportWrapper != nil {
+		httpClient.Transport = transportWrapper(httpClient.Transport)
+	}
+
+	config.HttpClient = httpClient
+	return api.NewClient(config)
+}
+
+// Post is like client.Raw().Write, but sends a POST instead of a PUT request, for endpoints
+// the api package has no support for that only document POST. It needs a client created by
+// this package
+func Post(client *api.Client, endpoint string, in, out interface{}, q *api.WriteOptions) (*api.WriteMeta, error) {
+	options := api.WriteOptions{}
+	if q != nil {
+		options = *q
+	}
+
+	headers := map[string]string{methodHeader: http.MethodPost}
+	for key, value := range options.Headers {
+		headers[key] = value
+	}
+	options.Headers = headers
+
+	return client.Raw().Write(endpoint, in, out, &options)
+}
+
+// NewNomadClient creates a client for the selected profile, or from the NOMAD_*
+// environment variables when there is no profile
 func NewNomadClient() (*api.Client, error) {
-	return api.NewClient(api.DefaultConfig())
+	var client *api.Client
+	var err error
+	if activeProfile != nil {
+		client, err = activeProfile.NewClient()
+	} else {
+		client, err = newAPIClient(api.DefaultConfig())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if activeToken != "" {
+		client.SetSecretID(activeToken)
+	}
+
+	return client, nil
+}
+
+// NewNomadClientFromCLI is like NewNomadClient, but uses the global --token flag of the
+// context if provided. The server uses this to run commands with the token of the caller.
+// A single --region of the command or its parents is used too, InRegions runs commands in
+// several regions
+func NewNomadClientFromCLI(c *cli.Context) (*api.Client, error) {
+	client, err := NewNomadClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if token := c.GlobalString("token"); token != "" {
+		client.SetSecretID(token)
+	}
+
+	if regions := regionNames(c); len(regions) == 1 {
+		client.SetRegion(regions[0])
+	}
+
+	return client, nil
+}
+
+// ActiveProfile returns the profile selected with --profile, or nil
+func ActiveProfile() *Profile {
+	return activeProfile
+}
+
+// ConfigureFromCLI selects the profile and token from the global --profile and --token flags for all clients
+func ConfigureFromCLI(c *cli.Context) error {
+	activeToken = c.GlobalString("token")
+
+	name := c.GlobalString("profile")
+	if name == "" {
+		return nil
+	}
+
+	config, err := LoadConfig(c.GlobalString("config"))
+	if err != nil {
+		return err
+	}
+
+	profile, err := config.Profile(name)
+	if err != nil {
+		return fmt.Errorf("%s (config file: %s)", err, c.GlobalString("config"))
+	}
+
+	activeProfile = profile
+	return nil
+}
+
+type contextKey string
+
+const tokenContextKey contextKey = "nomad-token"
+
+// ContextWithToken returns a context carrying the Nomad ACL token of the caller
+func ContextWithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenContextKey, token)
+}
+
+// TokenFromContext returns the Nomad ACL token from the context, if any (see ContextWithToken)
+func TokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(tokenContextKey).(string)
+	return token
+}
+
+// NewNomadClientFromContext is like NewNomadClient, but uses the Nomad ACL token
+// from the context if there is one (see ContextWithToken)
+func NewNomadClientFromContext(ctx context.Context) (*api.Client, error) {
+	client, err := NewNomadClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if token := TokenFromContext(ctx); token != "" {
+		client.SetSecretID(token)
+	}
+
+	return client, nil
 }
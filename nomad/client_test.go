@@ -0,0 +1,257 @@
+package nomad
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	cli "github.com/urfave/cli"
+)
+
+// clientRequest is what the fake Nomad saw of the last request of a client
+type clientRequest struct {
+	Token     string
+	Region    string
+	Namespace string
+}
+
+func newClientServer(t *testing.T, last *clientRequest) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*last = clientRequest{
+			Token:     r.Header.Get("X-Nomad-Token"),
+			Region:    r.URL.Query().Get("region"),
+			Namespace: r.URL.Query().Get("namespace"),
+		}
+		w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("NOMAD_ADDR", server.URL)
+	t.Setenv("NOMAD_REGION", "")
+	t.Setenv("NOMAD_NAMESPACE", "")
+	t.Setenv("NOMAD_TOKEN", "from-environment")
+
+	return server
+}
+
+// setClientGlobals sets the profile, token and transport wrapper for all clients until the test ends
+func setClientGlobals(t *testing.T, profile *Profile, token string, wrap func(http.RoundTripper) http.RoundTripper) {
+	activeProfile, activeToken, transportWrapper = profile, token, wrap
+	t.Cleanup(func() {
+		activeProfile, activeToken, transportWrapper = nil, "", nil
+	})
+}
+
+func newClientContext(t *testing.T, token, region string) *cli.Context {
+	global := flag.NewFlagSet("global", flag.ContinueOnError)
+	global.String("token", "", "")
+	if err := global.Parse([]string{"--token", token}); err != nil {
+		t.Fatal(err)
+	}
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.String("region", "", "")
+	set.Bool("all-regions", false, "")
+	if err := set.Parse([]string{"--region", region}); err != nil {
+		t.Fatal(err)
+	}
+
+	app := cli.NewApp()
+	return cli.NewContext(app, set, cli.NewContext(app, global, nil))
+}
+
+func TestNewNomadClient(t *testing.T) {
+	var last clientRequest
+	server := newClientServer(t, &last)
+
+	tests := []struct {
+		name    string
+		profile *Profile
+		want    clientRequest
+	}{
+		{name: "environment", want: clientRequest{Token: "from-environment"}},
+		{name: "profile", profile: &Profile{Cluster: Cluster{Name: "production", Address: server.URL, Region: "eu-west", Namespace: "batch", Token: "from-profile"}}, want: clientRequest{Token: "from-profile", Region: "eu-west", Namespace: "batch"}},
+		{name: "profile without a token", profile: &Profile{Cluster: Cluster{Name: "staging", Address: server.URL}}, want: clientRequest{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setClientGlobals(t, tt.profile, "", nil)
+
+			client, err := NewNomadClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, err := client.Jobs().List(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if last != tt.want {
+				t.Errorf("got %+v, want %+v", last, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewNomadClientFromCLI(t *testing.T) {
+	var last clientRequest
+	server := newClientServer(t, &last)
+
+	profile := &Profile{Cluster: Cluster{Name: "production", Address: server.URL, Region: "eu-west", Namespace: "batch", Token: "from-profile"}}
+
+	tests := []struct {
+		name        string
+		profile     *Profile
+		activeToken string
+		flagToken   string
+		flagRegion  string
+		want        clientRequest
+	}{
+		{name: "environment", want: clientRequest{Token: "from-environment"}},
+		{name: "profile", profile: profile, want: clientRequest{Token: "from-profile", Region: "eu-west", Namespace: "batch"}},
+		{name: "active token over the profile", profile: profile, activeToken: "from-active", want: clientRequest{Token: "from-active", Region: "eu-west", Namespace: "batch"}},
+		{name: "token flag over the active token", profile: profile, activeToken: "from-active", flagToken: "from-flag", want: clientRequest{Token: "from-flag", Region: "eu-west", Namespace: "batch"}},
+		{name: "token flag over the environment", flagToken: "from-flag", want: clientRequest{Token: "from-flag"}},
+		{name: "region flag over the profile", profile: profile, flagRegion: "us-east", want: clientRequest{Token: "from-profile", Region: "us-east", Namespace: "batch"}},
+		{name: "several regions", profile: profile, flagRegion: "us-east,eu-west", want: clientRequest{Token: "from-profile", Region: "eu-west", Namespace: "batch"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setClientGlobals(t, tt.profile, tt.activeToken, nil)
+
+			client, err := NewNomadClientFromCLI(newClientContext(t, tt.flagToken, tt.flagRegion))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, err := client.Jobs().List(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if last != tt.want {
+				t.Errorf("got %+v, want %+v", last, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewNomadClientFromContext(t *testing.T) {
+	var last clientRequest
+	server := newClientServer(t, &last)
+
+	profile := &Profile{Cluster: Cluster{Name: "production", Address: server.URL, Token: "from-profile"}}
+
+	tests := []struct {
+		name         string
+		profile      *Profile
+		activeToken  string
+		contextToken string
+		want         string
+	}{
+		{name: "environment", want: "from-environment"},
+		{name: "profile", profile: profile, want: "from-profile"},
+		{name: "active token", profile: profile, activeToken: "from-active", want: "from-active"},
+		{name: "context token over the profile", profile: profile, contextToken: "from-context", want: "from-context"},
+		{name: "context token over the active token", profile: profile, activeToken: "from-active", contextToken: "from-context", want: "from-context"},
+		{name: "context token over the environment", contextToken: "from-context", want: "from-context"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setClientGlobals(t, tt.profile, tt.activeToken, nil)
+
+			ctx := context.Background()
+			if tt.contextToken != "" {
+				ctx = ContextWithToken(ctx, tt.contextToken)
+			}
+
+			client, err := NewNomadClientFromContext(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, err := client.Jobs().List(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if last.Token != tt.want {
+				t.Errorf("got token %q, want %q", last.Token, tt.want)
+			}
+		})
+	}
+}
+
+// countingTransport counts the requests and their methods
+type countingTransport struct {
+	next    http.RoundTripper
+	methods map[string]int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.methods[req.Method]++
+	return t.next.RoundTrip(req)
+}
+
+func TestTransportWrapper(t *testing.T) {
+	var method string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("NOMAD_ADDR", server.URL)
+	t.Setenv("NOMAD_TOKEN", "")
+
+	tests := []struct {
+		name   string
+		client func() (*api.Client, error)
+	}{
+		{name: "environment", client: NewNomadClient},
+		{name: "profile", client: func() (*api.Client, error) {
+			activeProfile = &Profile{Cluster: Cluster{Name: "production", Address: server.URL}}
+			return NewNomadClient()
+		}},
+		{name: "context", client: func() (*api.Client, error) {
+			return NewNomadClientFromContext(ContextWithToken(context.Background(), "from-context"))
+		}},
+		{name: "cluster", client: (&Cluster{Name: "staging", Address: server.URL}).NewClient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := &countingTransport{methods: make(map[string]int)}
+			setClientGlobals(t, nil, "", func(next http.RoundTripper) http.RoundTripper {
+				counter.next = next
+				return counter
+			})
+
+			client, err := tt.client()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := client.Raw().Write("/v1/test", struct{}{}, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Post(client, "/v1/test", struct{}{}, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			// the wrapper sees the requests before the method override is applied
+			want := map[string]int{http.MethodPut: 2}
+			if !reflect.DeepEqual(counter.methods, want) {
+				t.Errorf("got requests %v, want %v", counter.methods, want)
+			}
+			if method != http.MethodPost {
+				t.Errorf("got method %s for the last request, want %s", method, http.MethodPost)
+			}
+		})
+	}
+}
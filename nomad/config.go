@@ -0,0 +1,252 @@
+package nomad
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+	cli "github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// defaultAddress is the Nomad address of a cluster without one, the same as the nomad CLI uses
+const defaultAddress = "http://127.0.0.1:4646"
+
+// DefaultConfigFile is where the config file is read from, unless --config is provided
+var DefaultConfigFile = defaultConfigFile()
+
+// Config ...
+type Config struct {
+	Profiles map[string]*Profile `yaml:"profiles"`
+	Clusters map[string]*Cluster `yaml:"clusters"`
+}
+
+// Profile is a named cluster selected with --profile, with default flag values
+// for the commands
+type Profile struct {
+	Cluster `yaml:",inline"`
+
+	// OutputFormat is the default --output-format for all commands that support it
+	OutputFormat string `yaml:"output_format"`
+
+	// Defaults are flag values per command, keyed by the command name like "tail" or "node list"
+	Defaults map[string]map[string]string `yaml:"defaults"`
+}
+
+// Cluster is the connection details of a named Nomad cluster
+type Cluster struct {
+	Name          string `yaml:"-"`
+	Address       string `yaml:"address"`
+	Region        string `yaml:"region"`
+	Namespace     string `yaml:"namespace"`
+	Token         string `yaml:"token"`
+	CACert        string `yaml:"ca_cert"`
+	ClientCert    string `yaml:"client_cert"`
+	ClientKey     string `yaml:"client_key"`
+	TLSServerName string `yaml:"tls_server_name"`
+	TLSSkipVerify bool   `yaml:"tls_skip_verify"`
+
+	// fromEnvironment is set for the implicit cluster of the NOMAD_* environment (see currentCluster)
+	fromEnvironment bool
+}
+
+func defaultConfigFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".config", "nomad-helper", "config.yaml")
+}
+
+// LoadConfig reads the config file, a missing file is the same as an empty config
+func LoadConfig(file string) (*Config, error) {
+	config := &Config{
+		Profiles: make(map[string]*Profile),
+		Clusters: make(map[string]*Cluster),
+	}
+
+	if file == "" {
+		return config, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %s", file, err)
+	}
+
+	if config.Profiles == nil {
+		config.Profiles = make(map[string]*Profile)
+	}
+
+	if config.Clusters == nil {
+		config.Clusters = make(map[string]*Cluster)
+	}
+
+	for name, profile := range config.Profiles {
+		profile.Name = name
+	}
+
+	for name, cluster := range config.Clusters {
+		cluster.Name = name
+	}
+
+	return config, nil
+}
+
+// Profile returns the named profile
+func (c *Config) Profile(name string) (*Profile, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile '%s' (not found in the config file)", name)
+	}
+
+	return profile, nil
+}
+
+// SelectClusters returns the named clusters, or all clusters sorted by name.
+// Profiles can be used as clusters too, a cluster takes precedence over a profile with the same name
+func (c *Config) SelectClusters(names []string, all bool) ([]*Cluster, error) {
+	if all {
+		seen := make(map[string]bool)
+		names = make([]string, 0, len(c.Clusters)+len(c.Profiles))
+		for name := range c.Clusters {
+			seen[name] = true
+			names = append(names, name)
+		}
+		for name := range c.Profiles {
+			if !seen[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+
+	clusters := make([]*Cluster, 0, len(names))
+	for _, name := range names {
+		if cluster, ok := c.Clusters[name]; ok {
+			clusters = append(clusters, cluster)
+			continue
+		}
+
+		if profile, ok := c.Profiles[name]; ok {
+			clusters = append(clusters, &profile.Cluster)
+			continue
+		}
+
+		return nil, fmt.Errorf("unknown cluster '%s' (not found in the config file)", name)
+	}
+
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("no clusters or profiles configured in the config file")
+	}
+
+	return clusters, nil
+}
+
+// ClustersFromCLI returns the clusters selected with --cluster or --all-clusters,
+// or nil when neither is used and the NOMAD_* environment should be used instead
+func ClustersFromCLI(c *cli.Context) ([]*Cluster, error) {
+	names := make([]string, 0)
+	for _, name := range strings.Split(c.String("cluster"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 && !c.Bool("all-clusters") {
+		return nil, nil
+	}
+
+	config, err := LoadConfig(c.GlobalString("config"))
+	if err != nil {
+		return nil, err
+	}
+
+	return config.SelectClusters(names, c.Bool("all-clusters"))
+}
+
+// NewClient creates a Nomad API client for the cluster from its configuration only. The
+// NOMAD_* environment variables are not used, so a token or certificate from the shell is
+// never sent to another cluster. Only the implicit cluster of the environment uses them
+func (c *Cluster) NewClient() (*api.Client, error) {
+	config := &api.Config{Address: defaultAddress, TLSConfig: &api.TLSConfig{}}
+	if c.fromEnvironment {
+		config = api.DefaultConfig()
+	}
+
+	if c.Address != "" {
+		config.Address = c.Address
+	}
+	if c.Region != "" {
+		config.Region = c.Region
+	}
+	if c.Namespace != "" {
+		config.Namespace = c.Namespace
+	}
+	if c.Token != "" {
+		config.SecretID = c.Token
+	}
+	if c.CACert != "" {
+		config.TLSConfig.CACert = c.CACert
+	}
+	if c.ClientCert != "" {
+		config.TLSConfig.ClientCert = c.ClientCert
+	}
+	if c.ClientKey != "" {
+		config.TLSConfig.ClientKey = c.ClientKey
+	}
+	if c.TLSServerName != "" {
+		config.TLSConfig.TLSServerName = c.TLSServerName
+	}
+	if c.TLSSkipVerify {
+		config.TLSConfig.Insecure = true
+	}
+
+	return newAPIClient(config)
+}
+
+// ApplyDefaults sets the profile defaults for all flags of the command that were not
+// provided on the command line or through their environment variable
+func (p *Profile) ApplyDefaults(c *cli.Context, command string) error {
+	flags := make(map[string]bool)
+	for _, flag := range c.Command.Flags {
+		flags[strings.TrimSpace(strings.Split(flag.GetName(), ",")[0])] = true
+	}
+
+	defaults := make(map[string]string)
+	if p.OutputFormat != "" && flags["output-format"] {
+		defaults["output-format"] = p.OutputFormat
+	}
+
+	for name, value := range p.Defaults[command] {
+		if !flags[name] {
+			return fmt.Errorf("profile '%s' has a default for unknown flag --%s of command '%s'", p.Name, name, command)
+		}
+
+		defaults[name] = value
+	}
+
+	for name, value := range defaults {
+		if c.IsSet(name) {
+			continue
+		}
+
+		if err := c.Set(name, value); err != nil {
+			return fmt.Errorf("profile '%s' has an invalid default for --%s: %s", p.Name, name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package nomad
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cli "github.com/urfave/cli"
+)
+
+func TestClusterNewClientToken(t *testing.T) {
+	var token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Nomad-Token")
+		w.Write([]byte(`["global"]`))
+	}))
+	defer server.Close()
+
+	t.Setenv("NOMAD_TOKEN", "from-environment")
+
+	tests := []struct {
+		name    string
+		cluster *Cluster
+		want    string
+	}{
+		{name: "cluster without a token", cluster: &Cluster{Address: server.URL}, want: ""},
+		{name: "cluster with a token", cluster: &Cluster{Address: server.URL, Token: "from-cluster"}, want: "from-cluster"},
+		{name: "environment", cluster: &Cluster{Address: server.URL, fromEnvironment: true}, want: "from-environment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := tt.cluster.NewClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token = ""
+			if _, err := client.Regions().List(); err != nil {
+				t.Fatal(err)
+			}
+
+			if token != tt.want {
+				t.Errorf("got token %q, want %q", token, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileApplyDefaults(t *testing.T) {
+	tests := []struct {
+		name       string
+		profile    *Profile
+		args       []string
+		wantFormat string
+		wantLines  string
+		wantErr    bool
+	}{
+		{name: "no defaults", profile: &Profile{}, wantFormat: "table", wantLines: "10"},
+		{name: "output format", profile: &Profile{OutputFormat: "json"}, wantFormat: "json", wantLines: "10"},
+		{name: "command defaults", profile: &Profile{Defaults: map[string]map[string]string{"tail": {"lines": "50", "output-format": "json-pretty"}}}, wantFormat: "json-pretty", wantLines: "50"},
+		{name: "defaults of other commands", profile: &Profile{Defaults: map[string]map[string]string{"node list": {"lines": "50"}}}, wantFormat: "table", wantLines: "10"},
+		{name: "command line wins", profile: &Profile{OutputFormat: "json", Defaults: map[string]map[string]string{"tail": {"lines": "50"}}}, args: []string{"--lines", "20", "--output-format", "table"}, wantFormat: "table", wantLines: "20"},
+		{name: "unknown flag", profile: &Profile{Defaults: map[string]map[string]string{"tail": {"follow": "true"}}}, wantErr: true},
+		{name: "invalid value", profile: &Profile{Defaults: map[string]map[string]string{"tail": {"lines": "many"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := flag.NewFlagSet("tail", flag.ContinueOnError)
+			set.String("output-format", "table", "")
+			set.Int("lines", 10, "")
+			if err := set.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			c := cli.NewContext(cli.NewApp(), set, nil)
+			c.Command = cli.Command{Name: "tail", Flags: []cli.Flag{cli.StringFlag{Name: "output-format"}, cli.IntFlag{Name: "lines"}}}
+
+			err := tt.profile.ApplyDefaults(c, "tail")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if got := c.String("output-format"); got != tt.wantFormat {
+				t.Errorf("got output-format %q, want %q", got, tt.wantFormat)
+			}
+			if got := c.String("lines"); got != tt.wantLines {
+				t.Errorf("got lines %q, want %q", got, tt.wantLines)
+			}
+		})
+	}
+}
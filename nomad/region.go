@@ -0,0 +1,157 @@
+package nomad
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+// Label names the cluster and its region for output, like "production/eu-west"
+func (c *Cluster) Label() string {
+	switch {
+	case c.Name == "":
+		return c.Region
+	case c.Region == "":
+		return c.Name
+	}
+
+	return c.Name + "/" + c.Region
+}
+
+// RegionsFromCLI expands the clusters into a cluster per region selected with --region or
+// --all-regions. Without clusters, the cluster from the profile or the NOMAD_* environment
+// is expanded instead. The clusters are returned as they are when neither flag is used
+func RegionsFromCLI(c *cli.Context, clusters []*Cluster) ([]*Cluster, error) {
+	names := regionNames(c)
+	if len(names) == 0 && !lineageBool(c, "all-regions") {
+		return clusters, nil
+	}
+
+	if len(clusters) == 0 {
+		clusters = []*Cluster{currentCluster()}
+	}
+
+	result := make([]*Cluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		regions := names
+		if lineageBool(c, "all-regions") {
+			client, err := cluster.NewClient()
+			if err != nil {
+				return nil, err
+			}
+
+			if regions, err = client.Regions().List(); err != nil {
+				return nil, fmt.Errorf("could not list the regions of cluster %s: %s", cluster.Label(), err)
+			}
+		}
+
+		for _, region := range regions {
+			regional := *cluster
+			regional.Region = region
+			result = append(result, &regional)
+		}
+	}
+
+	return result, nil
+}
+
+// InRegions runs fn once per region selected with --region or --all-regions, one region at
+// a time, with a client for that region. fn runs once with the client of
+// NewNomadClientFromCLI and an empty region when neither flag is used
+func InRegions(c *cli.Context, logger *log.Logger, fn func(client *api.Client, region string) error) error {
+	regions := regionNames(c)
+
+	if lineageBool(c, "all-regions") {
+		client, err := NewNomadClientFromCLI(c)
+		if err != nil {
+			return err
+		}
+
+		if regions, err = client.Regions().List(); err != nil {
+			return fmt.Errorf("could not list the regions: %s", err)
+		}
+	}
+
+	if len(regions) == 0 {
+		client, err := NewNomadClientFromCLI(c)
+		if err != nil {
+			return err
+		}
+
+		return fn(client, "")
+	}
+
+	failed := 0
+	for _, region := range regions {
+		logger.Infof("Running in region %s", region)
+
+		client, err := NewNomadClientFromCLI(c)
+		if err == nil {
+			client.SetRegion(region)
+			err = fn(client, region)
+		}
+		if err != nil {
+			logger.Errorf("Region %s: %s", region, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed in %d of %d regions", failed, len(regions))
+	}
+
+	return nil
+}
+
+// regionNames are the regions from --region, like "eu-west,us-east"
+func regionNames(c *cli.Context) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(lineageString(c, "region"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// lineageString is the value of the string flag on the context, or the closest parent command setting it
+func lineageString(c *cli.Context, name string) string {
+	for ctx := c; ctx != nil; ctx = ctx.Parent() {
+		if value := ctx.String(name); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// lineageBool is true when the flag is set on the context or any of its parent commands
+func lineageBool(c *cli.Context, name string) bool {
+	for ctx := c; ctx != nil; ctx = ctx.Parent() {
+		if ctx.Bool(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// currentCluster is the cluster NewNomadClient connects to, as a cluster that can be
+// expanded into regions
+func currentCluster() *Cluster {
+	cluster := &Cluster{fromEnvironment: true}
+	if activeProfile != nil {
+		*cluster = activeProfile.Cluster
+		cluster.Name = ""
+	}
+
+	if activeToken != "" {
+		cluster.Token = activeToken
+	}
+
+	return cluster
+}
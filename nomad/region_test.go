@@ -0,0 +1,126 @@
+package nomad
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli"
+)
+
+func newRegionServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/regions" {
+			w.Write([]byte(`["eu-west","us-east"]`))
+			return
+		}
+		w.Write([]byte(fmt.Sprintf(`{"Region":%q}`, r.URL.Query().Get("region"))))
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("NOMAD_ADDR", server.URL)
+	t.Setenv("NOMAD_REGION", "")
+	t.Setenv("NOMAD_TOKEN", "")
+
+	return server
+}
+
+func newRegionContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.String("region", "", "")
+	set.Bool("all-regions", false, "")
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	return cli.NewContext(cli.NewApp(), set, nil)
+}
+
+func TestInRegions(t *testing.T) {
+	newRegionServer(t)
+
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name    string
+		args    []string
+		fail    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "agent region", want: []string{"=>"}},
+		{name: "one region", args: []string{"--region", "eu-west"}, want: []string{"eu-west=>eu-west"}},
+		{name: "some regions", args: []string{"--region", "eu-west, us-east"}, want: []string{"eu-west=>eu-west", "us-east=>us-east"}},
+		{name: "all regions", args: []string{"--all-regions"}, want: []string{"eu-west=>eu-west", "us-east=>us-east"}},
+		{name: "failed region", args: []string{"--all-regions"}, fail: "eu-west", want: []string{"eu-west=>eu-west", "us-east=>us-east"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0)
+			err := InRegions(newRegionContext(t, tt.args...), logger, func(client *api.Client, region string) error {
+				// the agent answers with the region the client asked for
+				var self struct{ Region string }
+				if _, err := client.Raw().Query("/v1/agent/self", &self, nil); err != nil {
+					return err
+				}
+
+				got = append(got, region+"=>"+self.Region)
+				if tt.fail != "" && region == tt.fail {
+					return fmt.Errorf("failed")
+				}
+				return nil
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegionsFromCLI(t *testing.T) {
+	server := newRegionServer(t)
+
+	tests := []struct {
+		name     string
+		args     []string
+		clusters []*Cluster
+		want     []string
+	}{
+		{name: "no regions", clusters: []*Cluster{{Name: "production"}}, want: []string{"production"}},
+		{name: "no clusters or regions", want: []string{}},
+		{name: "regions", args: []string{"--region", "eu-west,us-east"}, want: []string{"eu-west", "us-east"}},
+		{name: "regions of clusters", args: []string{"--region", "eu-west"}, clusters: []*Cluster{{Name: "production"}, {Name: "staging"}}, want: []string{"production/eu-west", "staging/eu-west"}},
+		{name: "all regions", args: []string{"--all-regions"}, want: []string{"eu-west", "us-east"}},
+		{name: "all regions of clusters", args: []string{"--all-regions"}, clusters: []*Cluster{{Name: "production", Address: server.URL}}, want: []string{"production/eu-west", "production/us-east"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusters, err := RegionsFromCLI(newRegionContext(t, tt.args...), tt.clusters)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, 0, len(clusters))
+			for _, cluster := range clusters {
+				got = append(got, cluster.Label())
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
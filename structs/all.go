@@ -7,6 +7,9 @@ type JobState map[string]int
 type NomadState struct {
 	Info map[string]string
 	Jobs map[string]TaskGroupState
+
+	// Regions has the jobs per region instead of Jobs, when exported with --region or --all-regions
+	Regions map[string]map[string]TaskGroupState `yaml:",omitempty"`
 }
 
 // TaskGroupState ...
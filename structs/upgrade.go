@@ -0,0 +1,16 @@
+package structs
+
+// UpgradeCampaign ...
+type UpgradeCampaign struct {
+	Target    string
+	StartedAt string `yaml:"started_at"`
+	UpdatedAt string `yaml:"updated_at"`
+	Nodes     map[string]UpgradeNodeState
+}
+
+// UpgradeNodeState ...
+type UpgradeNodeState struct {
+	Name      string
+	Status    string
+	UpdatedAt string `yaml:"updated_at"`
+}